@@ -0,0 +1,254 @@
+package broker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/gorilla/mux"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/brokerapi/auth"
+)
+
+// NewAPI returns the broker HTTP handler. Endpoints that brokerapi does not
+// implement, or implements partially (brokerapi cannot answer 200 to an
+// identical provision or bind request), are served by the broker itself and
+// take precedence over the brokerapi routes. Admin endpoints are served under
+// `/admin` with the same credentials.
+func NewAPI(serviceBroker *Broker, logger lager.Logger, credentials brokerapi.BrokerCredentials) http.Handler {
+	router := mux.NewRouter()
+
+	handler := apiHandler{
+		broker:        serviceBroker,
+		fleetUpgrades: &fleetUpgrades{upgrades: map[string]*FleetUpgrade{}},
+		logger:        logger.Session("api"),
+	}
+	router.HandleFunc("/v2/catalog", handler.catalog).Methods("GET")
+	router.HandleFunc("/v2/service_instances/{instance_id}", handler.provision).Methods("PUT")
+	router.HandleFunc("/v2/service_instances/{instance_id}", handler.getInstance).Methods("GET")
+	router.HandleFunc("/v2/service_instances/{instance_id}/service_bindings/{binding_id}", handler.bind).Methods("PUT")
+	router.HandleFunc("/v2/service_instances/{instance_id}/service_bindings/{binding_id}", handler.getBinding).Methods("GET")
+	router.HandleFunc("/admin/fleet_upgrades", handler.startFleetUpgrade).Methods("POST")
+	router.HandleFunc("/admin/fleet_upgrades/{fleet_upgrade_id}", handler.fleetUpgrade).Methods("GET")
+
+	brokerapi.AttachRoutes(router, serviceBroker, logger)
+
+	return auth.NewWrapper(credentials.Username, credentials.Password).Wrap(requestFieldsHandler(router))
+}
+
+type apiHandler struct {
+	broker        *Broker
+	fleetUpgrades *fleetUpgrades
+	logger        lager.Logger
+}
+
+// fleetUpgrades keeps the fleet upgrades started through the API, so their
+// reports can be retrieved while and after they run.
+type fleetUpgrades struct {
+	mutex    sync.Mutex
+	upgrades map[string]*FleetUpgrade
+}
+
+func (h apiHandler) catalog(w http.ResponseWriter, req *http.Request) {
+	catalog, err := h.broker.Catalog(req.Context())
+	if err != nil {
+		h.respond(w, http.StatusInternalServerError, brokerapi.ErrorResponse{
+			Description: err.Error(),
+		})
+		return
+	}
+
+	h.respond(w, http.StatusOK, catalog)
+}
+
+func (h apiHandler) provision(w http.ResponseWriter, req *http.Request) {
+	instanceID := mux.Vars(req)["instance_id"]
+
+	logger := h.logger.Session("provision", lager.Data{
+		instanceIDLogKey: instanceID,
+	})
+
+	var details brokerapi.ProvisionDetails
+	if err := json.NewDecoder(req.Body).Decode(&details); err != nil {
+		logger.Error("invalid-service-details", err)
+		h.respond(w, http.StatusUnprocessableEntity, brokerapi.ErrorResponse{
+			Description: err.Error(),
+		})
+		return
+	}
+
+	asyncAllowed, _ := strconv.ParseBool(req.URL.Query().Get("accepts_incomplete"))
+
+	provisionedServiceSpec, alreadyProvisioned, err := h.broker.provision(req.Context(), instanceID, details, asyncAllowed)
+	if err != nil {
+		h.respondError(w, logger, err)
+		return
+	}
+
+	status := http.StatusCreated
+	switch {
+	case provisionedServiceSpec.IsAsync:
+		status = http.StatusAccepted
+	case alreadyProvisioned:
+		status = http.StatusOK
+	}
+
+	h.respond(w, status, brokerapi.ProvisioningResponse{
+		DashboardURL:  provisionedServiceSpec.DashboardURL,
+		OperationData: provisionedServiceSpec.OperationData,
+	})
+}
+
+func (h apiHandler) bind(w http.ResponseWriter, req *http.Request) {
+	instanceID := mux.Vars(req)["instance_id"]
+	bindingID := mux.Vars(req)["binding_id"]
+
+	logger := h.logger.Session("bind", lager.Data{
+		instanceIDLogKey: instanceID,
+		bindingIDLogKey:  bindingID,
+	})
+
+	var details brokerapi.BindDetails
+	if err := json.NewDecoder(req.Body).Decode(&details); err != nil {
+		logger.Error("invalid-bind-details", err)
+		h.respond(w, http.StatusUnprocessableEntity, brokerapi.ErrorResponse{
+			Description: err.Error(),
+		})
+		return
+	}
+
+	binding, alreadyBound, err := h.broker.bind(req.Context(), instanceID, bindingID, details)
+	if err != nil {
+		h.respondError(w, logger, err)
+		return
+	}
+
+	status := http.StatusCreated
+	if alreadyBound {
+		status = http.StatusOK
+	}
+
+	h.respond(w, status, binding)
+}
+
+func (h apiHandler) getInstance(w http.ResponseWriter, req *http.Request) {
+	instanceID := mux.Vars(req)["instance_id"]
+
+	logger := h.logger.Session("get-instance", lager.Data{
+		instanceIDLogKey: instanceID,
+	})
+
+	instanceDetails, err := h.broker.GetInstance(req.Context(), instanceID)
+	if err != nil {
+		h.respondError(w, logger, err)
+		return
+	}
+
+	h.respond(w, http.StatusOK, instanceDetails)
+}
+
+func (h apiHandler) getBinding(w http.ResponseWriter, req *http.Request) {
+	instanceID := mux.Vars(req)["instance_id"]
+	bindingID := mux.Vars(req)["binding_id"]
+
+	logger := h.logger.Session("get-binding", lager.Data{
+		instanceIDLogKey: instanceID,
+		bindingIDLogKey:  bindingID,
+	})
+
+	bindingDetails, err := h.broker.GetBinding(req.Context(), instanceID, bindingID)
+	if err != nil {
+		h.respondError(w, logger, err)
+		return
+	}
+
+	h.respond(w, http.StatusOK, bindingDetails)
+}
+
+func (h apiHandler) startFleetUpgrade(w http.ResponseWriter, req *http.Request) {
+	logger := h.logger.Session("start-fleet-upgrade")
+
+	var options FleetUpgradeOptions
+	if err := json.NewDecoder(req.Body).Decode(&options); err != nil {
+		logger.Error("invalid-fleet-upgrade-options", err)
+		h.respond(w, http.StatusUnprocessableEntity, brokerapi.ErrorResponse{
+			Description: err.Error(),
+		})
+		return
+	}
+
+	fleetUpgrade, err := h.broker.PlanFleetUpgrade(req.Context(), options)
+	if err != nil {
+		h.respondError(w, logger, err)
+		return
+	}
+
+	if options.DryRun {
+		h.respond(w, http.StatusOK, fleetUpgrade.Report())
+		return
+	}
+
+	h.fleetUpgrades.mutex.Lock()
+	for _, other := range h.fleetUpgrades.upgrades {
+		report := other.Report()
+		if report.ServiceID == options.ServiceID && report.PlanID == options.PlanID && (report.State == FleetUpgradePlanned || report.State == FleetUpgradeInProgress) {
+			h.fleetUpgrades.mutex.Unlock()
+			h.respondError(w, logger, brokerapi.NewFailureResponse(
+				fmt.Errorf("Fleet upgrade `%s` is already in progress for Plan `%s`", report.ID, report.PlanID),
+				http.StatusConflict,
+				"fleet-upgrade-in-progress",
+			))
+			return
+		}
+	}
+	h.fleetUpgrades.upgrades[fleetUpgrade.Report().ID] = fleetUpgrade
+	h.fleetUpgrades.mutex.Unlock()
+
+	go h.broker.RunFleetUpgrade(fleetUpgrade, nil)
+
+	h.respond(w, http.StatusAccepted, fleetUpgrade.Report())
+}
+
+func (h apiHandler) fleetUpgrade(w http.ResponseWriter, req *http.Request) {
+	fleetUpgradeID := mux.Vars(req)["fleet_upgrade_id"]
+
+	h.fleetUpgrades.mutex.Lock()
+	fleetUpgrade, ok := h.fleetUpgrades.upgrades[fleetUpgradeID]
+	h.fleetUpgrades.mutex.Unlock()
+
+	if !ok {
+		h.respond(w, http.StatusNotFound, brokerapi.ErrorResponse{
+			Description: fmt.Sprintf("Fleet upgrade `%s` not found", fleetUpgradeID),
+		})
+		return
+	}
+
+	h.respond(w, http.StatusOK, fleetUpgrade.Report())
+}
+
+func (h apiHandler) respondError(w http.ResponseWriter, logger lager.Logger, err error) {
+	if failureResponse, ok := err.(*brokerapi.FailureResponse); ok {
+		logger.Error(failureResponse.LoggerAction(), failureResponse)
+		h.respond(w, failureResponse.ValidatedStatusCode(logger), failureResponse.ErrorResponse())
+		return
+	}
+
+	logger.Error("unknown-error", err)
+	h.respond(w, http.StatusInternalServerError, brokerapi.ErrorResponse{
+		Description: err.Error(),
+	})
+}
+
+func (h apiHandler) respond(w http.ResponseWriter, status int, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.logger.Error("encoding-response", err, lager.Data{
+			responseLogKey: response,
+		})
+	}
+}
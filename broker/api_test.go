@@ -0,0 +1,1184 @@
+package broker_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf/brokerapi"
+
+	. "github.com/frodenas/helm-osb/broker"
+	"github.com/frodenas/helm-osb/helm"
+	"github.com/frodenas/helm-osb/kubernetes"
+	"github.com/frodenas/helm-osb/store"
+)
+
+var _ = Describe("API", func() {
+	const (
+		instanceID = "fake-instance-id"
+		bindingID  = "fake-binding-id"
+	)
+
+	var (
+		storePath        string
+		stateStore       store.Store
+		helmDriver       *fakeDriver
+		kubernetesClient *fakeKubernetesClient
+		server           *httptest.Server
+		repository       *httptest.Server
+		chartVersions    []string
+		plans            []ServicePlan
+		config           Config
+		serviceBroker    *Broker
+	)
+
+	request := func(method string, path string, body string) (int, map[string]interface{}) {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		req.SetBasicAuth("fake-username", "fake-password")
+		req.Header.Set("X-Broker-API-Version", "2.13")
+
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close()
+
+		response := map[string]interface{}{}
+		content, err := ioutil.ReadAll(resp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(json.Unmarshal(content, &response)).To(Succeed())
+
+		return resp.StatusCode, response
+	}
+
+	provision := func(body string) (int, map[string]interface{}) {
+		return request("PUT", "/v2/service_instances/"+instanceID+"?accepts_incomplete=true", body)
+	}
+
+	lastOperation := func() string {
+		_, response := request("GET", "/v2/service_instances/"+instanceID+"/last_operation", "")
+		state, _ := response["state"].(string)
+		return state
+	}
+
+	startRepository := func() {
+		chartVersions = []string{"1.4.1", "1.4.3", "1.5.0"}
+		repository = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			index := "entries:\n  fake-chart:\n"
+			for _, version := range chartVersions {
+				index = index + "  - version: " + version + "\n"
+			}
+			w.Write([]byte(index))
+		}))
+	}
+
+	BeforeEach(func() {
+		var err error
+		storePath, err = ioutil.TempDir("", "broker-api")
+		Expect(err).ToNot(HaveOccurred())
+
+		stateStore, err = store.NewFileStore(storePath)
+		Expect(err).ToNot(HaveOccurred())
+
+		plans = []ServicePlan{
+			ServicePlan{
+				ID:   "fake-plan",
+				Name: "fake-plan",
+				Metadata: &ServicePlanMetadata{
+					Helm:        HelmConfig{Chart: "fake-chart"},
+					Credentials: CredentialsConfig{"release": "{{ .ReleaseName }}"},
+				},
+			},
+		}
+
+		helmDriver = newFakeDriver()
+		kubernetesClient = newFakeKubernetesClient()
+
+		config = Config{
+			Username:                     "fake-username",
+			Password:                     "fake-password",
+			AllowUserProvisionParameters: true,
+			AllowUserUpdateParameters:    true,
+			AllowUserBindParameters:      true,
+			Catalog: Catalog{
+				Services: []Service{
+					Service{
+						ID:       "fake-service",
+						Name:     "fake-service",
+						Bindable: true,
+					},
+				},
+			},
+		}
+	})
+
+	JustBeforeEach(func() {
+		config.Catalog.Services[0].Plans = plans
+
+		logger := lagertest.NewTestLogger("api")
+		serviceBroker = New(config, helmDriver, kubernetesClient, stateStore, logger)
+		server = httptest.NewServer(NewAPI(serviceBroker, logger, brokerapi.BrokerCredentials{
+			Username: config.Username,
+			Password: config.Password,
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(storePath)
+	})
+
+	Describe("provision", func() {
+		const provisionBody = `{"service_id":"fake-service","plan_id":"fake-plan","parameters":{"replicas":2}}`
+
+		It("returns 202 with the operation data", func() {
+			status, response := provision(provisionBody)
+			Expect(status).To(Equal(http.StatusAccepted))
+			Expect(response["operation"]).To(HavePrefix("provision:"))
+		})
+
+		It("returns 200 if an identical instance is already provisioned", func() {
+			status, _ := provision(provisionBody)
+			Expect(status).To(Equal(http.StatusAccepted))
+			Eventually(lastOperation).Should(Equal("succeeded"))
+
+			status, _ = provision(provisionBody)
+			Expect(status).To(Equal(http.StatusOK))
+		})
+
+		It("returns 409 if the instance exists with different parameters", func() {
+			status, _ := provision(provisionBody)
+			Expect(status).To(Equal(http.StatusAccepted))
+
+			status, _ = provision(`{"service_id":"fake-service","plan_id":"fake-plan","parameters":{"replicas":3}}`)
+			Expect(status).To(Equal(http.StatusConflict))
+		})
+
+		It("returns 409 if the release name is used by another instance", func() {
+			helmDriver.releaseNameTemplate = "{{ .Prefix }}-{{ .PlanName }}"
+
+			status, _ := provision(provisionBody)
+			Expect(status).To(Equal(http.StatusAccepted))
+
+			status, response := request("PUT", "/v2/service_instances/other-instance-id?accepts_incomplete=true", provisionBody)
+			Expect(status).To(Equal(http.StatusConflict))
+			Expect(response["description"]).To(Equal("Helm release `fake-fake-plan` is already used by instance `fake-instance-id`"))
+		})
+
+		It("returns 409 if a release exists for an unknown instance", func() {
+			helmDriver.releases[helmDriver.DefaultRelease(instanceID)] = map[string]interface{}{}
+
+			status, _ := provision(provisionBody)
+			Expect(status).To(Equal(http.StatusConflict))
+		})
+	})
+
+	Describe("update", func() {
+		update := func(body string) {
+			status, _ := request("PATCH", "/v2/service_instances/"+instanceID+"?accepts_incomplete=true", body)
+			Expect(status).To(Equal(http.StatusAccepted))
+			Eventually(lastOperation).Should(Equal("succeeded"))
+		}
+
+		releaseValues := func() map[string]interface{} {
+			values, err := helmDriver.ReleaseValues(context.Background(), helmDriver.DefaultRelease(instanceID))
+			Expect(err).ToNot(HaveOccurred())
+			return values
+		}
+
+		BeforeEach(func() {
+			planUpdateable := true
+			plans[0].PlanUpdateable = &planUpdateable
+			plans = append(plans, ServicePlan{
+				ID:   "fake-large-plan",
+				Name: "fake-large-plan",
+				Metadata: &ServicePlanMetadata{
+					Helm: HelmConfig{
+						Chart:  "fake-chart",
+						Values: &HelmChartValues{"replicas": 3, "persistence": map[string]interface{}{"size": "10Gi"}},
+					},
+				},
+			})
+		})
+
+		It("upgrades the release with the user parameters", func() {
+			provision(`{"service_id":"fake-service","plan_id":"fake-plan","parameters":{"replicas":2}}`)
+			Eventually(lastOperation).Should(Equal("succeeded"))
+
+			update(`{"service_id":"fake-service","plan_id":"fake-plan","parameters":{"persistence":{"size":"5Gi"}}}`)
+			Expect(releaseValues()).To(HaveKeyWithValue("replicas", BeEquivalentTo(2)))
+			Expect(releaseValues()).To(HaveKeyWithValue("persistence", map[string]interface{}{"size": "5Gi"}))
+		})
+
+		It("keeps the user parameters of earlier updates", func() {
+			provision(`{"service_id":"fake-service","plan_id":"fake-plan"}`)
+			Eventually(lastOperation).Should(Equal("succeeded"))
+
+			update(`{"service_id":"fake-service","plan_id":"fake-plan","parameters":{"replicas":2}}`)
+			update(`{"service_id":"fake-service","plan_id":"fake-plan","parameters":{"image.tag":"v2"}}`)
+			Expect(releaseValues()).To(HaveKeyWithValue("replicas", BeEquivalentTo(2)))
+			Expect(releaseValues()).To(HaveKeyWithValue("image", map[string]interface{}{"tag": "v2"}))
+
+			instance, _, err := stateStore.GetInstance(instanceID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(instance.Parameters).To(HaveKeyWithValue("replicas", BeEquivalentTo(2)))
+			Expect(instance.Parameters).To(HaveKeyWithValue("image", map[string]interface{}{"tag": "v2"}))
+		})
+
+		It("moves the instance to another plan", func() {
+			provision(`{"service_id":"fake-service","plan_id":"fake-plan","parameters":{"replicas":2}}`)
+			Eventually(lastOperation).Should(Equal("succeeded"))
+
+			update(`{"service_id":"fake-service","plan_id":"fake-large-plan","previous_values":{"plan_id":"fake-plan"}}`)
+			Expect(releaseValues()).To(HaveKeyWithValue("replicas", BeEquivalentTo(2)))
+			Expect(releaseValues()).To(HaveKeyWithValue("persistence", map[string]interface{}{"size": "10Gi"}))
+
+			instance, _, err := stateStore.GetInstance(instanceID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(instance.PlanID).To(Equal("fake-large-plan"))
+		})
+
+		It("recovers the user parameters of instances provisioned before state was recorded", func() {
+			helmDriver.releases[helmDriver.DefaultRelease(instanceID)] = map[string]interface{}{
+				"replicas":    5,
+				"persistence": map[string]interface{}{"size": "10Gi"},
+			}
+
+			update(`{"service_id":"fake-service","plan_id":"fake-large-plan","previous_values":{"plan_id":"fake-large-plan"},"parameters":{"image.tag":"v2"}}`)
+			Expect(releaseValues()).To(HaveKeyWithValue("replicas", BeEquivalentTo(5)))
+			Expect(releaseValues()).To(HaveKeyWithValue("image", map[string]interface{}{"tag": "v2"}))
+
+			instance, _, err := stateStore.GetInstance(instanceID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(instance.Parameters).To(HaveLen(2))
+			Expect(instance.Parameters).To(HaveKeyWithValue("replicas", BeEquivalentTo(5)))
+			Expect(instance.Parameters).To(HaveKeyWithValue("image", map[string]interface{}{"tag": "v2"}))
+		})
+	})
+
+	Describe("parameters schemas", func() {
+		BeforeEach(func() {
+			plans = append(plans, ServicePlan{
+				ID:   "fake-schema-plan",
+				Name: "fake-schema-plan",
+				Metadata: &ServicePlanMetadata{
+					Helm: HelmConfig{Chart: "fake-chart"},
+				},
+				Schemas: &ServicePlanSchemas{
+					ServiceInstance: &ServiceInstanceSchema{
+						CreateSchema: CreateSchema{
+							Parameters: json.RawMessage(`{"type":"object","properties":{"persistence":{"type":"object","properties":{"size":{"enum":["1Gi","10Gi"]}}}}}`),
+						},
+					},
+				},
+			})
+		})
+
+		It("accepts parameters that match the schema", func() {
+			status, _ := provision(`{"service_id":"fake-service","plan_id":"fake-schema-plan","parameters":{"persistence.size":"10Gi"}}`)
+			Expect(status).To(Equal(http.StatusAccepted))
+		})
+
+		It("returns 400 if the parameters do not match the schema", func() {
+			status, _ := provision(`{"service_id":"fake-service","plan_id":"fake-schema-plan","parameters":{"persistence":{"size":"100Ti"}}}`)
+			Expect(status).To(Equal(http.StatusBadRequest))
+		})
+
+		It("returns 400 if dotted parameters do not match the schema", func() {
+			status, _ := provision(`{"service_id":"fake-service","plan_id":"fake-schema-plan","parameters":{"persistence.size":"100Ti"}}`)
+			Expect(status).To(Equal(http.StatusBadRequest))
+		})
+	})
+
+	Describe("concurrent operations", func() {
+		var block chan struct{}
+
+		BeforeEach(func() {
+			block = make(chan struct{})
+		})
+
+		AfterEach(func() {
+			select {
+			case <-block:
+			default:
+				close(block)
+			}
+		})
+
+		It("returns 422 when deprovisioning an instance being provisioned", func() {
+			helmDriver.block = block
+
+			status, _ := provision(`{"service_id":"fake-service","plan_id":"fake-plan"}`)
+			Expect(status).To(Equal(http.StatusAccepted))
+
+			status, response := request("DELETE", "/v2/service_instances/"+instanceID+"?service_id=fake-service&plan_id=fake-plan&accepts_incomplete=true", "")
+			Expect(status).To(Equal(http.StatusUnprocessableEntity))
+			Expect(response["error"]).To(Equal("ConcurrencyError"))
+
+			close(block)
+			Eventually(lastOperation).Should(Equal("succeeded"))
+
+			status, _ = request("DELETE", "/v2/service_instances/"+instanceID+"?service_id=fake-service&plan_id=fake-plan&accepts_incomplete=true", "")
+			Expect(status).To(Equal(http.StatusAccepted))
+		})
+
+		It("returns 422 when updating an instance being updated", func() {
+			provision(`{"service_id":"fake-service","plan_id":"fake-plan"}`)
+			Eventually(lastOperation).Should(Equal("succeeded"))
+
+			helmDriver.mutex.Lock()
+			helmDriver.block = block
+			helmDriver.mutex.Unlock()
+
+			status, _ := request("PATCH", "/v2/service_instances/"+instanceID+"?accepts_incomplete=true", `{"service_id":"fake-service","plan_id":"fake-plan","parameters":{"replicas":2}}`)
+			Expect(status).To(Equal(http.StatusAccepted))
+
+			status, response := request("PATCH", "/v2/service_instances/"+instanceID+"?accepts_incomplete=true", `{"service_id":"fake-service","plan_id":"fake-plan","parameters":{"replicas":3}}`)
+			Expect(status).To(Equal(http.StatusUnprocessableEntity))
+			Expect(response["error"]).To(Equal("ConcurrencyError"))
+
+			close(block)
+			Eventually(lastOperation).Should(Equal("succeeded"))
+			Expect(helmDriver.ReleaseValues(context.Background(), helmDriver.DefaultRelease(instanceID))).To(HaveKeyWithValue("replicas", BeEquivalentTo(2)))
+		})
+
+		It("does not block operations on other instances", func() {
+			helmDriver.block = block
+
+			status, _ := provision(`{"service_id":"fake-service","plan_id":"fake-plan"}`)
+			Expect(status).To(Equal(http.StatusAccepted))
+
+			status, _ = request("PUT", "/v2/service_instances/other-instance-id?accepts_incomplete=true", `{"service_id":"fake-service","plan_id":"fake-plan"}`)
+			Expect(status).To(Equal(http.StatusAccepted))
+		})
+
+		Context("when the operation queue is full", func() {
+			BeforeEach(func() {
+				config.ConcurrentOperations = 1
+				config.QueuedOperations = 1
+			})
+
+			It("returns 503 and accepts the provision once the queue has room", func() {
+				helmDriver.block = block
+
+				status, _ := request("PUT", "/v2/service_instances/running-instance-id?accepts_incomplete=true", `{"service_id":"fake-service","plan_id":"fake-plan"}`)
+				Expect(status).To(Equal(http.StatusAccepted))
+				Eventually(func() interface{} {
+					_, response := request("GET", "/v2/service_instances/running-instance-id/last_operation", "")
+					return response["description"]
+				}).Should(Equal("Provision in progress"))
+
+				status, _ = request("PUT", "/v2/service_instances/queued-instance-id?accepts_incomplete=true", `{"service_id":"fake-service","plan_id":"fake-plan"}`)
+				Expect(status).To(Equal(http.StatusAccepted))
+
+				status, _ = provision(`{"service_id":"fake-service","plan_id":"fake-plan"}`)
+				Expect(status).To(Equal(http.StatusServiceUnavailable))
+
+				close(block)
+				Eventually(func() interface{} {
+					_, response := request("GET", "/v2/service_instances/queued-instance-id/last_operation", "")
+					return response["state"]
+				}).Should(Equal("succeeded"))
+
+				status, _ = provision(`{"service_id":"fake-service","plan_id":"fake-plan"}`)
+				Expect(status).To(Equal(http.StatusAccepted))
+				Eventually(lastOperation).Should(Equal("succeeded"))
+			})
+		})
+	})
+
+	Describe("readiness", func() {
+		lastOperationDescription := func() string {
+			_, response := request("GET", "/v2/service_instances/"+instanceID+"/last_operation", "")
+			description, _ := response["description"].(string)
+			return description
+		}
+
+		deployment := func(readyReplicas int) kubernetes.Deployment {
+			replicas := 3
+			return kubernetes.Deployment{
+				Spec:   kubernetes.WorkloadSpec{Replicas: &replicas},
+				Status: kubernetes.WorkloadStatus{Replicas: 3, ReadyReplicas: readyReplicas, UpdatedReplicas: 3},
+			}
+		}
+
+		BeforeEach(func() {
+			plans = append(plans, ServicePlan{
+				ID:   "fake-ready-plan",
+				Name: "fake-ready-plan",
+				Metadata: &ServicePlanMetadata{
+					Helm: HelmConfig{Chart: "fake-chart", WaitForReady: true},
+				},
+			})
+
+			helmDriver.manifest = helm.Manifest{
+				helm.Resource{Kind: "Deployment", Metadata: helm.ResourceMetadata{Name: "web", Namespace: "fake-namespace"}},
+			}
+		})
+
+		It("reports the provision in progress until the workloads are ready", func() {
+			kubernetesClient.setObject("fake-namespace", "deployment", "web", deployment(2))
+
+			status, _ := provision(`{"service_id":"fake-service","plan_id":"fake-ready-plan"}`)
+			Expect(status).To(Equal(http.StatusAccepted))
+			Eventually(lastOperationDescription).Should(Equal("Waiting for workloads: 2/3 pods ready"))
+			Expect(lastOperation()).To(Equal("in progress"))
+
+			kubernetesClient.setObject("fake-namespace", "deployment", "web", deployment(3))
+			Eventually(lastOperation).Should(Equal("succeeded"))
+		})
+
+		It("waits for jobs to complete and volume claims to be bound", func() {
+			helmDriver.manifest = helm.Manifest{
+				helm.Resource{Kind: "Job", Metadata: helm.ResourceMetadata{Name: "migrate", Namespace: "fake-namespace"}},
+				helm.Resource{Kind: "PersistentVolumeClaim", Metadata: helm.ResourceMetadata{Name: "data", Namespace: "fake-namespace"}},
+			}
+
+			provision(`{"service_id":"fake-service","plan_id":"fake-ready-plan"}`)
+			Eventually(lastOperationDescription).Should(Equal("Waiting for workloads: 0/1 jobs complete, 0/1 volume claims bound"))
+
+			kubernetesClient.setObject("fake-namespace", "job", "migrate", kubernetes.Job{Status: kubernetes.JobStatus{Succeeded: 1}})
+			kubernetesClient.setObject("fake-namespace", "persistentvolumeclaim", "data", kubernetes.PersistentVolumeClaim{Status: kubernetes.PersistentVolumeClaimStatus{Phase: "Bound"}})
+			Eventually(lastOperation).Should(Equal("succeeded"))
+		})
+
+		It("does not wait for workloads if the plan does not ask to", func() {
+			status, _ := provision(`{"service_id":"fake-service","plan_id":"fake-plan"}`)
+			Expect(status).To(Equal(http.StatusAccepted))
+			Eventually(lastOperation).Should(Equal("succeeded"))
+		})
+	})
+
+	Describe("tests", func() {
+		BeforeEach(func() {
+			plans = append(plans, ServicePlan{
+				ID:   "fake-tested-plan",
+				Name: "fake-tested-plan",
+				Metadata: &ServicePlanMetadata{
+					Helm: HelmConfig{Chart: "fake-chart", RunTests: true},
+				},
+			})
+		})
+
+		It("succeeds if the release tests pass", func() {
+			status, _ := provision(`{"service_id":"fake-service","plan_id":"fake-tested-plan"}`)
+			Expect(status).To(Equal(http.StatusAccepted))
+			Eventually(lastOperation).Should(Equal("succeeded"))
+		})
+
+		It("fails the operation if the release tests fail", func() {
+			helmDriver.testError = &helm.Error{Reason: helm.ReasonTestFailed, Action: "testing", Release: "fake-fakeinstanceid", Message: "Tests failed: fake-test-connection"}
+
+			provision(`{"service_id":"fake-service","plan_id":"fake-tested-plan"}`)
+			Eventually(lastOperation).Should(Equal("failed"))
+
+			_, response := request("GET", "/v2/service_instances/"+instanceID+"/last_operation", "")
+			Expect(response["description"]).To(Equal("Error testing Helm release `fake-fakeinstanceid`: Tests failed: fake-test-connection"))
+		})
+	})
+
+	Describe("rollbacks", func() {
+		update := func(planID string) {
+			status, _ := request("PATCH", "/v2/service_instances/"+instanceID+"?accepts_incomplete=true", `{"service_id":"fake-service","plan_id":"`+planID+`","parameters":{"replicas":3}}`)
+			Expect(status).To(Equal(http.StatusAccepted))
+		}
+
+		BeforeEach(func() {
+			plans = append(plans, ServicePlan{
+				ID:   "fake-rollback-plan",
+				Name: "fake-rollback-plan",
+				Metadata: &ServicePlanMetadata{
+					Helm: HelmConfig{Chart: "fake-chart", RollbackOnFailure: true},
+				},
+			})
+		})
+
+		It("rolls back failed upgrades and records the rollback", func() {
+			provision(`{"service_id":"fake-service","plan_id":"fake-rollback-plan"}`)
+			Eventually(lastOperation).Should(Equal("succeeded"))
+
+			helmDriver.upgradeError = &helm.Error{Reason: helm.ReasonUnknown, Action: "upgrading", Release: "fake-fakeinstanceid", Message: "boom"}
+			update("fake-rollback-plan")
+			Eventually(lastOperation).Should(Equal("failed"))
+
+			_, response := request("GET", "/v2/service_instances/"+instanceID+"/last_operation", "")
+			Expect(response["description"]).To(Equal("Update failed (Error upgrading Helm release `fake-fakeinstanceid`: boom), the instance was restored to revision 1"))
+			Expect(helmDriver.rollbacks).To(Equal([]int{1}))
+
+			operations, err := stateStore.ListOperations(instanceID)
+			Expect(err).ToNot(HaveOccurred())
+			rollbacks := []store.Operation{}
+			for _, operation := range operations {
+				if operation.Type == store.RollbackOperation {
+					rollbacks = append(rollbacks, operation)
+				}
+			}
+			Expect(rollbacks).To(HaveLen(1))
+			Expect(rollbacks[0].State).To(Equal(store.OperationSucceeded))
+		})
+
+		It("rolls back to the last deployed revision after earlier failures", func() {
+			provision(`{"service_id":"fake-service","plan_id":"fake-rollback-plan"}`)
+			Eventually(lastOperation).Should(Equal("succeeded"))
+
+			update("fake-rollback-plan")
+			Eventually(lastOperation).Should(Equal("succeeded"))
+
+			helmDriver.mutex.Lock()
+			helmDriver.upgradeError = &helm.Error{Reason: helm.ReasonUnknown, Message: "boom"}
+			helmDriver.mutex.Unlock()
+
+			update("fake-rollback-plan")
+			Eventually(lastOperation).Should(Equal("failed"))
+			update("fake-rollback-plan")
+			Eventually(lastOperation).Should(Equal("failed"))
+
+			helmDriver.mutex.Lock()
+			defer helmDriver.mutex.Unlock()
+			Expect(helmDriver.rollbacks).To(Equal([]int{2, 4}))
+		})
+
+		It("fails clearly if there is no deployed revision to roll back to", func() {
+			provision(`{"service_id":"fake-service","plan_id":"fake-rollback-plan"}`)
+			Eventually(lastOperation).Should(Equal("succeeded"))
+
+			helmDriver.mutex.Lock()
+			release := helmDriver.DefaultRelease(instanceID)
+			helmDriver.history[release] = []helm.ReleaseRevision{helm.ReleaseRevision{Revision: 1, Status: helm.StatusFailed}}
+			helmDriver.upgradeError = &helm.Error{Reason: helm.ReasonUnknown, Action: "upgrading", Release: release.Name, Message: "boom"}
+			helmDriver.mutex.Unlock()
+
+			update("fake-rollback-plan")
+			Eventually(lastOperation).Should(Equal("failed"))
+
+			_, response := request("GET", "/v2/service_instances/"+instanceID+"/last_operation", "")
+			Expect(response["description"]).To(Equal("Update failed (Error upgrading Helm release `fake-fakeinstanceid`: boom), and no deployed revision was found to roll back to"))
+			Expect(helmDriver.rollbacks).To(BeEmpty())
+		})
+
+		It("does not roll back if the plan does not ask to", func() {
+			provision(`{"service_id":"fake-service","plan_id":"fake-plan"}`)
+			Eventually(lastOperation).Should(Equal("succeeded"))
+
+			helmDriver.upgradeError = &helm.Error{Reason: helm.ReasonUnknown, Message: "boom"}
+			update("fake-plan")
+			Eventually(lastOperation).Should(Equal("failed"))
+			Expect(helmDriver.rollbacks).To(BeEmpty())
+		})
+	})
+
+	Describe("chart versions", func() {
+		BeforeEach(func() {
+			startRepository()
+			plans = append(plans, ServicePlan{
+				ID:   "fake-constrained-plan",
+				Name: "fake-constrained-plan",
+				Metadata: &ServicePlanMetadata{
+					Helm: HelmConfig{Chart: "fake-chart", Repository: repository.URL, Version: "~1.4"},
+				},
+			})
+		})
+
+		AfterEach(func() {
+			repository.Close()
+		})
+
+		It("resolves the version constraint and pins the version on updates", func() {
+			status, _ := provision(`{"service_id":"fake-service","plan_id":"fake-constrained-plan"}`)
+			Expect(status).To(Equal(http.StatusAccepted))
+			Eventually(lastOperation).Should(Equal("succeeded"))
+			Expect(helmDriver.chartVersion(helmDriver.DefaultRelease(instanceID))).To(Equal("1.4.3"))
+
+			chartVersions = append(chartVersions, "1.4.5")
+			status, _ = request("PATCH", "/v2/service_instances/"+instanceID+"?accepts_incomplete=true", `{"service_id":"fake-service","plan_id":"fake-constrained-plan","parameters":{"replicas":3}}`)
+			Expect(status).To(Equal(http.StatusAccepted))
+			Eventually(lastOperation).Should(Equal("succeeded"))
+			Expect(helmDriver.chartVersion(helmDriver.DefaultRelease(instanceID))).To(Equal("1.4.3"))
+
+			instance, _, err := stateStore.GetInstance(instanceID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(instance.ChartVersion).To(Equal("1.4.3"))
+			Expect(instance.ChartConstraint).To(Equal("~1.4"))
+		})
+	})
+
+	Describe("fleet upgrades", func() {
+		instanceIDs := []string{"fleet-instance-1", "fleet-instance-2", "fleet-instance-3"}
+
+		fleetUpgradeState := func(fleetUpgradeID string) func() string {
+			return func() string {
+				_, response := request("GET", "/admin/fleet_upgrades/"+fleetUpgradeID, "")
+				state, _ := response["state"].(string)
+				return state
+			}
+		}
+
+		instanceVersions := func() []string {
+			versions := []string{}
+			for _, id := range instanceIDs {
+				versions = append(versions, helmDriver.chartVersion(helmDriver.DefaultRelease(id)))
+			}
+			return versions
+		}
+
+		instanceResult := func(response map[string]interface{}, i int) map[string]interface{} {
+			instances, _ := response["instances"].([]interface{})
+			Expect(instances).To(HaveLen(len(instanceIDs)))
+			return instances[i].(map[string]interface{})
+		}
+
+		var planMetadata *ServicePlanMetadata
+
+		BeforeEach(func() {
+			startRepository()
+			planMetadata = &ServicePlanMetadata{
+				Helm: HelmConfig{Chart: "fake-chart", Repository: repository.URL, Version: "~1.4"},
+			}
+			plans = append(plans, ServicePlan{
+				ID:       "fake-constrained-plan",
+				Name:     "fake-constrained-plan",
+				Metadata: planMetadata,
+			})
+		})
+
+		JustBeforeEach(func() {
+			for _, id := range instanceIDs {
+				status, _ := request("PUT", "/v2/service_instances/"+id+"?accepts_incomplete=true", `{"service_id":"fake-service","plan_id":"fake-constrained-plan"}`)
+				Expect(status).To(Equal(http.StatusAccepted))
+				Eventually(func() interface{} {
+					_, response := request("GET", "/v2/service_instances/"+id+"/last_operation", "")
+					return response["state"]
+				}).Should(Equal("succeeded"))
+			}
+
+			planMetadata.Helm.Version = "~1.5"
+		})
+
+		AfterEach(func() {
+			repository.Close()
+		})
+
+		It("lists the instances to upgrade in batches on dry runs", func() {
+			status, response := request("POST", "/admin/fleet_upgrades", `{"service_id":"fake-service","plan_id":"fake-constrained-plan","batch_size":2,"canaries":1,"dry_run":true}`)
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(response["state"]).To(Equal("planned"))
+
+			Expect(instanceResult(response, 0)).To(Equal(map[string]interface{}{
+				"instance_id":  "fleet-instance-1",
+				"batch":        float64(1),
+				"canary":       true,
+				"from_version": "1.4.3",
+				"to_version":   "1.5.0",
+				"state":        "pending",
+			}))
+			Expect(instanceResult(response, 1)["batch"]).To(Equal(float64(2)))
+			Expect(instanceResult(response, 2)["batch"]).To(Equal(float64(2)))
+
+			Expect(instanceVersions()).To(Equal([]string{"1.4.3", "1.4.3", "1.4.3"}))
+		})
+
+		It("upgrades the instances onto the plan chart version", func() {
+			status, response := request("POST", "/admin/fleet_upgrades", `{"service_id":"fake-service","plan_id":"fake-constrained-plan","batch_size":2,"canaries":1}`)
+			Expect(status).To(Equal(http.StatusAccepted))
+			Eventually(fleetUpgradeState(response["id"].(string))).Should(Equal("finished"))
+
+			Expect(instanceVersions()).To(Equal([]string{"1.5.0", "1.5.0", "1.5.0"}))
+
+			instance, _, err := stateStore.GetInstance("fleet-instance-2")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(instance.ChartVersion).To(Equal("1.5.0"))
+			Expect(instance.ChartConstraint).To(Equal("~1.5"))
+
+			status, response = request("POST", "/admin/fleet_upgrades", `{"service_id":"fake-service","plan_id":"fake-constrained-plan","dry_run":true}`)
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(response["summary"]).To(Equal(map[string]interface{}{"up-to-date": float64(3)}))
+		})
+
+		It("pauses when a canary fails", func() {
+			helmDriver.upgradeError = &helm.Error{Reason: helm.ReasonUnknown, Message: "boom"}
+
+			status, response := request("POST", "/admin/fleet_upgrades", `{"service_id":"fake-service","plan_id":"fake-constrained-plan","canaries":1}`)
+			Expect(status).To(Equal(http.StatusAccepted))
+			fleetUpgradeID := response["id"].(string)
+			Eventually(fleetUpgradeState(fleetUpgradeID)).Should(Equal("paused"))
+
+			_, response = request("GET", "/admin/fleet_upgrades/"+fleetUpgradeID, "")
+			Expect(instanceResult(response, 0)["state"]).To(Equal("failed"))
+			Expect(instanceResult(response, 0)["description"]).To(Equal("boom"))
+			Expect(instanceResult(response, 1)["state"]).To(Equal("pending"))
+			Expect(instanceResult(response, 2)["state"]).To(Equal("pending"))
+		})
+
+		It("keeps the updates made after the upgrade was planned", func() {
+			fleetUpgrade, err := serviceBroker.PlanFleetUpgrade(context.Background(), FleetUpgradeOptions{ServiceID: "fake-service", PlanID: "fake-constrained-plan"})
+			Expect(err).ToNot(HaveOccurred())
+
+			status, _ := request("PATCH", "/v2/service_instances/fleet-instance-1?accepts_incomplete=true", `{"service_id":"fake-service","plan_id":"fake-constrained-plan","parameters":{"replicas":5}}`)
+			Expect(status).To(Equal(http.StatusAccepted))
+			Eventually(func() interface{} {
+				_, response := request("GET", "/v2/service_instances/fleet-instance-1/last_operation", "")
+				return response["state"]
+			}).Should(Equal("succeeded"))
+
+			report := serviceBroker.RunFleetUpgrade(fleetUpgrade, nil)
+			Expect(report.State).To(Equal(FleetUpgradeFinished))
+			Expect(instanceVersions()).To(Equal([]string{"1.5.0", "1.5.0", "1.5.0"}))
+
+			release := helmDriver.DefaultRelease("fleet-instance-1")
+			Expect(helmDriver.ReleaseValues(context.Background(), release)).To(HaveKeyWithValue("replicas", BeEquivalentTo(5)))
+
+			instance, _, err := stateStore.GetInstance("fleet-instance-1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(instance.Parameters).To(HaveKeyWithValue("replicas", BeEquivalentTo(5)))
+			Expect(instance.ChartVersion).To(Equal("1.5.0"))
+		})
+
+		It("skips the instances with an operation in progress when their upgrade starts", func() {
+			fleetUpgrade, err := serviceBroker.PlanFleetUpgrade(context.Background(), FleetUpgradeOptions{ServiceID: "fake-service", PlanID: "fake-constrained-plan", BatchSize: 3})
+			Expect(err).ToNot(HaveOccurred())
+
+			block := make(chan struct{})
+			helmDriver.mutex.Lock()
+			helmDriver.block = block
+			helmDriver.mutex.Unlock()
+
+			status, _ := request("PATCH", "/v2/service_instances/fleet-instance-1?accepts_incomplete=true", `{"service_id":"fake-service","plan_id":"fake-constrained-plan","parameters":{"replicas":5}}`)
+			Expect(status).To(Equal(http.StatusAccepted))
+
+			reports := make(chan FleetUpgradeReport, 1)
+			go func() {
+				reports <- serviceBroker.RunFleetUpgrade(fleetUpgrade, nil)
+			}()
+			Eventually(func() FleetInstanceState { return fleetUpgrade.Report().Instances[0].State }).Should(Equal(FleetInstanceSkipped))
+			close(block)
+
+			var report FleetUpgradeReport
+			Eventually(reports).Should(Receive(&report))
+			Expect(report.State).To(Equal(FleetUpgradeFinished))
+			Expect(report.Instances[0].Description).To(HavePrefix("Operation `"))
+			Expect(report.Instances[1].State).To(Equal(FleetInstanceUpgraded))
+			Expect(report.Instances[2].State).To(Equal(FleetInstanceUpgraded))
+		})
+
+		It("skips the instances with an operation in progress in another broker process", func() {
+			fleetUpgrade, err := serviceBroker.PlanFleetUpgrade(context.Background(), FleetUpgradeOptions{ServiceID: "fake-service", PlanID: "fake-constrained-plan", BatchSize: 3})
+			Expect(err).ToNot(HaveOccurred())
+
+			operation, err := store.NewOperation("fleet-instance-1", store.UpgradeOperation)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stateStore.SaveOperation(operation)).To(Succeed())
+
+			report := serviceBroker.RunFleetUpgrade(fleetUpgrade, nil)
+			Expect(report.State).To(Equal(FleetUpgradeFinished))
+			Expect(report.Instances[0].State).To(Equal(FleetInstanceSkipped))
+			Expect(report.Instances[0].Description).To(Equal("Operation `" + operation.ID + "` in progress"))
+			Expect(report.Instances[1].State).To(Equal(FleetInstanceUpgraded))
+			Expect(report.Instances[2].State).To(Equal(FleetInstanceUpgraded))
+		})
+
+		It("fails the instances whose upgrade panics", func() {
+			helmDriver.mutex.Lock()
+			helmDriver.upgradePanic = true
+			helmDriver.mutex.Unlock()
+
+			fleetUpgrade, err := serviceBroker.PlanFleetUpgrade(context.Background(), FleetUpgradeOptions{ServiceID: "fake-service", PlanID: "fake-constrained-plan", Canaries: 1})
+			Expect(err).ToNot(HaveOccurred())
+
+			report := serviceBroker.RunFleetUpgrade(fleetUpgrade, nil)
+			Expect(report.State).To(Equal(FleetUpgradePaused))
+			Expect(report.Instances[0].State).To(Equal(FleetInstanceFailed))
+			Expect(report.Instances[0].Description).To(Equal("Upgrade aborted"))
+
+			operation, found, err := stateStore.GetOperation("fleet-instance-1", report.Instances[0].OperationID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(BeTrue())
+			Expect(operation.State).To(Equal(store.OperationFailed))
+		})
+
+		It("returns 422 if the plan does not exist", func() {
+			status, _ := request("POST", "/admin/fleet_upgrades", `{"service_id":"fake-service","plan_id":"unknown-plan"}`)
+			Expect(status).To(Equal(http.StatusUnprocessableEntity))
+		})
+
+		It("returns 404 if the fleet upgrade does not exist", func() {
+			status, _ := request("GET", "/admin/fleet_upgrades/unknown-fleet-upgrade-id", "")
+			Expect(status).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	Describe("maintenance info", func() {
+		planMaintenanceInfoVersion := func(planID string) string {
+			_, response := request("GET", "/v2/catalog", "")
+			service := response["services"].([]interface{})[0].(map[string]interface{})
+			for _, plan := range service["plans"].([]interface{}) {
+				plan := plan.(map[string]interface{})
+				if plan["id"] == planID {
+					return plan["maintenance_info"].(map[string]interface{})["version"].(string)
+				}
+			}
+			return ""
+		}
+
+		var planMetadata *ServicePlanMetadata
+
+		BeforeEach(func() {
+			planMetadata = &ServicePlanMetadata{
+				Helm: HelmConfig{Chart: "fake-chart", Version: "1.2.0"},
+			}
+			plans = append(plans, ServicePlan{
+				ID:       "fake-maintained-plan",
+				Name:     "fake-maintained-plan",
+				Metadata: planMetadata,
+			})
+		})
+
+		It("returns 422 if the maintenance info does not match the plan", func() {
+			status, response := provision(`{"service_id":"fake-service","plan_id":"fake-maintained-plan","maintenance_info":{"version":"1.1.0"}}`)
+			Expect(status).To(Equal(http.StatusUnprocessableEntity))
+			Expect(response["error"]).To(Equal("MaintenanceInfoConflict"))
+		})
+
+		It("returns 422 if the plan has no maintenance info", func() {
+			status, response := provision(`{"service_id":"fake-service","plan_id":"fake-plan","maintenance_info":{"version":"1.2.0"}}`)
+			Expect(status).To(Equal(http.StatusUnprocessableEntity))
+			Expect(response["error"]).To(Equal("MaintenanceInfoConflict"))
+		})
+
+		It("upgrades the instance when the maintenance info changes", func() {
+			status, _ := provision(`{"service_id":"fake-service","plan_id":"fake-maintained-plan","maintenance_info":{"version":"1.2.0"}}`)
+			Expect(status).To(Equal(http.StatusAccepted))
+			Eventually(lastOperation).Should(Equal("succeeded"))
+
+			planMetadata.Helm.Version = "1.3.0"
+			planMetadata.Helm.Values = &HelmChartValues{"replicas": 2}
+			version := planMaintenanceInfoVersion("fake-maintained-plan")
+			Expect(version).To(HavePrefix("1.3.0+values."))
+
+			status, response := request("PATCH", "/v2/service_instances/"+instanceID+"?accepts_incomplete=true", `{"service_id":"fake-service","plan_id":"fake-maintained-plan","maintenance_info":{"version":"1.2.0"}}`)
+			Expect(status).To(Equal(http.StatusUnprocessableEntity))
+			Expect(response["error"]).To(Equal("MaintenanceInfoConflict"))
+
+			status, _ = request("PATCH", "/v2/service_instances/"+instanceID+"?accepts_incomplete=true", `{"service_id":"fake-service","plan_id":"fake-maintained-plan","maintenance_info":{"version":"`+version+`"}}`)
+			Expect(status).To(Equal(http.StatusAccepted))
+			Eventually(lastOperation).Should(Equal("succeeded"))
+			Expect(helmDriver.chartVersion(helmDriver.DefaultRelease(instanceID))).To(Equal("1.3.0"))
+
+			instance, _, err := stateStore.GetInstance(instanceID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(instance.MaintenanceInfoVersion).To(Equal(version))
+		})
+	})
+
+	Describe("timeouts", func() {
+		BeforeEach(func() {
+			plans[0].Metadata.Helm.Timeouts = Timeouts{Install: 1}
+		})
+
+		It("fails the operation once the plan timeout is over", func() {
+			helmDriver.block = make(chan struct{})
+
+			status, _ := provision(`{"service_id":"fake-service","plan_id":"fake-plan"}`)
+			Expect(status).To(Equal(http.StatusAccepted))
+
+			var response map[string]interface{}
+			Eventually(func() interface{} {
+				_, response = request("GET", "/v2/service_instances/"+instanceID+"/last_operation", "")
+				return response["state"]
+			}, "5s").Should(Equal("failed"))
+			Expect(response["description"]).To(Equal("Provision timed out after 1s"))
+		})
+	})
+
+	Describe("values templates", func() {
+		releaseValues := func() map[string]interface{} {
+			helmDriver.mutex.Lock()
+			defer helmDriver.mutex.Unlock()
+			return helmDriver.releases[helmDriver.DefaultRelease(instanceID)]
+		}
+
+		BeforeEach(func() {
+			plans = append(plans, ServicePlan{
+				ID:   "fake-templated-plan",
+				Name: "fake-templated-plan",
+				Metadata: &ServicePlanMetadata{
+					Helm: HelmConfig{
+						Chart: "fake-chart",
+						Values: &HelmChartValues{
+							"database": "db-{{ .PlanName }}-{{ .InstanceID }}",
+							"space":    "{{ .Context.SpaceName }}",
+							"auth": map[string]interface{}{
+								"password": "{{ randomPassword 16 }}",
+							},
+						},
+					},
+				},
+			})
+		})
+
+		It("renders the plan values and re-uses the generated ones on update", func() {
+			status, _ := provision(`{"service_id":"fake-service","plan_id":"fake-templated-plan"}`)
+			Expect(status).To(Equal(http.StatusAccepted))
+			Eventually(lastOperation).Should(Equal("succeeded"))
+
+			Expect(releaseValues()).To(HaveKeyWithValue("database", "db-fake-templated-plan-fake-instance-id"))
+			password := releaseValues()["auth"].(map[string]interface{})["password"]
+			Expect(password).To(HaveLen(16))
+
+			status, _ = request("PATCH", "/v2/service_instances/"+instanceID+"?accepts_incomplete=true", `{"service_id":"fake-service","plan_id":"fake-templated-plan","parameters":{"replicas":3}}`)
+			Expect(status).To(Equal(http.StatusAccepted))
+			Eventually(func() interface{} { return releaseValues()["replicas"] }).Should(BeEquivalentTo(3))
+			Expect(releaseValues()["auth"].(map[string]interface{})["password"]).To(Equal(password))
+		})
+
+		It("renders the plan values with the platform context of the update", func() {
+			status, _ := provision(`{"service_id":"fake-service","plan_id":"fake-templated-plan","context":{"platform":"cloudfoundry","space_name":"fake-space"}}`)
+			Expect(status).To(Equal(http.StatusAccepted))
+			Eventually(lastOperation).Should(Equal("succeeded"))
+			Expect(releaseValues()).To(HaveKeyWithValue("space", "fake-space"))
+
+			status, _ = request("PATCH", "/v2/service_instances/"+instanceID+"?accepts_incomplete=true", `{"service_id":"fake-service","plan_id":"fake-templated-plan","context":{"platform":"cloudfoundry","space_name":"renamed-space"}}`)
+			Expect(status).To(Equal(http.StatusAccepted))
+			Eventually(func() interface{} { return releaseValues()["space"] }).Should(Equal("renamed-space"))
+		})
+	})
+
+	Describe("deprovision", func() {
+		It("returns 410 if the instance does not exist", func() {
+			status, _ := request("DELETE", "/v2/service_instances/"+instanceID+"?service_id=fake-service&plan_id=fake-plan&accepts_incomplete=true", "")
+			Expect(status).To(Equal(http.StatusGone))
+		})
+
+		It("returns 410 when polling a deprovision whose release is gone", func() {
+			status, _ := request("GET", "/v2/service_instances/"+instanceID+"/last_operation?operation=deprovision:fake-operation-id", "")
+			Expect(status).To(Equal(http.StatusGone))
+		})
+
+		It("returns 202 and removes the release", func() {
+			provision(`{"service_id":"fake-service","plan_id":"fake-plan"}`)
+			Eventually(lastOperation).Should(Equal("succeeded"))
+
+			status, response := request("DELETE", "/v2/service_instances/"+instanceID+"?service_id=fake-service&plan_id=fake-plan&accepts_incomplete=true", "")
+			Expect(status).To(Equal(http.StatusAccepted))
+			Expect(response["operation"]).To(HavePrefix("deprovision:"))
+			Eventually(func() bool { return helmDriver.hasRelease(helmDriver.DefaultRelease(instanceID)) }).Should(BeFalse())
+		})
+
+		It("removes the instance if its release is already gone", func() {
+			provision(`{"service_id":"fake-service","plan_id":"fake-plan"}`)
+			Eventually(lastOperation).Should(Equal("succeeded"))
+
+			helmDriver.mutex.Lock()
+			delete(helmDriver.releases, helmDriver.DefaultRelease(instanceID))
+			helmDriver.mutex.Unlock()
+
+			status, _ := request("DELETE", "/v2/service_instances/"+instanceID+"?service_id=fake-service&plan_id=fake-plan&accepts_incomplete=true", "")
+			Expect(status).To(Equal(http.StatusAccepted))
+			Eventually(func() bool {
+				_, found, err := stateStore.GetInstance(instanceID)
+				Expect(err).ToNot(HaveOccurred())
+				return found
+			}).Should(BeFalse())
+
+			status, _ = provision(`{"service_id":"fake-service","plan_id":"fake-plan"}`)
+			Expect(status).To(Equal(http.StatusAccepted))
+		})
+	})
+
+	Describe("namespaces", func() {
+		const namespace = "helm-osb-fake-instance-id"
+
+		release := func() helm.Release {
+			return helm.Release{Name: helmDriver.DefaultRelease(instanceID).Name, Namespace: namespace}
+		}
+
+		BeforeEach(func() {
+			plans = append(plans,
+				ServicePlan{
+					ID:   "fake-isolated-plan",
+					Name: "fake-isolated-plan",
+					Metadata: &ServicePlanMetadata{
+						Helm: HelmConfig{
+							Chart:     "fake-chart",
+							Namespace: &NamespaceConfig{Strategy: PerInstanceNamespaceStrategy},
+						},
+					},
+				},
+				ServicePlan{
+					ID:   "fake-platform-plan",
+					Name: "fake-platform-plan",
+					Metadata: &ServicePlanMetadata{
+						Helm: HelmConfig{
+							Chart:     "fake-chart",
+							Namespace: &NamespaceConfig{Strategy: PlatformNamespaceStrategy},
+						},
+					},
+				},
+			)
+		})
+
+		It("installs the release into a namespace owned by the instance", func() {
+			status, _ := provision(`{"service_id":"fake-service","plan_id":"fake-isolated-plan"}`)
+			Expect(status).To(Equal(http.StatusAccepted))
+			Eventually(lastOperation).Should(Equal("succeeded"))
+
+			Expect(kubernetesClient.hasNamespace(namespace)).To(BeTrue())
+			Expect(helmDriver.hasRelease(release())).To(BeTrue())
+			Expect(helmDriver.hasRelease(helmDriver.DefaultRelease(instanceID))).To(BeFalse())
+		})
+
+		It("deletes the namespace on deprovision", func() {
+			provision(`{"service_id":"fake-service","plan_id":"fake-isolated-plan"}`)
+			Eventually(lastOperation).Should(Equal("succeeded"))
+
+			status, _ := request("DELETE", "/v2/service_instances/"+instanceID+"?service_id=fake-service&plan_id=fake-isolated-plan&accepts_incomplete=true", "")
+			Expect(status).To(Equal(http.StatusAccepted))
+			Eventually(func() bool { return kubernetesClient.hasNamespace(namespace) }).Should(BeFalse())
+			Expect(helmDriver.hasRelease(release())).To(BeFalse())
+		})
+
+		It("does not delete namespaces it does not own", func() {
+			kubernetesClient.namespaces[namespace] = kubernetes.Namespace{Metadata: kubernetes.ObjectMeta{Name: namespace}}
+
+			provision(`{"service_id":"fake-service","plan_id":"fake-isolated-plan"}`)
+			Eventually(lastOperation).Should(Equal("succeeded"))
+
+			request("DELETE", "/v2/service_instances/"+instanceID+"?service_id=fake-service&plan_id=fake-isolated-plan&accepts_incomplete=true", "")
+			Eventually(func() bool { return helmDriver.hasRelease(release()) }).Should(BeFalse())
+			Expect(kubernetesClient.hasNamespace(namespace)).To(BeTrue())
+		})
+
+		It("installs the release into the requesting Kubernetes namespace", func() {
+			status, _ := provision(`{"service_id":"fake-service","plan_id":"fake-platform-plan","context":{"platform":"kubernetes","namespace":"consumer-namespace"}}`)
+			Expect(status).To(Equal(http.StatusAccepted))
+			Eventually(lastOperation).Should(Equal("succeeded"))
+
+			Expect(helmDriver.hasRelease(helm.Release{Name: helmDriver.DefaultRelease(instanceID).Name, Namespace: "consumer-namespace"})).To(BeTrue())
+			Expect(kubernetesClient.hasNamespace("consumer-namespace")).To(BeFalse())
+		})
+
+		It("returns 422 if the requesting namespace is unknown", func() {
+			status, response := provision(`{"service_id":"fake-service","plan_id":"fake-platform-plan","context":{"platform":"cloudfoundry"}}`)
+			Expect(status).To(Equal(http.StatusUnprocessableEntity))
+			Expect(response["description"]).To(Equal("The plan requires a Kubernetes platform context with a namespace"))
+		})
+	})
+
+	Describe("bind", func() {
+		const bindBody = `{"service_id":"fake-service","plan_id":"fake-plan","app_guid":"fake-app"}`
+
+		JustBeforeEach(func() {
+			provision(`{"service_id":"fake-service","plan_id":"fake-plan"}`)
+			Eventually(lastOperation).Should(Equal("succeeded"))
+		})
+
+		It("returns 201 for a new binding and 200 for an identical one", func() {
+			status, _ := request("PUT", "/v2/service_instances/"+instanceID+"/service_bindings/"+bindingID, bindBody)
+			Expect(status).To(Equal(http.StatusCreated))
+
+			status, _ = request("PUT", "/v2/service_instances/"+instanceID+"/service_bindings/"+bindingID, bindBody)
+			Expect(status).To(Equal(http.StatusOK))
+		})
+
+		It("returns 409 if the binding exists with different details", func() {
+			status, _ := request("PUT", "/v2/service_instances/"+instanceID+"/service_bindings/"+bindingID, bindBody)
+			Expect(status).To(Equal(http.StatusCreated))
+
+			status, _ = request("PUT", "/v2/service_instances/"+instanceID+"/service_bindings/"+bindingID, `{"service_id":"fake-service","plan_id":"fake-plan","app_guid":"other-app"}`)
+			Expect(status).To(Equal(http.StatusConflict))
+		})
+
+		It("returns 410 when unbinding an unknown binding", func() {
+			status, _ := request("DELETE", "/v2/service_instances/"+instanceID+"/service_bindings/"+bindingID+"?service_id=fake-service&plan_id=fake-plan", "")
+			Expect(status).To(Equal(http.StatusGone))
+		})
+
+		It("returns the credentials and parameters of a binding", func() {
+			status, _ := request("PUT", "/v2/service_instances/"+instanceID+"/service_bindings/"+bindingID, `{"service_id":"fake-service","plan_id":"fake-plan","app_guid":"fake-app","parameters":{"role":"reader"}}`)
+			Expect(status).To(Equal(http.StatusCreated))
+
+			status, response := request("GET", "/v2/service_instances/"+instanceID+"/service_bindings/"+bindingID, "")
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(response).To(Equal(map[string]interface{}{
+				"credentials": map[string]interface{}{"release": helmDriver.DefaultRelease(instanceID).Name},
+				"parameters":  map[string]interface{}{"role": "reader"},
+			}))
+		})
+
+		It("returns 404 when fetching an unknown binding", func() {
+			status, _ := request("GET", "/v2/service_instances/"+instanceID+"/service_bindings/"+bindingID, "")
+			Expect(status).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	Describe("fetch instance", func() {
+		BeforeEach(func() {
+			plans = append(plans, ServicePlan{
+				ID:   "fake-maintained-plan",
+				Name: "fake-maintained-plan",
+				Metadata: &ServicePlanMetadata{
+					Helm: HelmConfig{Chart: "fake-chart", Version: "1.2.0"},
+				},
+			})
+		})
+
+		It("returns the plan and parameters of an instance", func() {
+			status, _ := provision(`{"service_id":"fake-service","plan_id":"fake-maintained-plan","parameters":{"replicas":2}}`)
+			Expect(status).To(Equal(http.StatusAccepted))
+			Eventually(lastOperation).Should(Equal("succeeded"))
+
+			status, response := request("GET", "/v2/service_instances/"+instanceID, "")
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(response).To(Equal(map[string]interface{}{
+				"service_id": "fake-service",
+				"plan_id":    "fake-maintained-plan",
+				"parameters": map[string]interface{}{"replicas": float64(2)},
+				"maintenance_info": map[string]interface{}{
+					"version":     "1.2.0",
+					"description": "Chart `fake-chart` version 1.2.0",
+				},
+			}))
+		})
+
+		It("returns 404 when fetching an unknown instance", func() {
+			status, _ := request("GET", "/v2/service_instances/"+instanceID, "")
+			Expect(status).To(Equal(http.StatusNotFound))
+		})
+
+		Context("when the instance was provisioned before state was recorded", func() {
+			BeforeEach(func() {
+				plans = append(plans, ServicePlan{
+					ID:   "fake-legacy-plan",
+					Name: "fake-legacy-plan",
+					Metadata: &ServicePlanMetadata{
+						Helm: HelmConfig{Chart: "stable/fake-legacy-chart", Values: &HelmChartValues{"persistence": map[string]interface{}{"size": "1Gi"}}},
+					},
+				})
+
+				release := helmDriver.DefaultRelease(instanceID)
+				helmDriver.releases[release] = map[string]interface{}{
+					"persistence": map[string]interface{}{"size": "1Gi"},
+					"replicas":    2,
+				}
+				helmDriver.history[release] = []helm.ReleaseRevision{
+					helm.ReleaseRevision{Revision: 1, Status: helm.StatusDeployed, Chart: "fake-legacy-chart-1.0.0"},
+				}
+			})
+
+			It("returns the plan and parameters from the release", func() {
+				status, response := request("GET", "/v2/service_instances/"+instanceID, "")
+				Expect(status).To(Equal(http.StatusOK))
+				Expect(response).To(Equal(map[string]interface{}{
+					"service_id": "fake-service",
+					"plan_id":    "fake-legacy-plan",
+					"parameters": map[string]interface{}{"replicas": float64(2)},
+				}))
+			})
+		})
+	})
+})
@@ -4,12 +4,17 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"time"
 
 	"code.cloudfoundry.org/lager"
-	"github.com/mitchellh/mapstructure"
 	"github.com/pivotal-cf/brokerapi"
 
 	"github.com/frodenas/helm-osb/helm"
+	"github.com/frodenas/helm-osb/kubernetes"
+	"github.com/frodenas/helm-osb/store"
+	"github.com/frodenas/helm-osb/values"
+	"github.com/frodenas/helm-osb/worker"
 )
 
 const (
@@ -23,19 +28,33 @@ const (
 )
 
 type Broker struct {
-	config     Config
-	helmClient *helm.Client
-	logger     lager.Logger
+	config           Config
+	helmDriver       helm.Driver
+	kubernetesClient KubernetesClient
+	store            store.Store
+	workers          *worker.Pool
+	locks            *instanceLocks
+	logger           lager.Logger
 }
 
-func New(config Config, helmClient *helm.Client, logger lager.Logger) *Broker {
+func New(config Config, helmDriver helm.Driver, kubernetesClient KubernetesClient, store store.Store, logger lager.Logger) *Broker {
 	return &Broker{
-		config:     config,
-		helmClient: helmClient,
-		logger:     logger.Session("broker"),
+		config:           config,
+		helmDriver:       helmDriver,
+		kubernetesClient: kubernetesClient,
+		store:            store,
+		workers:          worker.NewPool(config.MaxConcurrentOperations(), config.MaxQueuedOperations(), logger),
+		locks:            newInstanceLocks(),
+		logger:           logger.Session("broker"),
 	}
 }
 
+// Stop waits for the queued operations to finish. No operations can be
+// started after the broker has been stopped.
+func (b *Broker) Stop() {
+	b.workers.Stop()
+}
+
 func (b *Broker) Services(ctx context.Context) []brokerapi.Service {
 	b.logger.Debug("services-parameters", lager.Data{
 		contextLogKey: ctx,
@@ -61,7 +80,35 @@ func (b *Broker) Services(ctx context.Context) []brokerapi.Service {
 	return services
 }
 
+// Catalog returns the complete OSB catalog, including the fields not
+// supported by brokerapi.Service.
+func (b *Broker) Catalog(ctx context.Context) (map[string]interface{}, error) {
+	b.logger.Debug("catalog-parameters", lager.Data{
+		contextLogKey: ctx,
+	})
+
+	catalog, err := b.config.Catalog.OSBCatalog()
+	if err != nil {
+		b.logger.Error("catalog-error", err)
+		return catalog, err
+	}
+
+	b.logger.Debug("catalog-response", lager.Data{
+		responseLogKey: catalog,
+	})
+
+	return catalog, nil
+}
+
 func (b *Broker) Provision(ctx context.Context, instanceID string, details brokerapi.ProvisionDetails, asyncAllowed bool) (brokerapi.ProvisionedServiceSpec, error) {
+	provisionedServiceSpec, _, err := b.provision(ctx, instanceID, details, asyncAllowed)
+	return provisionedServiceSpec, err
+}
+
+// provision creates the instance unless it already exists. It also reports
+// whether an identical instance was already provisioned, so the API can
+// answer 200 instead of 201.
+func (b *Broker) provision(ctx context.Context, instanceID string, details brokerapi.ProvisionDetails, asyncAllowed bool) (brokerapi.ProvisionedServiceSpec, bool, error) {
 	b.logger.Debug("provision-parameters", lager.Data{
 		contextLogKey:      ctx,
 		instanceIDLogKey:   instanceID,
@@ -72,42 +119,185 @@ func (b *Broker) Provision(ctx context.Context, instanceID string, details broke
 	provisionedServiceSpec := brokerapi.ProvisionedServiceSpec{IsAsync: true}
 
 	if !asyncAllowed {
-		return provisionedServiceSpec, brokerapi.ErrAsyncRequired
+		return provisionedServiceSpec, false, brokerapi.ErrAsyncRequired
 	}
 
 	servicePlan, ok := b.config.Catalog.FindServicePlan(details.ServiceID, details.PlanID)
 	if !ok {
-		return provisionedServiceSpec, fmt.Errorf("Plan `%s` for Service `%s` not found in Catalog", details.PlanID, details.ServiceID)
+		return provisionedServiceSpec, false, fmt.Errorf("Plan `%s` for Service `%s` not found in Catalog", details.PlanID, details.ServiceID)
 	}
 
-	provisionParameters := ProvisionParameters{}
-	if servicePlan.Metadata.Helm.Values != nil {
-		for k, v := range *servicePlan.Metadata.Helm.Values {
-			provisionParameters[k] = v
-		}
+	parameters, err := parseParameters(servicePlan.ProvisionParametersSchema(), details.RawParameters)
+	if err != nil {
+		return provisionedServiceSpec, false, err
+	}
+
+	if err := checkMaintenanceInfo(ctx, servicePlan); err != nil {
+		return provisionedServiceSpec, false, err
 	}
 
+	userParameters := ProvisionParameters{}
 	if b.config.AllowUserProvisionParameters {
-		if err := mapstructure.Decode(details.RawParameters, &provisionParameters); err != nil {
-			return provisionedServiceSpec, fmt.Errorf("Error parsing provision parameters: %s", err)
+		userParameters = parameters
+	}
+
+	if err := checkAllowedParameters(servicePlan.Metadata.Helm, userParameters); err != nil {
+		return provisionedServiceSpec, false, err
+	}
+
+	unlock := b.locks.Lock(instanceID)
+	defer unlock()
+
+	existingInstance, found, err := b.store.GetInstance(instanceID)
+	if err != nil {
+		return provisionedServiceSpec, false, err
+	}
+
+	if found {
+		if existingInstance.ServiceID != details.ServiceID || existingInstance.PlanID != details.PlanID || !sameParameters(existingInstance.Parameters, userParameters) {
+			return provisionedServiceSpec, false, brokerapi.ErrInstanceAlreadyExists
+		}
+
+		operation, found, err := store.LastOperation(b.store, instanceID)
+		if err != nil {
+			return provisionedServiceSpec, false, err
+		}
+
+		if found {
+			switch {
+			case operation.Type == store.DeprovisionOperation:
+				return provisionedServiceSpec, false, brokerapi.ErrInstanceAlreadyExists
+			case operation.Type == store.ProvisionOperation && operation.State == store.OperationFailed:
+				return provisionedServiceSpec, false, brokerapi.ErrInstanceAlreadyExists
+			case operation.Type == store.ProvisionOperation && operation.State == store.OperationInProgress:
+				provisionedServiceSpec.OperationData = NewOperationData(operation).String()
+				return provisionedServiceSpec, true, nil
+			}
 		}
+
+		provisionedServiceSpec.IsAsync = false
+		return provisionedServiceSpec, true, nil
 	}
 
-	err := b.helmClient.InstallRelease(
-		instanceID,
-		servicePlan.Metadata.Helm.Chart,
-		servicePlan.Metadata.Helm.Repository,
-		servicePlan.Metadata.Helm.Version,
-		provisionParameters)
+	if err := b.checkOperationInProgress(instanceID); err != nil {
+		return provisionedServiceSpec, false, err
+	}
+
+	service, _ := b.config.Catalog.FindService(details.ServiceID)
+	platformContext, hasPlatformContext := PlatformContextFrom(ctx)
+	namespaceConfig := b.namespaceConfig(servicePlan)
+	namespace, err := namespaceConfig.Resolve(NamespaceData{
+		InstanceID:       instanceID,
+		OrganizationGUID: details.OrganizationGUID,
+		SpaceGUID:        details.SpaceGUID,
+		ServiceID:        service.ID,
+		ServiceName:      service.Name,
+		PlanID:           servicePlan.ID,
+		PlanName:         servicePlan.Name,
+		Context:          platformContext,
+	}, b.helmDriver.DefaultRelease(instanceID).Namespace)
+	if err != nil {
+		return provisionedServiceSpec, false, brokerapi.NewFailureResponse(err, http.StatusUnprocessableEntity, "invalid-namespace")
+	}
+
+	releaseName, err := b.helmDriver.ReleaseName(instanceID, service.Name, servicePlan.Name)
+	if err != nil {
+		return provisionedServiceSpec, false, err
+	}
+
+	now := time.Now().UTC()
+	instance := store.Instance{
+		ID:               instanceID,
+		ServiceID:        details.ServiceID,
+		PlanID:           details.PlanID,
+		OrganizationGUID: details.OrganizationGUID,
+		SpaceGUID:        details.SpaceGUID,
+		Namespace:        namespace,
+		ReleaseName:      releaseName,
+		Parameters:       userParameters,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+	if hasPlatformContext {
+		instance.Context = &platformContext
+	}
+	release := b.release(instance)
+
+	if err := b.checkReleaseNameCollision(instance); err != nil {
+		return provisionedServiceSpec, false, err
+	}
+
+	// Releases installed before state was recorded cannot be compared.
+	exists, err := b.releaseExists(ctx, release, b.timeouts(servicePlan).StatusTimeout())
+	if err != nil {
+		return provisionedServiceSpec, false, err
+	}
+	if exists {
+		return provisionedServiceSpec, false, brokerapi.NewFailureResponse(
+			fmt.Errorf("Helm release `%s` already exists and is not owned by the instance", release.Name),
+			http.StatusConflict,
+			"release-name-collision",
+		)
+	}
+
+	renderedPlanValues, err := b.renderPlanValues(servicePlan, &instance)
+	if err != nil {
+		return provisionedServiceSpec, false, err
+	}
+
+	chartVersion, err := b.chartVersion(ctx, servicePlan, &instance)
+	if err != nil {
+		return provisionedServiceSpec, false, err
+	}
+
+	provisionParameters := ProvisionParameters(values.Merge(renderedPlanValues, userParameters))
+
+	if err := b.store.SaveInstance(instance); err != nil {
+		return provisionedServiceSpec, false, err
+	}
+
+	timeout := b.timeouts(servicePlan).InstallTimeout()
+	operation, err := b.startOperation(instanceID, store.ProvisionOperation, timeout, func(ctx context.Context) error {
+		if namespaceConfig.IsManaged() {
+			if err := b.createNamespace(instance); err != nil {
+				return err
+			}
+		}
+
+		err := b.helmDriver.InstallRelease(
+			ctx,
+			release,
+			servicePlan.Metadata.Helm.Chart,
+			servicePlan.Metadata.Helm.Repository,
+			chartVersion,
+			provisionParameters)
+		if err != nil {
+			return err
+		}
+
+		if servicePlan.Metadata.Helm.RunTests {
+			return b.testRelease(ctx, release)
+		}
+
+		return nil
+	})
 	if err != nil {
-		return provisionedServiceSpec, err
+		// Nothing was installed: forget the instance so the platform can
+		// retry the provision.
+		if deleteErr := b.store.DeleteInstance(instanceID); deleteErr != nil {
+			b.logger.Error("delete-instance", deleteErr, lager.Data{
+				instanceIDLogKey: instanceID,
+			})
+		}
+		return provisionedServiceSpec, false, err
 	}
+	provisionedServiceSpec.OperationData = NewOperationData(operation).String()
 
 	b.logger.Debug("provision-response", lager.Data{
 		responseLogKey: provisionedServiceSpec,
 	})
 
-	return provisionedServiceSpec, nil
+	return provisionedServiceSpec, false, nil
 }
 
 func (b *Broker) Update(ctx context.Context, instanceID string, details brokerapi.UpdateDetails, asyncAllowed bool) (brokerapi.UpdateServiceSpec, error) {
@@ -124,14 +314,129 @@ func (b *Broker) Update(ctx context.Context, instanceID string, details brokerap
 		return updateServiceSpec, brokerapi.ErrAsyncRequired
 	}
 
+	planID := details.PlanID
+	if planID == "" {
+		planID = details.PreviousValues.PlanID
+	}
+
+	servicePlan, ok := b.config.Catalog.FindServicePlan(details.ServiceID, planID)
+	if !ok {
+		return updateServiceSpec, fmt.Errorf("Plan `%s` for Service `%s` not found in Catalog", planID, details.ServiceID)
+	}
+
+	previousServicePlan := servicePlan
+	if details.PreviousValues.PlanID != "" && details.PreviousValues.PlanID != planID {
+		previousServicePlan, ok = b.config.Catalog.FindServicePlan(details.ServiceID, details.PreviousValues.PlanID)
+		if !ok {
+			return updateServiceSpec, fmt.Errorf("Plan `%s` for Service `%s` not found in Catalog", details.PreviousValues.PlanID, details.ServiceID)
+		}
+
+		service, _ := b.config.Catalog.FindService(details.ServiceID)
+		if !service.IsPlanUpdateable(previousServicePlan) {
+			return updateServiceSpec, brokerapi.ErrPlanChangeNotSupported
+		}
+	}
+
+	parameters, err := parseParameters(servicePlan.UpdateParametersSchema(), details.RawParameters)
+	if err != nil {
+		return updateServiceSpec, err
+	}
+
+	if err := checkMaintenanceInfo(ctx, servicePlan); err != nil {
+		return updateServiceSpec, err
+	}
+
 	updateParameters := UpdateParameters{}
 	if b.config.AllowUserUpdateParameters {
-		if err := mapstructure.Decode(details.RawParameters, &updateParameters); err != nil {
-			return updateServiceSpec, fmt.Errorf("Error parsing update parameters: %s", err)
+		updateParameters = parameters
+	}
+
+	if err := checkAllowedParameters(servicePlan.Metadata.Helm, updateParameters); err != nil {
+		return updateServiceSpec, err
+	}
+
+	unlock := b.locks.Lock(instanceID)
+	defer unlock()
+
+	if err := b.checkOperationInProgress(instanceID); err != nil {
+		return updateServiceSpec, err
+	}
+
+	instance, found, err := b.store.GetInstance(instanceID)
+	if err != nil {
+		return updateServiceSpec, err
+	}
+
+	if !found {
+		// Instances provisioned before state was recorded: recover the user
+		// parameters from the values applied to the release.
+		valuesCtx, cancel := context.WithTimeout(ctx, b.timeouts(previousServicePlan).StatusTimeout())
+		releaseValues, err := b.helmDriver.ReleaseValues(valuesCtx, b.helmDriver.DefaultRelease(instanceID))
+		cancel()
+		if err != nil {
+			return updateServiceSpec, helmFailureResponse(err)
+		}
+
+		now := time.Now().UTC()
+		instance = store.Instance{
+			ID:               instanceID,
+			ServiceID:        details.ServiceID,
+			OrganizationGUID: details.PreviousValues.OrgID,
+			SpaceGUID:        details.PreviousValues.SpaceID,
+			Parameters:       userValues(releaseValues, previousServicePlan.Metadata.Helm.Values),
+			CreatedAt:        now,
 		}
 	}
 
-	// TODO
+	userParameters := values.Merge(instance.Parameters, updateParameters)
+
+	release := b.release(instance)
+
+	// The platform context may change, e.g. when an org or space is renamed,
+	// but the release stays where it was installed. Values templates see the
+	// new context.
+	if platformContext, ok := PlatformContextFrom(ctx); ok {
+		instance.Context = &platformContext
+	}
+
+	renderedPlanValues, err := b.renderPlanValues(servicePlan, &instance)
+	if err != nil {
+		return updateServiceSpec, err
+	}
+
+	upgradeValues := values.Merge(renderedPlanValues, userParameters)
+
+	// Upgrades requested through the maintenance info also move the chart
+	// version pinned by a version constraint.
+	if maintenanceInfo, ok := MaintenanceInfoFrom(ctx); ok && maintenanceInfo.Version != instance.MaintenanceInfoVersion {
+		instance.ChartVersion = ""
+	}
+
+	chartVersion, err := b.chartVersion(ctx, servicePlan, &instance)
+	if err != nil {
+		return updateServiceSpec, err
+	}
+
+	timeout := b.timeouts(servicePlan).UpgradeTimeout()
+	operation, err := b.startOperation(instanceID, store.UpdateOperation, timeout, func(ctx context.Context) error {
+		upgraded, err := b.upgradeRelease(ctx, instanceID, release, servicePlan, chartVersion, upgradeValues, timeout)
+		if !upgraded {
+			return err
+		}
+
+		instance.PlanID = servicePlan.ID
+		instance.Parameters = userParameters
+		instance.UpdatedAt = time.Now().UTC()
+		if saveErr := b.store.SaveInstance(instance); saveErr != nil {
+			return saveErr
+		}
+
+		return err
+	})
+	if err != nil {
+		return updateServiceSpec, err
+	}
+	updateServiceSpec.OperationData = NewOperationData(operation).String()
 
 	b.logger.Debug("update-response", lager.Data{
 		responseLogKey: updateServiceSpec,
@@ -154,9 +459,68 @@ func (b *Broker) Deprovision(ctx context.Context, instanceID string, details bro
 		return deprovisionServiceSpec, brokerapi.ErrAsyncRequired
 	}
 
-	if err := b.helmClient.DeleteRelease(instanceID); err != nil {
+	servicePlan, _ := b.config.Catalog.FindServicePlan(details.ServiceID, details.PlanID)
+
+	unlock := b.locks.Lock(instanceID)
+	defer unlock()
+
+	instance, found, err := b.store.GetInstance(instanceID)
+	if err != nil {
+		return deprovisionServiceSpec, err
+	}
+
+	release := b.helmDriver.DefaultRelease(instanceID)
+	if found {
+		release = b.release(instance)
+
+		operation, found, err := store.LastOperation(b.store, instanceID)
+		if err != nil {
+			return deprovisionServiceSpec, err
+		}
+
+		if found && operation.Type == store.DeprovisionOperation && operation.State == store.OperationInProgress {
+			deprovisionServiceSpec.OperationData = NewOperationData(operation).String()
+			return deprovisionServiceSpec, nil
+		}
+	} else {
+		exists, err := b.releaseExists(ctx, release, b.timeouts(servicePlan).StatusTimeout())
+		if err != nil {
+			return deprovisionServiceSpec, err
+		}
+		if !exists {
+			return deprovisionServiceSpec, brokerapi.ErrInstanceDoesNotExist
+		}
+	}
+
+	if err := b.checkOperationInProgress(instanceID); err != nil {
+		return deprovisionServiceSpec, err
+	}
+
+	timeout := b.timeouts(servicePlan).DeleteTimeout()
+	operation, err := b.startOperation(instanceID, store.DeprovisionOperation, timeout, func(ctx context.Context) error {
+		// A release removed out of band leaves the instance to clean up.
+		if err := b.helmDriver.DeleteRelease(ctx, release); err != nil {
+			if helm.Reason(err) != helm.ReasonReleaseNotFound {
+				return err
+			}
+			b.logger.Info("deprovision-release-not-found", lager.Data{
+				instanceIDLogKey: instanceID,
+				"release":        release.Name,
+			})
+		}
+
+		if found {
+			if err := b.deleteNamespace(instance); err != nil {
+				return err
+			}
+		}
+
+		return b.store.DeleteInstance(instanceID)
+	})
+	if err != nil {
 		return deprovisionServiceSpec, err
 	}
+	deprovisionServiceSpec.OperationData = NewOperationData(operation).String()
 
 	b.logger.Debug("deprovision-response", lager.Data{
 		responseLogKey: deprovisionServiceSpec,
@@ -166,6 +530,14 @@ func (b *Broker) Deprovision(ctx context.Context, instanceID string, details bro
 }
 
 func (b *Broker) Bind(ctx context.Context, instanceID, bindingID string, details brokerapi.BindDetails) (brokerapi.Binding, error) {
+	binding, _, err := b.bind(ctx, instanceID, bindingID, details)
+	return binding, err
+}
+
+// bind creates the binding unless it already exists. It also reports whether
+// an identical binding already existed, so the API can answer 200 instead of
+// 201.
+func (b *Broker) bind(ctx context.Context, instanceID, bindingID string, details brokerapi.BindDetails) (brokerapi.Binding, bool, error) {
 	b.logger.Debug("bind-parameters", lager.Data{
 		contextLogKey:    ctx,
 		instanceIDLogKey: instanceID,
@@ -175,20 +547,99 @@ func (b *Broker) Bind(ctx context.Context, instanceID, bindingID string, details
 
 	binding := brokerapi.Binding{}
 
+	servicePlan, ok := b.config.Catalog.FindServicePlan(details.ServiceID, details.PlanID)
+	if !ok {
+		return binding, false, fmt.Errorf("Plan `%s` for Service `%s` not found in Catalog", details.PlanID, details.ServiceID)
+	}
+
+	parameters, err := parseParameters(servicePlan.BindParametersSchema(), details.RawParameters)
+	if err != nil {
+		return binding, false, err
+	}
+
 	bindParameters := BindParameters{}
 	if b.config.AllowUserBindParameters {
-		if err := mapstructure.Decode(details.RawParameters, &bindParameters); err != nil {
-			return binding, fmt.Errorf("Error parsing bind parameters: %s", err)
+		bindParameters = parameters
+	}
+
+	appGUID := details.AppGUID
+	if details.BindResource != nil && details.BindResource.AppGuid != "" {
+		appGUID = details.BindResource.AppGuid
+	}
+
+	existingBinding, alreadyBound, err := b.store.GetBinding(instanceID, bindingID)
+	if err != nil {
+		return binding, false, err
+	}
+
+	if alreadyBound {
+		if existingBinding.ServiceID != details.ServiceID || existingBinding.PlanID != details.PlanID || existingBinding.AppGUID != appGUID || !sameParameters(existingBinding.Parameters, bindParameters) {
+			return binding, false, brokerapi.ErrBindingAlreadyExists
 		}
 	}
 
-	// TODO
+	credentials, err := b.bindingCredentials(ctx, servicePlan, instanceID, bindingID)
+	if err != nil {
+		return binding, false, err
+	}
+	binding.Credentials = credentials
+
+	if !alreadyBound {
+		err = b.store.SaveBinding(store.Binding{
+			ID:         bindingID,
+			InstanceID: instanceID,
+			ServiceID:  details.ServiceID,
+			PlanID:     details.PlanID,
+			AppGUID:    appGUID,
+			Parameters: bindParameters,
+			CreatedAt:  time.Now().UTC(),
+		})
+		if err != nil {
+			return binding, false, err
+		}
+	}
 
 	b.logger.Debug("bind-response", lager.Data{
 		responseLogKey: binding,
 	})
 
-	return binding, nil
+	return binding, alreadyBound, nil
+}
+
+// bindingCredentials resolves the plan credentials of a binding against the
+// live manifest of the instance release.
+func (b *Broker) bindingCredentials(ctx context.Context, servicePlan ServicePlan, instanceID string, bindingID string) (map[string]interface{}, error) {
+	manifestCtx, cancel := context.WithTimeout(ctx, b.timeouts(servicePlan).StatusTimeout())
+	defer cancel()
+
+	instance, found, err := b.store.GetInstance(instanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	release := b.helmDriver.DefaultRelease(instanceID)
+	platformContext := store.PlatformContext{}
+	if found {
+		release = b.release(instance)
+		if instance.Context != nil {
+			platformContext = *instance.Context
+		}
+	}
+
+	manifest, err := b.helmDriver.ReleaseManifest(manifestCtx, release)
+	if err != nil {
+		return nil, helmFailureResponse(err)
+	}
+
+	credentialsData := CredentialsData{
+		InstanceID:  instanceID,
+		BindingID:   bindingID,
+		ReleaseName: release.Name,
+		Namespace:   release.Namespace,
+		Context:     platformContext,
+	}
+
+	return servicePlan.Metadata.Credentials.Resolve(credentialsData, manifest)
 }
 
 func (b *Broker) Unbind(ctx context.Context, instanceID, bindingID string, details brokerapi.UnbindDetails) error {
@@ -199,9 +650,15 @@ func (b *Broker) Unbind(ctx context.Context, instanceID, bindingID string, detai
 		detailsLogKey:    details,
 	})
 
-	// TODO
+	_, found, err := b.store.GetBinding(instanceID, bindingID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return brokerapi.ErrBindingDoesNotExist
+	}
 
-	return nil
+	return b.store.DeleteBinding(instanceID, bindingID)
 }
 
 func (b *Broker) LastOperation(ctx context.Context, instanceID string, operationData string) (brokerapi.LastOperation, error) {
@@ -213,17 +670,80 @@ func (b *Broker) LastOperation(ctx context.Context, instanceID string, operation
 
 	lastOperation := brokerapi.LastOperation{State: brokerapi.Failed}
 
-	status, description, err := b.helmClient.ReleaseStatus(instanceID)
+	operation, found, err := b.findOperation(instanceID, operationData)
+	if err != nil {
+		return lastOperation, err
+	}
+
+	if found {
+		switch operation.State {
+		case store.OperationInProgress:
+			if b.workers.Pending(operation.ID) {
+				lastOperation.State = brokerapi.InProgress
+				lastOperation.Description = operation.Description
+				return lastOperation, nil
+			}
+		case store.OperationFailed:
+			lastOperation.Description = operation.Description
+			return lastOperation, nil
+		case store.OperationSucceeded:
+			if operation.Type == store.DeprovisionOperation {
+				lastOperation.State = brokerapi.Succeeded
+				return lastOperation, nil
+			}
+		}
+	}
+
+	instance, instanceFound, err := b.store.GetInstance(instanceID)
 	if err != nil {
 		return lastOperation, err
 	}
 
-	switch status {
-	case "SUCCEEDED":
-		lastOperation.State = brokerapi.Succeeded
-		lastOperation.Description = description
-	case "INPROGRESS":
-		lastOperation.State = brokerapi.InProgress
+	release := b.helmDriver.DefaultRelease(instanceID)
+	servicePlan := ServicePlan{}
+	if instanceFound {
+		release = b.release(instance)
+		servicePlan, _ = b.config.Catalog.FindServicePlan(instance.ServiceID, instance.PlanID)
+	}
+
+	statusCtx, cancel := context.WithTimeout(ctx, b.timeouts(servicePlan).StatusTimeout())
+	defer cancel()
+
+	releaseStatus, err := b.helmDriver.ReleaseStatus(statusCtx, release)
+	switch {
+	case err == nil:
+		lastOperation.State, lastOperation.Description = releaseOperationState(operation.Type, releaseStatus)
+		if lastOperation.State == brokerapi.Succeeded && operation.Type != store.DeprovisionOperation && instanceFound {
+			lastOperation, err = b.readinessOperationState(statusCtx, instance, release, operation, found, lastOperation)
+			if err != nil {
+				return lastOperation, err
+			}
+		}
+	case helm.Reason(err) == helm.ReasonReleaseNotFound:
+		if operation.Type == store.DeprovisionOperation {
+			lastOperation.State, lastOperation.Description = brokerapi.Succeeded, "Release uninstalled"
+		} else {
+			lastOperation.Description = "Release not found"
+		}
+	default:
+		return lastOperation, helmFailureResponse(err)
+	}
+
+	// Operations that were queued when the broker was restarted are never
+	// completed by a worker, so settle them with the release status.
+	if found && operation.State == store.OperationInProgress {
+		switch lastOperation.State {
+		case brokerapi.Succeeded:
+			b.finishOperation(operation, store.OperationSucceeded, lastOperation.Description)
+		case brokerapi.Failed:
+			b.finishOperation(operation, store.OperationFailed, lastOperation.Description)
+		}
+	}
+
+	// Once a release is gone there is nothing left to poll: the spec asks
+	// for 410 Gone, which platforms treat as a successful deprovision.
+	if operation.Type == store.DeprovisionOperation && helm.Reason(err) == helm.ReasonReleaseNotFound {
+		return lastOperation, brokerapi.ErrInstanceDoesNotExist
 	}
 
 	b.logger.Debug("last-operation-response", lager.Data{
@@ -232,3 +752,540 @@ func (b *Broker) LastOperation(ctx context.Context, instanceID string, operation
 
 	return lastOperation, nil
 }
+
+// readinessOperationState keeps a release operation in progress until the
+// release workloads are ready, for plans that wait for them. Operations whose
+// workloads are not ready within the operation timeout fail.
+func (b *Broker) readinessOperationState(ctx context.Context, instance store.Instance, release helm.Release, operation store.Operation, operationFound bool, lastOperation brokerapi.LastOperation) (brokerapi.LastOperation, error) {
+	servicePlan, ok := b.config.Catalog.FindServicePlan(instance.ServiceID, instance.PlanID)
+	if !ok || !servicePlan.Metadata.Helm.WaitForReady {
+		return lastOperation, nil
+	}
+
+	manifest, err := b.helmDriver.ReleaseManifest(ctx, release)
+	if err != nil {
+		return lastOperation, helmFailureResponse(err)
+	}
+
+	readiness, err := releaseReadiness(b.kubernetesClient, manifest)
+	if err != nil {
+		return lastOperation, err
+	}
+
+	if readiness.Ready() {
+		return lastOperation, nil
+	}
+
+	timeout := b.timeouts(servicePlan).InstallTimeout()
+	if operation.Type == store.UpdateOperation {
+		timeout = b.timeouts(servicePlan).UpgradeTimeout()
+	}
+
+	if operationFound && operation.State == store.OperationSucceeded && time.Since(operation.UpdatedAt) > timeout {
+		return brokerapi.LastOperation{
+			State:       brokerapi.Failed,
+			Description: fmt.Sprintf("Workloads not ready after %s: %s", timeout, readiness),
+		}, nil
+	}
+
+	return brokerapi.LastOperation{
+		State:       brokerapi.InProgress,
+		Description: fmt.Sprintf("Waiting for workloads: %s", readiness),
+	}, nil
+}
+
+// testRelease runs the release tests once its workloads are ready, as chart
+// tests usually exercise the services they deploy.
+func (b *Broker) testRelease(ctx context.Context, release helm.Release) error {
+	for {
+		manifest, err := b.helmDriver.ReleaseManifest(ctx, release)
+		if err != nil {
+			return err
+		}
+
+		readiness, err := releaseReadiness(b.kubernetesClient, manifest)
+		if err != nil {
+			return err
+		}
+
+		if readiness.Ready() {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("Workloads not ready to run tests: %s", readiness)
+		case <-time.After(readinessPollInterval):
+		}
+	}
+
+	return b.helmDriver.TestRelease(ctx, release)
+}
+
+// release returns the Helm release of a recorded instance.
+func (b *Broker) release(instance store.Instance) helm.Release {
+	release := b.helmDriver.DefaultRelease(instance.ID)
+	if instance.ReleaseName != "" {
+		release.Name = instance.ReleaseName
+	}
+	if instance.Namespace != "" {
+		release.Namespace = instance.Namespace
+	}
+
+	return release
+}
+
+// renderPlanValues renders the plan values templates for an instance. Values
+// generated on the first rendering are kept in the instance, so they are
+// re-used on upgrades.
+func (b *Broker) renderPlanValues(servicePlan ServicePlan, instance *store.Instance) (map[string]interface{}, error) {
+	service, _ := b.config.Catalog.FindService(instance.ServiceID)
+	release := b.release(*instance)
+
+	data := ValuesData{
+		InstanceID:       instance.ID,
+		ReleaseName:      release.Name,
+		Namespace:        release.Namespace,
+		OrganizationGUID: instance.OrganizationGUID,
+		SpaceGUID:        instance.SpaceGUID,
+		ServiceID:        service.ID,
+		ServiceName:      service.Name,
+		PlanID:           servicePlan.ID,
+		PlanName:         servicePlan.Name,
+	}
+	if instance.Context != nil {
+		data.Context = *instance.Context
+	}
+
+	generated := map[string]string{}
+	for key, value := range instance.GeneratedValues {
+		generated[key] = value
+	}
+
+	rendered, err := renderValues(planValues(servicePlan), data, generated)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(generated) > 0 {
+		instance.GeneratedValues = generated
+	}
+
+	return rendered, nil
+}
+
+// chartVersion returns the chart version to deploy for an instance and
+// records it in the instance, along with the plan maintenance info version.
+// Version constraints are resolved against the repository index and the
+// resolved version is pinned: it only moves when the plan constraint changes,
+// and the instance keeps its maintenance info version meanwhile.
+func (b *Broker) chartVersion(ctx context.Context, servicePlan ServicePlan, instance *store.Instance) (string, error) {
+	helmConfig := servicePlan.Metadata.Helm
+	if !helm.IsVersionConstraint(helmConfig.Version) {
+		instance.ChartVersion, instance.ChartConstraint = helmConfig.Version, ""
+		instance.MaintenanceInfoVersion = servicePlan.MaintenanceInfoVersion()
+		return helmConfig.Version, nil
+	}
+
+	if instance.ChartVersion != "" && instance.PlanID == servicePlan.ID && instance.ChartConstraint == helmConfig.Version {
+		return instance.ChartVersion, nil
+	}
+
+	indexCtx, cancel := context.WithTimeout(ctx, b.timeouts(servicePlan).StatusTimeout())
+	defer cancel()
+
+	index, err := helm.FetchRepositoryIndex(indexCtx, helmConfig.Repository)
+	if err != nil {
+		return "", helmFailureResponse(err)
+	}
+
+	version, err := index.ResolveVersion(helmConfig.Chart, helmConfig.Version)
+	if err != nil {
+		return "", helmFailureResponse(err)
+	}
+
+	instance.ChartVersion, instance.ChartConstraint = version, helmConfig.Version
+	instance.MaintenanceInfoVersion = servicePlan.MaintenanceInfoVersion()
+	return version, nil
+}
+
+// checkReleaseNameCollision returns an error if the release name of an
+// instance is already used by another instance. Names are compared regardless
+// of the namespace, as Helm 2 release names are cluster-wide.
+func (b *Broker) checkReleaseNameCollision(instance store.Instance) error {
+	instances, err := b.store.ListInstances()
+	if err != nil {
+		return err
+	}
+
+	for _, other := range instances {
+		if other.ID != instance.ID && b.release(other).Name == instance.ReleaseName {
+			return brokerapi.NewFailureResponse(
+				fmt.Errorf("Helm release `%s` is already used by instance `%s`", instance.ReleaseName, other.ID),
+				http.StatusConflict,
+				"release-name-collision",
+			)
+		}
+	}
+
+	return nil
+}
+
+// releaseExists reports whether Helm has a release.
+func (b *Broker) releaseExists(ctx context.Context, release helm.Release, timeout time.Duration) (bool, error) {
+	statusCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if _, err := b.helmDriver.ReleaseStatus(statusCtx, release); err != nil {
+		if helm.Reason(err) == helm.ReasonReleaseNotFound {
+			return false, nil
+		}
+		return false, helmFailureResponse(err)
+	}
+
+	return true, nil
+}
+
+// findOperation returns the operation identified by operationData, or the
+// last operation of the instance for platforms that do not send it back.
+// Operations that are not recorded are returned with their type only.
+func (b *Broker) findOperation(instanceID string, operationData string) (store.Operation, bool, error) {
+	if operationData == "" {
+		return store.LastOperation(b.store, instanceID)
+	}
+
+	data, err := ParseOperationData(operationData)
+	if err != nil {
+		return store.Operation{}, false, brokerapi.NewFailureResponse(err, http.StatusBadRequest, "invalid-operation-data")
+	}
+
+	operation, found, err := b.store.GetOperation(instanceID, data.ID)
+	if err != nil || found {
+		return operation, found, err
+	}
+
+	return store.Operation{ID: data.ID, InstanceID: instanceID, Type: data.Type}, false, nil
+}
+
+// namespaceConfig returns the namespace strategy for a plan, falling back to
+// the broker one.
+func (b *Broker) namespaceConfig(servicePlan ServicePlan) NamespaceConfig {
+	if servicePlan.Metadata == nil || servicePlan.Metadata.Helm.Namespace == nil {
+		return b.config.Namespace
+	}
+
+	return *servicePlan.Metadata.Helm.Namespace
+}
+
+// createNamespace creates the namespace of an instance unless it already
+// exists. Namespaces created by the broker are labelled as managed by it.
+func (b *Broker) createNamespace(instance store.Instance) error {
+	_, found, err := b.kubernetesClient.GetNamespace(instance.Namespace)
+	if err != nil {
+		return err
+	}
+	if found {
+		return nil
+	}
+
+	namespace := kubernetes.Namespace{
+		Metadata: kubernetes.ObjectMeta{
+			Name: instance.Namespace,
+			Labels: map[string]string{
+				namespaceManagedByLabel:  namespaceManagedByValue,
+				namespaceInstanceIDLabel: instance.ID,
+			},
+		},
+	}
+	if err := b.kubernetesClient.CreateNamespace(namespace); err != nil {
+		// Another instance sharing the namespace may have created it meanwhile.
+		if _, found, getErr := b.kubernetesClient.GetNamespace(instance.Namespace); getErr == nil && found {
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
+
+// deleteNamespace deletes the namespace of an instance when the broker owns
+// it and no other instance is deployed into it.
+func (b *Broker) deleteNamespace(instance store.Instance) error {
+	if instance.Namespace == "" || !b.config.ManagesNamespaces() {
+		return nil
+	}
+
+	namespace, found, err := b.kubernetesClient.GetNamespace(instance.Namespace)
+	if err != nil {
+		return err
+	}
+	if !found || namespace.Metadata.Labels[namespaceManagedByLabel] != namespaceManagedByValue {
+		return nil
+	}
+
+	instances, err := b.store.ListInstances()
+	if err != nil {
+		return err
+	}
+	for _, other := range instances {
+		if other.ID != instance.ID && other.Namespace == instance.Namespace {
+			return nil
+		}
+	}
+
+	return b.kubernetesClient.DeleteNamespace(instance.Namespace)
+}
+
+// upgradeRelease upgrades a release and runs the plan tests. When the plan
+// asks for it, failures restore the previously deployed revision. It reports
+// whether the release was left upgraded, which it is when tests fail and the
+// upgrade is not rolled back.
+func (b *Broker) upgradeRelease(ctx context.Context, instanceID string, release helm.Release, servicePlan ServicePlan, chartVersion string, upgradeValues map[string]interface{}, timeout time.Duration) (bool, error) {
+	rollbackOnFailure := servicePlan.Metadata.Helm.RollbackOnFailure
+	rollbackRevision := 0
+	if rollbackOnFailure {
+		revision, err := b.lastDeployedRevision(ctx, release)
+		if err != nil {
+			return false, err
+		}
+		rollbackRevision = revision
+	}
+
+	upgradeErr := b.helmDriver.UpgradeRelease(
+		ctx,
+		release,
+		servicePlan.Metadata.Helm.Chart,
+		servicePlan.Metadata.Helm.Repository,
+		chartVersion,
+		upgradeValues)
+
+	var testErr error
+	if upgradeErr == nil && servicePlan.Metadata.Helm.RunTests {
+		testErr = b.testRelease(ctx, release)
+	}
+
+	if rollbackOnFailure {
+		if upgradeErr != nil {
+			return false, b.rollbackRelease(instanceID, release, rollbackRevision, timeout, upgradeErr)
+		}
+		if testErr != nil {
+			return false, b.rollbackRelease(instanceID, release, rollbackRevision, timeout, testErr)
+		}
+	}
+	if upgradeErr != nil {
+		return false, upgradeErr
+	}
+
+	return true, testErr
+}
+
+// lastDeployedRevision returns the last revision of a release that was
+// deployed successfully, according to the release history, or 0 if there is
+// none.
+func (b *Broker) lastDeployedRevision(ctx context.Context, release helm.Release) (int, error) {
+	history, err := b.helmDriver.ReleaseHistory(ctx, release)
+	if err != nil {
+		return 0, err
+	}
+
+	revision := helm.LastDeployedRevision(history)
+	if revision == 0 {
+		b.logger.Info("no-deployed-revision", lager.Data{
+			"release": release.Name,
+		})
+	}
+
+	return revision, nil
+}
+
+// rollbackRelease restores a release to the given revision after a failed
+// update, recording the outcome as a rollback operation. It runs with its own
+// timeout, as the update may have failed because it timed out. Without a
+// revision to restore, the failure is reported as is.
+func (b *Broker) rollbackRelease(instanceID string, release helm.Release, revision int, timeout time.Duration, cause error) error {
+	rollbackErr := &rollbackError{cause: cause, revision: revision}
+	if revision == 0 {
+		return rollbackErr
+	}
+
+	operation, err := store.NewOperation(instanceID, store.RollbackOperation)
+	if err != nil {
+		rollbackErr.rollbackErr = err
+		return rollbackErr
+	}
+	b.updateOperation(operation, fmt.Sprintf("Rolling back to revision %d", revision))
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := b.helmDriver.RollbackRelease(ctx, release, revision); err != nil {
+		rollbackErr.rollbackErr = err
+		b.finishOperation(operation, store.OperationFailed, err.Error())
+		return rollbackErr
+	}
+
+	b.finishOperation(operation, store.OperationSucceeded, fmt.Sprintf("Restored revision %d", revision))
+	return rollbackErr
+}
+
+// timeouts returns the Helm command timeouts for a plan, falling back to the
+// broker ones.
+func (b *Broker) timeouts(servicePlan ServicePlan) Timeouts {
+	if servicePlan.Metadata == nil {
+		return b.config.Timeouts
+	}
+
+	return b.config.Timeouts.Merge(servicePlan.Metadata.Helm.Timeouts)
+}
+
+// releaseOperationState maps a Helm release state to the state and
+// description of the operation of the given type that produced it.
+func releaseOperationState(operationType store.OperationType, releaseStatus helm.ReleaseStatus) (brokerapi.LastOperationState, string) {
+	if operationType == store.DeprovisionOperation {
+		switch releaseStatus.Status {
+		case helm.StatusUninstalled:
+			return brokerapi.Succeeded, "Release uninstalled"
+		case helm.StatusUninstalling:
+			return brokerapi.InProgress, "Release uninstall in progress"
+		default:
+			return brokerapi.Failed, releaseFailureDescription(fmt.Sprintf("Release not uninstalled, status `%s`", releaseStatus.Status), releaseStatus)
+		}
+	}
+
+	switch releaseStatus.Status {
+	case helm.StatusDeployed:
+		return brokerapi.Succeeded, fmt.Sprintf("Last deployed: %s", releaseStatus.LastDeployed.Format(time.RFC1123))
+	case helm.StatusPendingInstall:
+		return brokerapi.InProgress, "Release install in progress"
+	case helm.StatusPendingUpgrade:
+		return brokerapi.InProgress, "Release upgrade in progress"
+	case helm.StatusPendingRollback:
+		return brokerapi.InProgress, "Release rollback in progress"
+	case helm.StatusUninstalled:
+		return brokerapi.Failed, releaseFailureDescription("Release uninstalled", releaseStatus)
+	case helm.StatusUninstalling:
+		return brokerapi.Failed, releaseFailureDescription("Release being uninstalled", releaseStatus)
+	case helm.StatusFailed:
+		return brokerapi.Failed, releaseFailureDescription("Release failed", releaseStatus)
+	case helm.StatusSuperseded:
+		return brokerapi.Failed, releaseFailureDescription("Release superseded by a newer revision", releaseStatus)
+	case helm.StatusUnknown:
+		return brokerapi.Failed, releaseFailureDescription("Release status unknown", releaseStatus)
+	default:
+		return brokerapi.Failed, releaseFailureDescription(fmt.Sprintf("Unexpected release status `%s`", releaseStatus.Status), releaseStatus)
+	}
+}
+
+func releaseFailureDescription(reason string, releaseStatus helm.ReleaseStatus) string {
+	if releaseStatus.Description == "" {
+		return reason
+	}
+
+	return fmt.Sprintf("%s: %s", reason, releaseStatus.Description)
+}
+
+// checkOperationInProgress returns a concurrency error while an operation on
+// the instance is queued or running. Callers hold the instance lock until
+// they have started their own operation.
+func (b *Broker) checkOperationInProgress(instanceID string) error {
+	operationID, pending := b.workers.PendingOperation(instanceID)
+	if !pending {
+		return nil
+	}
+
+	operation, found, err := b.store.GetOperation(instanceID, operationID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		operation = store.Operation{ID: operationID, InstanceID: instanceID}
+	}
+
+	return concurrencyError(operation)
+}
+
+// operationNames holds how operation types are named in operation
+// descriptions.
+var operationNames = map[store.OperationType]string{
+	store.ProvisionOperation:   "Provision",
+	store.UpdateOperation:      "Update",
+	store.DeprovisionOperation: "Deprovision",
+	store.RollbackOperation:    "Rollback",
+	store.UpgradeOperation:     "Upgrade",
+}
+
+// startOperation records a new operation for an instance and queues run on
+// the worker pool. Once a worker picks it up, run is given timeout to
+// complete. The operation is settled with the outcome of run.
+func (b *Broker) startOperation(instanceID string, operationType store.OperationType, timeout time.Duration, run func(ctx context.Context) error) (store.Operation, error) {
+	operation, err := store.NewOperation(instanceID, operationType)
+	if err != nil {
+		return operation, err
+	}
+
+	operationName := operationNames[operationType]
+	operation.Description = fmt.Sprintf("%s queued", operationName)
+	if err := b.store.SaveOperation(operation); err != nil {
+		return operation, err
+	}
+
+	task := worker.Task{
+		OperationID: operation.ID,
+		InstanceID:  instanceID,
+		Run: func() {
+			b.updateOperation(operation, fmt.Sprintf("%s in progress", operationName))
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			// Settle the operation before the worker pool recovers a panic,
+			// so that the instance is not left busy.
+			defer func() {
+				if r := recover(); r != nil {
+					b.finishOperation(operation, store.OperationFailed, fmt.Sprintf("%s failed", operationName))
+					panic(r)
+				}
+			}()
+
+			if err := run(ctx); err != nil {
+				b.logger.Error("operation-failed", err, lager.Data{
+					instanceIDLogKey: instanceID,
+				})
+				description := err.Error()
+				if _, rolledBack := err.(*rollbackError); !rolledBack && ctx.Err() == context.DeadlineExceeded {
+					description = fmt.Sprintf("%s timed out after %s", operationName, timeout)
+				}
+				b.finishOperation(operation, store.OperationFailed, description)
+				return
+			}
+
+			b.finishOperation(operation, store.OperationSucceeded, "")
+		},
+	}
+
+	if err := b.workers.Submit(task); err != nil {
+		b.finishOperation(operation, store.OperationFailed, err.Error())
+		return operation, brokerapi.NewFailureResponse(err, http.StatusServiceUnavailable, "operation-queue-full")
+	}
+
+	return operation, nil
+}
+
+func (b *Broker) updateOperation(operation store.Operation, description string) {
+	operation.Description = description
+	operation.UpdatedAt = time.Now().UTC()
+
+	if err := b.store.SaveOperation(operation); err != nil {
+		b.logger.Error("save-operation", err)
+	}
+}
+
+func (b *Broker) finishOperation(operation store.Operation, state store.OperationState, description string) {
+	operation.State = state
+	operation.Description = description
+	operation.UpdatedAt = time.Now().UTC()
+
+	if err := b.store.SaveOperation(operation); err != nil {
+		b.logger.Error("save-operation", err)
+	}
+}
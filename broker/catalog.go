@@ -1,25 +1,39 @@
 package broker
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"path"
+	"strings"
+
+	"github.com/Masterminds/semver"
+
+	"github.com/frodenas/helm-osb/helm"
+	"github.com/frodenas/helm-osb/schema"
+	"github.com/frodenas/helm-osb/values"
 )
 
+var internalPlanMetadataKeys = []string{"helm", "credentials"}
+
 type Catalog struct {
 	Services []Service `json:"services,omitempty"`
 }
 
 type Service struct {
-	ID              string                  `json:"id"`
-	Name            string                  `json:"name"`
-	Description     string                  `json:"description"`
-	Tags            []string                `json:"tags,omitempty"`
-	Requires        []string                `json:"requires,omitempty"`
-	Bindable        bool                    `json:"bindable"`
-	Metadata        *ServiceMetadata        `json:"metadata,omitempty"`
-	DashboardClient *ServiceDashboardClient `json:"dashboard_client,omitempty"`
-	PlanUpdateable  bool                    `json:"plan_updateable,omitempty"`
-	Plans           []ServicePlan           `json:"plans"`
+	ID                   string                  `json:"id"`
+	Name                 string                  `json:"name"`
+	Description          string                  `json:"description"`
+	Tags                 []string                `json:"tags,omitempty"`
+	Requires             []string                `json:"requires,omitempty"`
+	Bindable             bool                    `json:"bindable"`
+	InstancesRetrievable bool                    `json:"instances_retrievable,omitempty"`
+	BindingsRetrievable  bool                    `json:"bindings_retrievable,omitempty"`
+	Metadata             *ServiceMetadata        `json:"metadata,omitempty"`
+	DashboardClient      *ServiceDashboardClient `json:"dashboard_client,omitempty"`
+	PlanUpdateable       bool                    `json:"plan_updateable,omitempty"`
+	Plans                []ServicePlan           `json:"plans"`
 }
 
 type ServiceMetadata struct {
@@ -38,13 +52,15 @@ type ServiceDashboardClient struct {
 }
 
 type ServicePlan struct {
-	ID          string               `json:"id"`
-	Name        string               `json:"name"`
-	Description string               `json:"description"`
-	Metadata    *ServicePlanMetadata `json:"metadata,omitempty"`
-	Free        bool                 `json:"free,omitempty"`
-	Bindable    bool                 `json:"bindable,omitempty"`
-	Schemas     *ServicePlanSchemas  `json:"schemas,omitempty"`
+	ID              string                      `json:"id"`
+	Name            string                      `json:"name"`
+	Description     string                      `json:"description"`
+	Metadata        *ServicePlanMetadata        `json:"metadata,omitempty"`
+	Free            bool                        `json:"free,omitempty"`
+	Bindable        bool                        `json:"bindable,omitempty"`
+	PlanUpdateable  *bool                       `json:"plan_updateable,omitempty"`
+	MaintenanceInfo *ServicePlanMaintenanceInfo `json:"maintenance_info,omitempty"`
+	Schemas         *ServicePlanSchemas         `json:"schemas,omitempty"`
 }
 
 type ServicePlanMetadata struct {
@@ -52,6 +68,12 @@ type ServicePlanMetadata struct {
 	Bullets     []string          `json:"bullets,omitempty"`
 	Costs       []ServicePlanCost `json:"costs,omitempty"`
 	Helm        HelmConfig        `json:"helm"`
+	Credentials CredentialsConfig `json:"credentials,omitempty"`
+}
+
+type ServicePlanMaintenanceInfo struct {
+	Version     string `json:"version,omitempty"`
+	Description string `json:"description,omitempty"`
 }
 
 type ServicePlanSchemas struct {
@@ -77,10 +99,17 @@ type UpdateSchema struct {
 }
 
 type HelmConfig struct {
-	Chart      string           `json:"chart"`
-	Repository string           `json:"repository,omitempty"`
-	Version    string           `json:"version,omitempty"`
-	Values     *HelmChartValues `json:"values"`
+	Chart             string           `json:"chart"`
+	Repository        string           `json:"repository,omitempty"`
+	Version           string           `json:"version,omitempty"`
+	Values            *HelmChartValues `json:"values"`
+	AllowedParameters []string         `json:"allowed_parameters,omitempty"`
+	DeniedParameters  []string         `json:"denied_parameters,omitempty"`
+	Timeouts          Timeouts         `json:"timeouts,omitempty"`
+	Namespace         *NamespaceConfig `json:"namespace,omitempty"`
+	WaitForReady      bool             `json:"wait_for_ready,omitempty"`
+	RunTests          bool             `json:"run_tests,omitempty"`
+	RollbackOnFailure bool             `json:"rollback_on_failure,omitempty"`
 }
 
 type HelmChartValues map[string]interface{}
@@ -90,6 +119,56 @@ type ServicePlanCost struct {
 	Unit   string             `json:"unit,omitempty"`
 }
 
+// OSBCatalog returns the catalog as advertised to platforms, without the
+// internal Helm and credentials configuration of the plans, and with the
+// current maintenance info of each plan. All services are advertised as
+// instances and bindings retrievable, as the broker serves both endpoints.
+func (c Catalog) OSBCatalog() (map[string]interface{}, error) {
+	osbCatalog := map[string]interface{}{}
+
+	catalog := Catalog{Services: make([]Service, len(c.Services))}
+	for i, service := range c.Services {
+		service.InstancesRetrievable = true
+		service.BindingsRetrievable = true
+		plans := make([]ServicePlan, len(service.Plans))
+		for j, plan := range service.Plans {
+			plan.MaintenanceInfo = plan.CurrentMaintenanceInfo()
+			plans[j] = plan
+		}
+		service.Plans = plans
+		catalog.Services[i] = service
+	}
+
+	content, err := json.Marshal(catalog)
+	if err != nil {
+		return osbCatalog, err
+	}
+
+	if err = json.Unmarshal(content, &osbCatalog); err != nil {
+		return osbCatalog, err
+	}
+
+	services, _ := osbCatalog["services"].([]interface{})
+	for _, service := range services {
+		service, _ := service.(map[string]interface{})
+		plans, _ := service["plans"].([]interface{})
+		for _, plan := range plans {
+			plan, _ := plan.(map[string]interface{})
+			if metadata, ok := plan["metadata"].(map[string]interface{}); ok {
+				for _, key := range internalPlanMetadataKeys {
+					delete(metadata, key)
+				}
+			}
+		}
+	}
+
+	if _, ok := osbCatalog["services"]; !ok {
+		osbCatalog["services"] = []interface{}{}
+	}
+
+	return osbCatalog, nil
+}
+
 func (c Catalog) Validate() error {
 	for _, service := range c.Services {
 		if err := service.Validate(); err != nil {
@@ -125,6 +204,43 @@ func (c Catalog) FindServicePlan(serviceID string, planID string) (plan ServiceP
 	return plan, false
 }
 
+// FindChartPlan returns the service plan deploying a release chart, given as
+// `<name>-<version>` as Helm reports it. It is only found when a single plan
+// of the catalog deploys that chart.
+func (c Catalog) FindChartPlan(releaseChart string) (service Service, plan ServicePlan, found bool) {
+	matches := 0
+	for _, s := range c.Services {
+		for _, p := range s.Plans {
+			if p.Metadata == nil {
+				continue
+			}
+
+			prefix := path.Base(p.Metadata.Helm.Chart) + "-"
+			if !strings.HasPrefix(releaseChart, prefix) {
+				continue
+			}
+			if _, err := semver.NewVersion(strings.TrimPrefix(releaseChart, prefix)); err != nil {
+				continue
+			}
+
+			service, plan = s, p
+			matches++
+		}
+	}
+
+	return service, plan, matches == 1
+}
+
+// IsPlanUpdateable reports whether instances of a plan can be moved to another
+// plan of the service. The plan setting, if any, overrides the service one.
+func (s Service) IsPlanUpdateable(plan ServicePlan) bool {
+	if plan.PlanUpdateable != nil {
+		return *plan.PlanUpdateable
+	}
+
+	return s.PlanUpdateable
+}
+
 func (s Service) Validate() error {
 	if s.ID == "" {
 		return fmt.Errorf("Must provide a non-empty ID (%+v)", s)
@@ -172,6 +288,136 @@ func (sp ServicePlan) Validate() error {
 		return fmt.Errorf("Validating Helm configuration for Service Plan `%s`: %s", sp.Name, err)
 	}
 
+	if err := sp.Metadata.Credentials.Validate(); err != nil {
+		return fmt.Errorf("Validating Credentials configuration for Service Plan `%s`: %s", sp.Name, err)
+	}
+
+	if sp.Schemas != nil {
+		if err := sp.Schemas.Validate(); err != nil {
+			return fmt.Errorf("Validating Schemas for Service Plan `%s`: %s", sp.Name, err)
+		}
+	}
+
+	if sp.MaintenanceInfo != nil {
+		if _, err := semver.NewVersion(sp.MaintenanceInfo.Version); err != nil {
+			return fmt.Errorf("Validating Maintenance Info for Service Plan `%s`: Invalid version `%s`", sp.Name, sp.MaintenanceInfo.Version)
+		}
+	}
+
+	return nil
+}
+
+// CurrentMaintenanceInfo returns the maintenance info of the plan. Unless it
+// is configured, it is derived from the chart version and a revision of the
+// plan values, so it changes whenever instances need an upgrade to match the
+// plan. Plans without an exact chart version have no derived maintenance info.
+func (sp ServicePlan) CurrentMaintenanceInfo() *ServicePlanMaintenanceInfo {
+	if sp.MaintenanceInfo != nil || sp.Metadata == nil {
+		return sp.MaintenanceInfo
+	}
+
+	helmConfig := sp.Metadata.Helm
+	if helmConfig.Version == "" || helm.IsVersionConstraint(helmConfig.Version) {
+		return nil
+	}
+
+	chartVersion, err := semver.NewVersion(helmConfig.Version)
+	if err != nil {
+		return nil
+	}
+
+	version := fmt.Sprintf("%d.%d.%d", chartVersion.Major(), chartVersion.Minor(), chartVersion.Patch())
+	if chartVersion.Prerelease() != "" {
+		version = version + "-" + chartVersion.Prerelease()
+	}
+
+	if helmConfig.Values != nil && len(*helmConfig.Values) > 0 {
+		content, err := json.Marshal(helmConfig.Values)
+		if err != nil {
+			return nil
+		}
+		sum := sha256.Sum256(content)
+		version = version + "+values." + hex.EncodeToString(sum[:4])
+	}
+
+	return &ServicePlanMaintenanceInfo{
+		Version:     version,
+		Description: fmt.Sprintf("Chart `%s` version %s", helmConfig.Chart, helmConfig.Version),
+	}
+}
+
+// MaintenanceInfoVersion returns the current maintenance info version of the
+// plan, or an empty string if it has none.
+func (sp ServicePlan) MaintenanceInfoVersion() string {
+	if maintenanceInfo := sp.CurrentMaintenanceInfo(); maintenanceInfo != nil {
+		return maintenanceInfo.Version
+	}
+
+	return ""
+}
+
+func (sp ServicePlan) ProvisionParametersSchema() json.RawMessage {
+	if sp.Schemas == nil || sp.Schemas.ServiceInstance == nil {
+		return nil
+	}
+
+	return sp.Schemas.ServiceInstance.CreateSchema.Parameters
+}
+
+func (sp ServicePlan) UpdateParametersSchema() json.RawMessage {
+	if sp.Schemas == nil || sp.Schemas.ServiceInstance == nil {
+		return nil
+	}
+
+	return sp.Schemas.ServiceInstance.UpdateSchema.Parameters
+}
+
+func (sp ServicePlan) BindParametersSchema() json.RawMessage {
+	if sp.Schemas == nil || sp.Schemas.ServiceBinding == nil {
+		return nil
+	}
+
+	return sp.Schemas.ServiceBinding.CreateSchema.Parameters
+}
+
+// ForbiddenParameters returns the paths of the user parameters the plan does
+// not allow to be set. A path is denied if it would change a denied value,
+// including by replacing one of its parents, and it is only allowed if it or
+// one of its parents is in the allowlist.
+func (hc HelmConfig) ForbiddenParameters(parameters map[string]interface{}) []string {
+	forbidden := []string{}
+
+	for _, path := range values.Paths(parameters) {
+		if coversAny(hc.DeniedParameters, path) {
+			forbidden = append(forbidden, path)
+			continue
+		}
+
+		if len(hc.AllowedParameters) > 0 && !matchesAny(hc.AllowedParameters, path) {
+			forbidden = append(forbidden, path)
+		}
+	}
+
+	return forbidden
+}
+
+func (sps ServicePlanSchemas) Validate() error {
+	if sps.ServiceInstance != nil {
+		if err := validateSchema(sps.ServiceInstance.CreateSchema.Parameters); err != nil {
+			return fmt.Errorf("Validating Service Instance create schema: %s", err)
+		}
+
+		if err := validateSchema(sps.ServiceInstance.UpdateSchema.Parameters); err != nil {
+			return fmt.Errorf("Validating Service Instance update schema: %s", err)
+		}
+	}
+
+	if sps.ServiceBinding != nil {
+		if err := validateSchema(sps.ServiceBinding.CreateSchema.Parameters); err != nil {
+			return fmt.Errorf("Validating Service Binding create schema: %s", err)
+		}
+	}
+
 	return nil
 }
 
@@ -180,5 +426,66 @@ func (hc HelmConfig) Validate() error {
 		return fmt.Errorf("Must provide a non-empty Chart (%+v)", hc)
 	}
 
+	for _, pattern := range hc.AllowedParameters {
+		if err := values.ValidatePattern(pattern); err != nil {
+			return fmt.Errorf("Validating Allowed Parameters: %s", err)
+		}
+	}
+
+	for _, pattern := range hc.DeniedParameters {
+		if err := values.ValidatePattern(pattern); err != nil {
+			return fmt.Errorf("Validating Denied Parameters: %s", err)
+		}
+	}
+
+	if helm.IsVersionConstraint(hc.Version) && hc.Repository == "" {
+		return fmt.Errorf("Must provide a non-empty Repository to use the Version constraint `%s`", hc.Version)
+	}
+
+	if err := hc.Timeouts.Validate(); err != nil {
+		return fmt.Errorf("Validating Timeouts: %s", err)
+	}
+
+	if hc.Values != nil {
+		if err := validateValuesTemplates(*hc.Values); err != nil {
+			return fmt.Errorf("Validating Values: %s", err)
+		}
+	}
+
+	if hc.Namespace != nil {
+		if err := hc.Namespace.Validate(); err != nil {
+			return fmt.Errorf("Validating Namespace: %s", err)
+		}
+	}
+
 	return nil
 }
+
+func validateSchema(parametersSchema json.RawMessage) error {
+	if len(parametersSchema) == 0 {
+		return nil
+	}
+
+	_, err := schema.Compile(parametersSchema)
+	return err
+}
+
+func matchesAny(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		if values.MatchPath(pattern, path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func coversAny(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		if values.CoversPath(pattern, path) {
+			return true
+		}
+	}
+
+	return false
+}
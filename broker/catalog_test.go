@@ -101,6 +101,115 @@ var _ = Describe("Catalog", func() {
 			Expect(found).To(BeFalse())
 		})
 	})
+
+	Describe("FindChartPlan", func() {
+		It("returns true and the Service Plan deploying the chart", func() {
+			service, plan, found := catalog.FindChartPlan("fake-service-plan-1-chart-1.0.0")
+			Expect(found).To(BeTrue())
+			Expect(service.ID).To(Equal("fake-service-1"))
+			Expect(plan).To(Equal(servicePlan1))
+		})
+
+		It("matches charts from a repository", func() {
+			catalog.Services[1].Plans[0].Metadata.Helm.Chart = "stable/mysql"
+
+			_, plan, found := catalog.FindChartPlan("mysql-1.0.0-rc.1")
+			Expect(found).To(BeTrue())
+			Expect(plan.ID).To(Equal("fake-service-plan-2"))
+		})
+
+		It("returns false if no plan deploys the chart", func() {
+			_, _, found := catalog.FindChartPlan("fake-service-plan-1-1.0.0")
+			Expect(found).To(BeFalse())
+		})
+
+		It("returns false if several plans deploy the chart", func() {
+			catalog.Services[1].Plans[0].Metadata.Helm.Chart = "fake-service-plan-1-chart"
+
+			_, _, found := catalog.FindChartPlan("fake-service-plan-1-chart-1.0.0")
+			Expect(found).To(BeFalse())
+		})
+	})
+
+	Describe("OSBCatalog", func() {
+		BeforeEach(func() {
+			planUpdateable := false
+			catalog.Services[0].InstancesRetrievable = true
+			catalog.Services[0].Plans[0].PlanUpdateable = &planUpdateable
+			catalog.Services[0].Plans[0].MaintenanceInfo = &ServicePlanMaintenanceInfo{
+				Version: "1.2.3",
+			}
+			catalog.Services[0].Plans[0].Metadata.Bullets = []string{"fake-bullet"}
+			catalog.Services[0].Plans[0].Metadata.Credentials = CredentialsConfig{
+				"host": "{{ .ReleaseName }}",
+			}
+			catalog.Services[0].Plans[0].Schemas = &ServicePlanSchemas{
+				ServiceInstance: &ServiceInstanceSchema{
+					CreateSchema: CreateSchema{
+						Parameters: []byte(`{"type":"object"}`),
+					},
+				},
+			}
+		})
+
+		It("returns the OSB fields", func() {
+			osbCatalog, err := catalog.OSBCatalog()
+			Expect(err).ToNot(HaveOccurred())
+
+			services := osbCatalog["services"].([]interface{})
+			Expect(services).To(HaveLen(2))
+			service := services[0].(map[string]interface{})
+			Expect(service["instances_retrievable"]).To(Equal(true))
+			plan := service["plans"].([]interface{})[0].(map[string]interface{})
+			Expect(plan["plan_updateable"]).To(Equal(false))
+			Expect(plan["maintenance_info"]).To(Equal(map[string]interface{}{"version": "1.2.3"}))
+			schemas := plan["schemas"].(map[string]interface{})
+			Expect(schemas["service_instance"]).To(HaveKeyWithValue("create", map[string]interface{}{
+				"parameters": map[string]interface{}{"type": "object"},
+			}))
+		})
+
+		It("advertises instances and bindings as retrievable", func() {
+			osbCatalog, err := catalog.OSBCatalog()
+			Expect(err).ToNot(HaveOccurred())
+
+			service := osbCatalog["services"].([]interface{})[1].(map[string]interface{})
+			Expect(service["instances_retrievable"]).To(Equal(true))
+			Expect(service["bindings_retrievable"]).To(Equal(true))
+		})
+
+		It("returns the derived maintenance info", func() {
+			catalog.Services[1].Plans[0].Metadata.Helm.Version = "2.0.1"
+
+			osbCatalog, err := catalog.OSBCatalog()
+			Expect(err).ToNot(HaveOccurred())
+
+			service := osbCatalog["services"].([]interface{})[1].(map[string]interface{})
+			plan := service["plans"].([]interface{})[0].(map[string]interface{})
+			Expect(plan["maintenance_info"]).To(Equal(map[string]interface{}{
+				"version":     "2.0.1",
+				"description": "Chart `fake-service-plan-2-chart` version 2.0.1",
+			}))
+			Expect(catalog.Services[1].Plans[0].MaintenanceInfo).To(BeNil())
+		})
+
+		It("does not return the internal plan metadata", func() {
+			osbCatalog, err := catalog.OSBCatalog()
+			Expect(err).ToNot(HaveOccurred())
+
+			service := osbCatalog["services"].([]interface{})[0].(map[string]interface{})
+			plan := service["plans"].([]interface{})[0].(map[string]interface{})
+			Expect(plan["metadata"]).To(Equal(map[string]interface{}{
+				"bullets": []interface{}{"fake-bullet"},
+			}))
+		})
+
+		It("returns an empty services list if there are no Services", func() {
+			osbCatalog, err := Catalog{}.OSBCatalog()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(osbCatalog["services"]).To(BeEmpty())
+		})
+	})
 })
 
 var _ = Describe("Service", func() {
@@ -136,6 +245,19 @@ var _ = Describe("Service", func() {
 		}
 	})
 
+	Describe("IsPlanUpdateable", func() {
+		It("returns the Service setting if the plan does not override it", func() {
+			Expect(service.IsPlanUpdateable(service.Plans[0])).To(BeTrue())
+		})
+
+		It("returns the plan setting if present", func() {
+			planUpdateable := false
+			service.Plans[0].PlanUpdateable = &planUpdateable
+
+			Expect(service.IsPlanUpdateable(service.Plans[0])).To(BeFalse())
+		})
+	})
+
 	Describe("Validate", func() {
 		It("does not return error if all fields are valid", func() {
 			err := service.Validate()
@@ -251,6 +373,72 @@ var _ = Describe("ServicePlan", func() {
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("Validating Helm configuration for Service Plan"))
 		})
+
+		It("returns error if Schemas are not valid", func() {
+			servicePlan.Schemas = &ServicePlanSchemas{
+				ServiceInstance: &ServiceInstanceSchema{
+					CreateSchema: CreateSchema{
+						Parameters: []byte(`{"type": "fake-type"}`),
+					},
+				},
+			}
+
+			err := servicePlan.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Validating Schemas for Service Plan"))
+		})
+
+		It("returns error if Credentials are not valid", func() {
+			servicePlan.Metadata.Credentials = CredentialsConfig{"host": "{{ serviceHost "}
+
+			err := servicePlan.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Validating Credentials configuration for Service Plan"))
+		})
+
+		It("returns error if Maintenance Info is not valid", func() {
+			servicePlan.MaintenanceInfo = &ServicePlanMaintenanceInfo{Version: "fake-version"}
+
+			err := servicePlan.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Validating Maintenance Info for Service Plan"))
+		})
+	})
+
+	Describe("CurrentMaintenanceInfo", func() {
+		It("returns the configured Maintenance Info", func() {
+			servicePlan.Metadata.Helm.Version = "1.2.0"
+			servicePlan.MaintenanceInfo = &ServicePlanMaintenanceInfo{Version: "2.0.0"}
+
+			Expect(servicePlan.CurrentMaintenanceInfo()).To(Equal(&ServicePlanMaintenanceInfo{Version: "2.0.0"}))
+		})
+
+		It("derives the Maintenance Info from the chart version", func() {
+			servicePlan.Metadata.Helm.Version = "1.2.0"
+
+			Expect(servicePlan.CurrentMaintenanceInfo()).To(Equal(&ServicePlanMaintenanceInfo{
+				Version:     "1.2.0",
+				Description: "Chart `fake-service-plan-chart` version 1.2.0",
+			}))
+		})
+
+		It("derives a different version when the values change", func() {
+			servicePlan.Metadata.Helm.Version = "1.2.0"
+			servicePlan.Metadata.Helm.Values = &HelmChartValues{"replicas": 1}
+			version := servicePlan.CurrentMaintenanceInfo().Version
+			Expect(version).To(HavePrefix("1.2.0+values."))
+
+			servicePlan.Metadata.Helm.Values = &HelmChartValues{"replicas": 2}
+			Expect(servicePlan.CurrentMaintenanceInfo().Version).To(HavePrefix("1.2.0+values."))
+			Expect(servicePlan.CurrentMaintenanceInfo().Version).ToNot(Equal(version))
+		})
+
+		It("returns nil if the chart version is not exact", func() {
+			Expect(servicePlan.CurrentMaintenanceInfo()).To(BeNil())
+
+			servicePlan.Metadata.Helm.Version = "~1.2"
+			Expect(servicePlan.CurrentMaintenanceInfo()).To(BeNil())
+		})
 	})
 })
 
@@ -278,5 +466,80 @@ var _ = Describe("HelmConfig", func() {
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("Must provide a non-empty Chart"))
 		})
+
+		It("returns error if Allowed Parameters are not valid", func() {
+			helmConfig.AllowedParameters = []string{"resources.["}
+
+			err := helmConfig.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Validating Allowed Parameters"))
+		})
+
+		It("returns error if Denied Parameters are not valid", func() {
+			helmConfig.DeniedParameters = []string{""}
+
+			err := helmConfig.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Validating Denied Parameters"))
+		})
+
+		It("returns error if Values templates are not valid", func() {
+			helmConfig.Values = &HelmChartValues{"auth": map[string]interface{}{"password": "{{ randomPassword 16"}}
+
+			err := helmConfig.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Error parsing template for value `auth.password`"))
+		})
+
+		It("returns error if a Version constraint does not have a Repository", func() {
+			helmConfig.Version = "~1.4"
+
+			err := helmConfig.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Must provide a non-empty Repository to use the Version constraint `~1.4`"))
+		})
+	})
+
+	Describe("ForbiddenParameters", func() {
+		var (
+			parameters = map[string]interface{}{
+				"image":       map[string]interface{}{"repository": "fake-repository"},
+				"persistence": map[string]interface{}{"size": "16Gi"},
+				"resources":   map[string]interface{}{"limits": map[string]interface{}{"memory": "1Gi"}},
+			}
+		)
+
+		It("returns no paths if there are no restrictions", func() {
+			Expect(helmConfig.ForbiddenParameters(parameters)).To(BeEmpty())
+		})
+
+		It("returns paths not in the allowlist", func() {
+			helmConfig.AllowedParameters = []string{"persistence.size", "resources.*.memory"}
+
+			Expect(helmConfig.ForbiddenParameters(parameters)).To(Equal([]string{"image.repository"}))
+		})
+
+		It("returns paths in the denylist even if they are allowed", func() {
+			helmConfig.AllowedParameters = []string{"persistence", "resources"}
+			helmConfig.DeniedParameters = []string{"resources.limits"}
+
+			Expect(helmConfig.ForbiddenParameters(parameters)).To(Equal([]string{"image.repository", "resources.limits.memory"}))
+		})
+
+		It("returns parents of paths in the denylist", func() {
+			helmConfig.DeniedParameters = []string{"image.repository"}
+
+			Expect(helmConfig.ForbiddenParameters(map[string]interface{}{"image": "evil"})).To(Equal([]string{"image"}))
+			Expect(helmConfig.ForbiddenParameters(map[string]interface{}{"image": nil})).To(Equal([]string{"image"}))
+			Expect(helmConfig.ForbiddenParameters(map[string]interface{}{"image": map[string]interface{}{"tag": "latest"}})).To(BeEmpty())
+		})
+
+		It("returns parents of paths in the allowlist", func() {
+			helmConfig.AllowedParameters = []string{"image.tag"}
+
+			Expect(helmConfig.ForbiddenParameters(map[string]interface{}{"image": "evil"})).To(Equal([]string{"image"}))
+			Expect(helmConfig.ForbiddenParameters(map[string]interface{}{"image": nil})).To(Equal([]string{"image"}))
+			Expect(helmConfig.ForbiddenParameters(map[string]interface{}{"image": map[string]interface{}{"tag": "latest"}})).To(BeEmpty())
+		})
 	})
 })
@@ -5,15 +5,24 @@ import (
 	"fmt"
 )
 
+const (
+	defaultConcurrentOperations = 5
+	defaultQueuedOperations     = 100
+)
+
 type Config struct {
-	Username                     string  `json:"username"`
-	Password                     string  `json:"password"`
-	TLSCertFile                  string  `json:"tls_cert_file"`
-	TLSKeyFile                   string  `json:"tls_key_file"`
-	AllowUserProvisionParameters bool    `json:"allow_user_provision_parameters"`
-	AllowUserUpdateParameters    bool    `json:"allow_user_update_parameters"`
-	AllowUserBindParameters      bool    `json:"allow_user_bind_parameters"`
-	Catalog                      Catalog `json:"catalog"`
+	Username                     string          `json:"username"`
+	Password                     string          `json:"password"`
+	TLSCertFile                  string          `json:"tls_cert_file"`
+	TLSKeyFile                   string          `json:"tls_key_file"`
+	AllowUserProvisionParameters bool            `json:"allow_user_provision_parameters"`
+	AllowUserUpdateParameters    bool            `json:"allow_user_update_parameters"`
+	AllowUserBindParameters      bool            `json:"allow_user_bind_parameters"`
+	ConcurrentOperations         int             `json:"concurrent_operations,omitempty"`
+	QueuedOperations             int             `json:"queued_operations,omitempty"`
+	Timeouts                     Timeouts        `json:"timeouts,omitempty"`
+	Namespace                    NamespaceConfig `json:"namespace,omitempty"`
+	Catalog                      Catalog         `json:"catalog"`
 }
 
 func (c Config) Validate() error {
@@ -25,9 +34,78 @@ func (c Config) Validate() error {
 		return errors.New("Must provide a non-empty Password")
 	}
 
+	if c.ConcurrentOperations < 0 {
+		return errors.New("Must provide a non-negative Concurrent Operations")
+	}
+
+	if c.QueuedOperations < 0 {
+		return errors.New("Must provide a non-negative Queued Operations")
+	}
+
+	if err := c.Timeouts.Validate(); err != nil {
+		return fmt.Errorf("Validating Timeouts configuration: %s", err)
+	}
+
+	if err := c.Namespace.Validate(); err != nil {
+		return fmt.Errorf("Validating Namespace configuration: %s", err)
+	}
+
 	if err := c.Catalog.Validate(); err != nil {
 		return fmt.Errorf("Validating Catalog configuration: %s", err)
 	}
 
 	return nil
 }
+
+func (c Config) MaxConcurrentOperations() int {
+	if c.ConcurrentOperations == 0 {
+		return defaultConcurrentOperations
+	}
+
+	return c.ConcurrentOperations
+}
+
+func (c Config) MaxQueuedOperations() int {
+	if c.QueuedOperations == 0 {
+		return defaultQueuedOperations
+	}
+
+	return c.QueuedOperations
+}
+
+// ManagesNamespaces reports whether the broker or any plan creates the
+// namespaces releases are installed into.
+func (c Config) ManagesNamespaces() bool {
+	if c.Namespace.IsManaged() {
+		return true
+	}
+
+	for _, service := range c.Catalog.Services {
+		for _, plan := range service.Plans {
+			if plan.Metadata != nil && plan.Metadata.Helm.Namespace != nil && plan.Metadata.Helm.Namespace.IsManaged() {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// UsesKubernetes reports whether any feature that talks to the Kubernetes API
+// is enabled: managed namespaces, or plans waiting for their workloads to be
+// ready, which running the release tests also does.
+func (c Config) UsesKubernetes() bool {
+	if c.ManagesNamespaces() {
+		return true
+	}
+
+	for _, service := range c.Catalog.Services {
+		for _, plan := range service.Plans {
+			if plan.Metadata != nil && (plan.Metadata.Helm.WaitForReady || plan.Metadata.Helm.RunTests) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
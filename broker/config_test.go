@@ -42,5 +42,97 @@ var _ = Describe("Config", func() {
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(Equal("Must provide a non-empty Password"))
 		})
+
+		It("returns error if Concurrent Operations is not valid", func() {
+			config.ConcurrentOperations = -1
+
+			err := config.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Must provide a non-negative Concurrent Operations"))
+		})
+
+		It("returns error if Queued Operations is not valid", func() {
+			config.QueuedOperations = -1
+
+			err := config.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Must provide a non-negative Queued Operations"))
+		})
+
+		It("returns error if Timeouts are not valid", func() {
+			config.Timeouts = Timeouts{Install: -1}
+
+			err := config.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Validating Timeouts configuration"))
+		})
+	})
+
+	Describe("MaxConcurrentOperations", func() {
+		It("returns the default if not configured", func() {
+			Expect(validConfig.MaxConcurrentOperations()).To(Equal(5))
+		})
+
+		It("returns the configured value", func() {
+			config = validConfig
+			config.ConcurrentOperations = 10
+			Expect(config.MaxConcurrentOperations()).To(Equal(10))
+		})
+	})
+
+	Describe("MaxQueuedOperations", func() {
+		It("returns the default if not configured", func() {
+			Expect(validConfig.MaxQueuedOperations()).To(Equal(100))
+		})
+
+		It("returns the configured value", func() {
+			config = validConfig
+			config.QueuedOperations = 10
+			Expect(config.MaxQueuedOperations()).To(Equal(10))
+		})
+	})
+
+	Describe("UsesKubernetes", func() {
+		plan := func(helmConfig HelmConfig) Config {
+			config := validConfig
+			config.Catalog = Catalog{
+				Services: []Service{
+					Service{
+						ID:    "fake-service",
+						Plans: []ServicePlan{ServicePlan{ID: "fake-plan", Metadata: &ServicePlanMetadata{Helm: helmConfig}}},
+					},
+				},
+			}
+			return config
+		}
+
+		It("returns false if no feature needs Kubernetes", func() {
+			Expect(plan(HelmConfig{Chart: "fake-chart"}).UsesKubernetes()).To(BeFalse())
+		})
+
+		It("returns true if the broker manages namespaces", func() {
+			config = plan(HelmConfig{Chart: "fake-chart"})
+			config.Namespace = NamespaceConfig{Strategy: PerInstanceNamespaceStrategy}
+			Expect(config.ManagesNamespaces()).To(BeTrue())
+			Expect(config.UsesKubernetes()).To(BeTrue())
+		})
+
+		It("returns true if a plan manages namespaces", func() {
+			config = plan(HelmConfig{Chart: "fake-chart", Namespace: &NamespaceConfig{Strategy: PerInstanceNamespaceStrategy}})
+			Expect(config.ManagesNamespaces()).To(BeTrue())
+			Expect(config.UsesKubernetes()).To(BeTrue())
+		})
+
+		It("returns true if a plan waits for its workloads", func() {
+			config = plan(HelmConfig{Chart: "fake-chart", WaitForReady: true})
+			Expect(config.ManagesNamespaces()).To(BeFalse())
+			Expect(config.UsesKubernetes()).To(BeTrue())
+		})
+
+		It("returns true if a plan runs the release tests", func() {
+			config = plan(HelmConfig{Chart: "fake-chart", RunTests: true})
+			Expect(config.ManagesNamespaces()).To(BeFalse())
+			Expect(config.UsesKubernetes()).To(BeTrue())
+		})
 	})
 })
@@ -0,0 +1,127 @@
+package broker
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"text/template"
+
+	"github.com/frodenas/helm-osb/helm"
+	"github.com/frodenas/helm-osb/store"
+)
+
+type CredentialsConfig map[string]string
+
+type CredentialsData struct {
+	InstanceID  string
+	BindingID   string
+	ReleaseName string
+	Namespace   string
+	Context     store.PlatformContext
+}
+
+func (cc CredentialsConfig) Validate() error {
+	for key, value := range cc {
+		if _, err := template.New(key).Funcs(credentialsFuncs(helm.Manifest{})).Parse(value); err != nil {
+			return fmt.Errorf("Error parsing template for credential `%s`: %s", key, err)
+		}
+	}
+
+	return nil
+}
+
+func (cc CredentialsConfig) Resolve(data CredentialsData, manifest helm.Manifest) (map[string]interface{}, error) {
+	credentials := map[string]interface{}{}
+
+	for key, value := range cc {
+		tmpl, err := template.New(key).Funcs(credentialsFuncs(manifest)).Parse(value)
+		if err != nil {
+			return credentials, fmt.Errorf("Error parsing template for credential `%s`: %s", key, err)
+		}
+
+		var credential bytes.Buffer
+		if err := tmpl.Execute(&credential, data); err != nil {
+			return credentials, fmt.Errorf("Error resolving credential `%s`: %s", key, err)
+		}
+
+		credentials[key] = credential.String()
+	}
+
+	return credentials, nil
+}
+
+func credentialsFuncs(manifest helm.Manifest) template.FuncMap {
+	findService := func(name string) (helm.Resource, error) {
+		service, ok := manifest.FindResource("Service", name)
+		if !ok {
+			return service, fmt.Errorf("Service `%s` not found in release", name)
+		}
+
+		return service, nil
+	}
+
+	return template.FuncMap{
+		"serviceHost": func(name string) (string, error) {
+			service, err := findService(name)
+			if err != nil {
+				return "", err
+			}
+
+			return fmt.Sprintf("%s.%s.svc", service.Metadata.Name, service.Metadata.Namespace), nil
+		},
+		"serviceClusterIP": func(name string) (string, error) {
+			service, err := findService(name)
+			if err != nil {
+				return "", err
+			}
+
+			if service.Spec.ClusterIP == "" || service.Spec.ClusterIP == "None" {
+				return "", fmt.Errorf("Service `%s` does not have a Cluster IP", name)
+			}
+
+			return service.Spec.ClusterIP, nil
+		},
+		"servicePort": func(name string, portName string) (string, error) {
+			service, err := findService(name)
+			if err != nil {
+				return "", err
+			}
+
+			port, ok := service.FindPort(portName)
+			if !ok {
+				return "", fmt.Errorf("Port `%s` not found in Service `%s`", portName, name)
+			}
+
+			return strconv.Itoa(port.Port), nil
+		},
+		"secretValue": func(name string, key string) (string, error) {
+			secret, ok := manifest.FindResource("Secret", name)
+			if !ok {
+				return "", fmt.Errorf("Secret `%s` not found in release", name)
+			}
+
+			value, ok, err := secret.SecretValue(key)
+			if err != nil {
+				return "", err
+			}
+			if !ok {
+				return "", fmt.Errorf("Key `%s` not found in Secret `%s`", key, name)
+			}
+
+			return value, nil
+		},
+		"configMapValue": func(name string, key string) (string, error) {
+			configMap, ok := manifest.FindResource("ConfigMap", name)
+			if !ok {
+				return "", fmt.Errorf("ConfigMap `%s` not found in release", name)
+			}
+
+			value, ok := configMap.Data[key]
+			if !ok {
+				return "", fmt.Errorf("Key `%s` not found in ConfigMap `%s`", key, name)
+			}
+
+			return value, nil
+		},
+	}
+}
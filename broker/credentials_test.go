@@ -0,0 +1,108 @@
+package broker_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/frodenas/helm-osb/broker"
+
+	"github.com/frodenas/helm-osb/helm"
+)
+
+var _ = Describe("CredentialsConfig", func() {
+	var (
+		credentialsConfig CredentialsConfig
+		credentialsData   CredentialsData
+		manifest          helm.Manifest
+	)
+
+	BeforeEach(func() {
+		credentialsConfig = CredentialsConfig{
+			"host":     `{{ serviceHost (print .ReleaseName "-mysql") }}`,
+			"port":     `{{ servicePort (print .ReleaseName "-mysql") "mysql" }}`,
+			"password": `{{ secretValue (print .ReleaseName "-mysql") "mysql-root-password" }}`,
+			"database": `{{ configMapValue (print .ReleaseName "-mysql") "database" }}`,
+			"name":     "{{ .InstanceID }}",
+		}
+
+		credentialsData = CredentialsData{
+			InstanceID:  "fake-instance-id",
+			BindingID:   "fake-binding-id",
+			ReleaseName: "fake-release",
+			Namespace:   "fake-namespace",
+		}
+
+		manifest = helm.Manifest{
+			helm.Resource{
+				Kind:     "Service",
+				Metadata: helm.ResourceMetadata{Name: "fake-release-mysql", Namespace: "fake-namespace"},
+				Spec: helm.ResourceSpec{
+					Ports: []helm.ServicePort{helm.ServicePort{Name: "mysql", Port: 3306}},
+				},
+			},
+			helm.Resource{
+				Kind:     "Secret",
+				Metadata: helm.ResourceMetadata{Name: "fake-release-mysql", Namespace: "fake-namespace"},
+				Data:     map[string]string{"mysql-root-password": "ZmFrZS1wYXNzd29yZA=="},
+			},
+			helm.Resource{
+				Kind:     "ConfigMap",
+				Metadata: helm.ResourceMetadata{Name: "fake-release-mysql", Namespace: "fake-namespace"},
+				Data:     map[string]string{"database": "fake-database"},
+			},
+		}
+	})
+
+	Describe("Validate", func() {
+		It("does not return error if all templates are valid", func() {
+			err := credentialsConfig.Validate()
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("returns error if a template is not valid", func() {
+			credentialsConfig["host"] = "{{ serviceHost "
+
+			err := credentialsConfig.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Error parsing template for credential `host`"))
+		})
+	})
+
+	Describe("Resolve", func() {
+		It("returns the credentials resolved against the release resources", func() {
+			credentials, err := credentialsConfig.Resolve(credentialsData, manifest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(credentials).To(Equal(map[string]interface{}{
+				"host":     "fake-release-mysql.fake-namespace.svc",
+				"port":     "3306",
+				"password": "fake-password",
+				"database": "fake-database",
+				"name":     "fake-instance-id",
+			}))
+		})
+
+		It("returns error if a Service is not found", func() {
+			credentialsConfig["host"] = `{{ serviceHost "unknown" }}`
+
+			_, err := credentialsConfig.Resolve(credentialsData, manifest)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Service `unknown` not found in release"))
+		})
+
+		It("returns error if a Service Port is not found", func() {
+			credentialsConfig["port"] = `{{ servicePort "fake-release-mysql" "http" }}`
+
+			_, err := credentialsConfig.Resolve(credentialsData, manifest)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Port `http` not found in Service `fake-release-mysql`"))
+		})
+
+		It("returns error if a Secret key is not found", func() {
+			credentialsConfig["password"] = `{{ secretValue "fake-release-mysql" "unknown" }}`
+
+			_, err := credentialsConfig.Resolve(credentialsData, manifest)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Key `unknown` not found in Secret `fake-release-mysql`"))
+		})
+	})
+})
@@ -0,0 +1,87 @@
+package broker
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/pivotal-cf/brokerapi"
+
+	"github.com/frodenas/helm-osb/helm"
+	"github.com/frodenas/helm-osb/store"
+)
+
+var (
+	ErrMaintenanceInfoConflict = brokerapi.NewFailureResponseBuilder(
+		errors.New("The maintenance_info.version field provided in the request does not match the maintenance_info.version field provided in the catalog"),
+		http.StatusUnprocessableEntity,
+		"maintenance-info-conflict",
+	).WithErrorKey("MaintenanceInfoConflict").Build()
+
+	ErrMaintenanceInfoNilConflict = brokerapi.NewFailureResponseBuilder(
+		errors.New("The maintenance_info field was provided in the request, but the plan has no maintenance_info in the catalog"),
+		http.StatusUnprocessableEntity,
+		"maintenance-info-nil-conflict",
+	).WithErrorKey("MaintenanceInfoConflict").Build()
+)
+
+// helmFailureResponse maps a Helm error to the OSB failure response for its
+// cause. Unclassified errors are returned as is.
+func helmFailureResponse(err error) error {
+	switch helm.Reason(err) {
+	case helm.ReasonReleaseExists:
+		return brokerapi.NewFailureResponse(err, http.StatusConflict, "helm-release-exists")
+	case helm.ReasonReleaseNotFound:
+		return brokerapi.NewFailureResponse(err, http.StatusNotFound, "helm-release-not-found")
+	case helm.ReasonChartNotFound:
+		return brokerapi.NewFailureResponse(err, http.StatusInternalServerError, "helm-chart-not-found")
+	case helm.ReasonRepositoryUnreachable:
+		return brokerapi.NewFailureResponse(err, http.StatusBadGateway, "helm-repository-unreachable")
+	case helm.ReasonTimeout:
+		return brokerapi.NewFailureResponse(err, http.StatusGatewayTimeout, "helm-timeout")
+	case helm.ReasonForbidden:
+		return brokerapi.NewFailureResponse(err, http.StatusForbidden, "helm-forbidden")
+	default:
+		return err
+	}
+}
+
+// rollbackError is returned by updates that failed and were rolled back, or
+// that had no deployed revision to roll back to.
+type rollbackError struct {
+	cause       error
+	revision    int
+	rollbackErr error
+}
+
+func (e *rollbackError) Error() string {
+	if e.revision == 0 {
+		return fmt.Sprintf("Update failed (%s), and no deployed revision was found to roll back to", e.cause)
+	}
+
+	if e.rollbackErr != nil {
+		return fmt.Sprintf("Update failed (%s), and rolling back to revision %d failed: %s", e.cause, e.revision, e.rollbackErr)
+	}
+
+	return fmt.Sprintf("Update failed (%s), the instance was restored to revision %d", e.cause, e.revision)
+}
+
+// instanceNotFound is returned when fetching instances that do not exist or
+// are still being provisioned.
+func instanceNotFound(instanceID string) error {
+	return brokerapi.NewFailureResponse(
+		fmt.Errorf("Instance `%s` not found", instanceID),
+		http.StatusNotFound,
+		"instance-not-found",
+	)
+}
+
+// concurrencyError is returned for requests conflicting with an operation in
+// progress.
+func concurrencyError(operation store.Operation) error {
+	return brokerapi.NewFailureResponseBuilder(
+		fmt.Errorf("Instance `%s` has a %s operation in progress", operation.InstanceID, operation.Type),
+		http.StatusUnprocessableEntity,
+		"operation-in-progress",
+	).WithErrorKey("ConcurrencyError").Build()
+}
@@ -0,0 +1,303 @@
+package broker_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/frodenas/helm-osb/helm"
+	"github.com/frodenas/helm-osb/kubernetes"
+)
+
+// fakeDriver keeps releases in memory and installs them synchronously.
+type fakeDriver struct {
+	mutex               sync.Mutex
+	releases            map[helm.Release]map[string]interface{}
+	releaseNameTemplate string
+	manifest            helm.Manifest
+	testError           error
+	upgradeError        error
+	upgradePanic        bool
+	rollbacks           []int
+	chartVersions       map[helm.Release]string
+	history             map[helm.Release][]helm.ReleaseRevision
+	block               chan struct{}
+}
+
+func newFakeDriver() *fakeDriver {
+	return &fakeDriver{
+		releases:      map[helm.Release]map[string]interface{}{},
+		chartVersions: map[helm.Release]string{},
+		history:       map[helm.Release][]helm.ReleaseRevision{},
+	}
+}
+
+func (d *fakeDriver) InstallRelease(ctx context.Context, release helm.Release, chart string, repository string, version string, values map[string]interface{}) error {
+	if err := d.wait(ctx); err != nil {
+		return err
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, ok := d.releases[release]; ok {
+		return &helm.Error{Reason: helm.ReasonReleaseExists, Message: "cannot re-use a name that is still in use"}
+	}
+	d.releases[release] = values
+	d.chartVersions[release] = version
+	d.addRevision(release, helm.StatusDeployed)
+
+	return nil
+}
+
+func (d *fakeDriver) UpgradeRelease(ctx context.Context, release helm.Release, chart string, repository string, version string, values map[string]interface{}) error {
+	if err := d.wait(ctx); err != nil {
+		return err
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, ok := d.releases[release]; !ok {
+		return d.notFound(release)
+	}
+	if d.upgradePanic {
+		panic("fake-panic")
+	}
+	if d.upgradeError != nil {
+		d.addRevision(release, helm.StatusFailed)
+		return d.upgradeError
+	}
+	d.releases[release] = values
+	d.chartVersions[release] = version
+	d.addRevision(release, helm.StatusDeployed)
+
+	return nil
+}
+
+func (d *fakeDriver) DeleteRelease(ctx context.Context, release helm.Release) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, ok := d.releases[release]; !ok {
+		return d.notFound(release)
+	}
+	delete(d.releases, release)
+	delete(d.history, release)
+
+	return nil
+}
+
+func (d *fakeDriver) RollbackRelease(ctx context.Context, release helm.Release, revision int) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.rollbacks = append(d.rollbacks, revision)
+	d.addRevision(release, helm.StatusDeployed)
+
+	return nil
+}
+
+func (d *fakeDriver) TestRelease(ctx context.Context, release helm.Release) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, ok := d.releases[release]; !ok {
+		return d.notFound(release)
+	}
+
+	return d.testError
+}
+
+func (d *fakeDriver) ReleaseStatus(ctx context.Context, release helm.Release) (helm.ReleaseStatus, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, ok := d.releases[release]; !ok {
+		return helm.ReleaseStatus{}, d.notFound(release)
+	}
+
+	return helm.ReleaseStatus{
+		Name:         release.Name,
+		Namespace:    release.Namespace,
+		Status:       helm.StatusDeployed,
+		Revision:     1,
+		LastDeployed: time.Now().UTC(),
+	}, nil
+}
+
+func (d *fakeDriver) ReleaseHistory(ctx context.Context, release helm.Release) ([]helm.ReleaseRevision, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, ok := d.releases[release]; !ok {
+		return nil, d.notFound(release)
+	}
+
+	return append([]helm.ReleaseRevision{}, d.history[release]...), nil
+}
+
+func (d *fakeDriver) ReleaseValues(ctx context.Context, release helm.Release) (map[string]interface{}, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	values, ok := d.releases[release]
+	if !ok {
+		return nil, d.notFound(release)
+	}
+
+	return values, nil
+}
+
+func (d *fakeDriver) ReleaseManifest(ctx context.Context, release helm.Release) (helm.Manifest, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, ok := d.releases[release]; !ok {
+		return nil, d.notFound(release)
+	}
+
+	return d.manifest, nil
+}
+
+func (d *fakeDriver) DefaultRelease(instanceID string) helm.Release {
+	return helm.Release{
+		Name:      "fake-" + strings.Replace(instanceID, "-", "", -1),
+		Namespace: "fake-namespace",
+	}
+}
+
+func (d *fakeDriver) ReleaseName(instanceID string, serviceName string, planName string) (string, error) {
+	return helm.RenderReleaseName(d.releaseNameTemplate, helm.NewReleaseNameData("fake", instanceID, serviceName, planName))
+}
+
+func (d *fakeDriver) chartVersion(release helm.Release) string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.chartVersions[release]
+}
+
+func (d *fakeDriver) hasRelease(release helm.Release) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	_, ok := d.releases[release]
+	return ok
+}
+
+// addRevision records a new revision of a release. Deploying a revision
+// supersedes the deployed one. It must be called with the mutex held.
+func (d *fakeDriver) addRevision(release helm.Release, status string) {
+	history := d.history[release]
+	if status == helm.StatusDeployed {
+		for i := range history {
+			if history[i].Status == helm.StatusDeployed {
+				history[i].Status = helm.StatusSuperseded
+			}
+		}
+	}
+	d.history[release] = append(history, helm.ReleaseRevision{Revision: len(history) + 1, Status: status})
+}
+
+// wait holds installs and upgrades until the block channel, if any, is
+// closed, or until ctx is done.
+func (d *fakeDriver) wait(ctx context.Context) error {
+	d.mutex.Lock()
+	block := d.block
+	d.mutex.Unlock()
+
+	if block == nil {
+		return nil
+	}
+
+	select {
+	case <-block:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d *fakeDriver) notFound(release helm.Release) error {
+	return &helm.Error{Reason: helm.ReasonReleaseNotFound, Message: fmt.Sprintf("release: %q not found", release.Name)}
+}
+
+// fakeKubernetesClient keeps namespaces and objects in memory.
+type fakeKubernetesClient struct {
+	mutex      sync.Mutex
+	namespaces map[string]kubernetes.Namespace
+	objects    map[string]interface{}
+}
+
+func newFakeKubernetesClient() *fakeKubernetesClient {
+	return &fakeKubernetesClient{
+		namespaces: map[string]kubernetes.Namespace{},
+		objects:    map[string]interface{}{},
+	}
+}
+
+func (c *fakeKubernetesClient) GetObject(namespace string, kind string, name string, object interface{}) (bool, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stored, ok := c.objects[objectKey(namespace, kind, name)]
+	if !ok {
+		return false, nil
+	}
+
+	content, err := json.Marshal(stored)
+	if err != nil {
+		return false, err
+	}
+
+	return true, json.Unmarshal(content, object)
+}
+
+func (c *fakeKubernetesClient) setObject(namespace string, kind string, name string, object interface{}) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.objects[objectKey(namespace, kind, name)] = object
+}
+
+func objectKey(namespace string, kind string, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+func (c *fakeKubernetesClient) GetNamespace(name string) (kubernetes.Namespace, bool, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	namespace, ok := c.namespaces[name]
+	return namespace, ok, nil
+}
+
+func (c *fakeKubernetesClient) CreateNamespace(namespace kubernetes.Namespace) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, ok := c.namespaces[namespace.Metadata.Name]; ok {
+		return fmt.Errorf("Error creating Namespace `%s`", namespace.Metadata.Name)
+	}
+	c.namespaces[namespace.Metadata.Name] = namespace
+
+	return nil
+}
+
+func (c *fakeKubernetesClient) DeleteNamespace(name string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.namespaces, name)
+
+	return nil
+}
+
+func (c *fakeKubernetesClient) hasNamespace(name string) bool {
+	_, ok, _ := c.GetNamespace(name)
+	return ok
+}
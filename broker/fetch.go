@@ -0,0 +1,177 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/pivotal-cf/brokerapi"
+
+	"github.com/frodenas/helm-osb/helm"
+	"github.com/frodenas/helm-osb/store"
+)
+
+// InstanceDetails is the response to a fetch instance request.
+type InstanceDetails struct {
+	ServiceID       string                      `json:"service_id,omitempty"`
+	PlanID          string                      `json:"plan_id,omitempty"`
+	DashboardURL    string                      `json:"dashboard_url,omitempty"`
+	Parameters      map[string]interface{}      `json:"parameters,omitempty"`
+	MaintenanceInfo *ServicePlanMaintenanceInfo `json:"maintenance_info,omitempty"`
+}
+
+// BindingDetails is the response to a fetch binding request.
+type BindingDetails struct {
+	Credentials map[string]interface{} `json:"credentials,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+}
+
+// GetInstance returns the plan, parameters and maintenance info recorded for
+// an instance. Instances being provisioned are not found yet, and instances
+// with an update or deprovision in progress cannot be fetched. Instances
+// provisioned before state was recorded are described from their release.
+func (b *Broker) GetInstance(ctx context.Context, instanceID string) (InstanceDetails, error) {
+	b.logger.Debug("get-instance-parameters", lager.Data{
+		contextLogKey:    ctx,
+		instanceIDLogKey: instanceID,
+	})
+
+	instanceDetails := InstanceDetails{}
+
+	instance, found, err := b.store.GetInstance(instanceID)
+	if err != nil {
+		return instanceDetails, err
+	}
+	if !found {
+		return b.releaseInstanceDetails(ctx, instanceID)
+	}
+
+	operation, found, err := store.LastOperation(b.store, instanceID)
+	if err != nil {
+		return instanceDetails, err
+	}
+	if found && operation.State == store.OperationInProgress {
+		if operation.Type == store.ProvisionOperation {
+			return instanceDetails, instanceNotFound(instanceID)
+		}
+		return instanceDetails, concurrencyError(operation)
+	}
+
+	instanceDetails.ServiceID = instance.ServiceID
+	instanceDetails.PlanID = instance.PlanID
+	instanceDetails.Parameters = instance.Parameters
+
+	if instance.MaintenanceInfoVersion != "" {
+		instanceDetails.MaintenanceInfo = &ServicePlanMaintenanceInfo{Version: instance.MaintenanceInfoVersion}
+		servicePlan, ok := b.config.Catalog.FindServicePlan(instance.ServiceID, instance.PlanID)
+		if currentMaintenanceInfo := servicePlan.CurrentMaintenanceInfo(); ok && currentMaintenanceInfo != nil && currentMaintenanceInfo.Version == instance.MaintenanceInfoVersion {
+			instanceDetails.MaintenanceInfo = currentMaintenanceInfo
+		}
+	}
+
+	b.logger.Debug("get-instance-response", lager.Data{
+		responseLogKey: instanceDetails,
+	})
+
+	return instanceDetails, nil
+}
+
+// releaseInstanceDetails describes an instance without state from the values
+// applied to its release. Plan values are told apart from user parameters
+// when a single plan of the catalog deploys the release chart, which then
+// gives the plan of the instance.
+func (b *Broker) releaseInstanceDetails(ctx context.Context, instanceID string) (InstanceDetails, error) {
+	instanceDetails := InstanceDetails{}
+
+	if err := b.checkOperationInProgress(instanceID); err != nil {
+		return instanceDetails, err
+	}
+
+	release := b.helmDriver.DefaultRelease(instanceID)
+
+	releaseCtx, cancel := context.WithTimeout(ctx, b.config.Timeouts.StatusTimeout())
+	defer cancel()
+
+	releaseValues, err := b.helmDriver.ReleaseValues(releaseCtx, release)
+	if err != nil {
+		if helm.Reason(err) == helm.ReasonReleaseNotFound {
+			return instanceDetails, instanceNotFound(instanceID)
+		}
+		return instanceDetails, helmFailureResponse(err)
+	}
+
+	history, err := b.helmDriver.ReleaseHistory(releaseCtx, release)
+	if err != nil {
+		return instanceDetails, helmFailureResponse(err)
+	}
+
+	var planValues *HelmChartValues
+	if len(history) > 0 {
+		if service, servicePlan, ok := b.config.Catalog.FindChartPlan(history[len(history)-1].Chart); ok {
+			instanceDetails.ServiceID = service.ID
+			instanceDetails.PlanID = servicePlan.ID
+			planValues = servicePlan.Metadata.Helm.Values
+		}
+	}
+	instanceDetails.Parameters = userValues(releaseValues, planValues)
+
+	b.logger.Debug("get-instance-response", lager.Data{
+		responseLogKey: instanceDetails,
+	})
+
+	return instanceDetails, nil
+}
+
+// GetBinding returns the parameters recorded for a binding and its
+// credentials, resolved against the live release of the instance.
+func (b *Broker) GetBinding(ctx context.Context, instanceID string, bindingID string) (BindingDetails, error) {
+	b.logger.Debug("get-binding-parameters", lager.Data{
+		contextLogKey:    ctx,
+		instanceIDLogKey: instanceID,
+		bindingIDLogKey:  bindingID,
+	})
+
+	bindingDetails := BindingDetails{}
+
+	binding, found, err := b.store.GetBinding(instanceID, bindingID)
+	if err != nil {
+		return bindingDetails, err
+	}
+	if !found {
+		return bindingDetails, brokerapi.NewFailureResponse(
+			fmt.Errorf("Binding `%s` for instance `%s` not found", bindingID, instanceID),
+			http.StatusNotFound,
+			"binding-not-found",
+		)
+	}
+
+	// Credentials follow the plan the instance is on now, which may have
+	// changed since the binding was created.
+	instance, found, err := b.store.GetInstance(instanceID)
+	if err != nil {
+		return bindingDetails, err
+	}
+	planID := binding.PlanID
+	if found {
+		planID = instance.PlanID
+	}
+
+	servicePlan, ok := b.config.Catalog.FindServicePlan(binding.ServiceID, planID)
+	if !ok {
+		return bindingDetails, fmt.Errorf("Plan `%s` for Service `%s` not found in Catalog", planID, binding.ServiceID)
+	}
+
+	credentials, err := b.bindingCredentials(ctx, servicePlan, instanceID, bindingID)
+	if err != nil {
+		return bindingDetails, err
+	}
+	bindingDetails.Credentials = credentials
+	bindingDetails.Parameters = binding.Parameters
+
+	b.logger.Debug("get-binding-response", lager.Data{
+		responseLogKey: bindingDetails,
+	})
+
+	return bindingDetails, nil
+}
@@ -0,0 +1,478 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/pivotal-cf/brokerapi"
+
+	"github.com/frodenas/helm-osb/store"
+	"github.com/frodenas/helm-osb/values"
+)
+
+const fleetUpgradeIDLogKey = "fleet-upgrade-id"
+
+// FleetUpgradeOptions selects the instances of a plan to upgrade onto the
+// chart version the plan currently asks for, and how to roll them out.
+type FleetUpgradeOptions struct {
+	ServiceID      string `json:"service_id"`
+	PlanID         string `json:"plan_id"`
+	BatchSize      int    `json:"batch_size,omitempty"`
+	Canaries       int    `json:"canaries,omitempty"`
+	PauseOnFailure bool   `json:"pause_on_failure,omitempty"`
+	DryRun         bool   `json:"dry_run,omitempty"`
+}
+
+func (o FleetUpgradeOptions) Validate() error {
+	if o.ServiceID == "" {
+		return errors.New("Must provide a non-empty Service ID")
+	}
+
+	if o.PlanID == "" {
+		return errors.New("Must provide a non-empty Plan ID")
+	}
+
+	if o.BatchSize < 0 {
+		return errors.New("Must provide a non-negative Batch Size")
+	}
+
+	if o.Canaries < 0 {
+		return errors.New("Must provide a non-negative number of Canaries")
+	}
+
+	return nil
+}
+
+func (o FleetUpgradeOptions) batchSize() int {
+	if o.BatchSize == 0 {
+		return 1
+	}
+
+	return o.BatchSize
+}
+
+type FleetUpgradeState string
+
+const (
+	FleetUpgradePlanned    FleetUpgradeState = "planned"
+	FleetUpgradeInProgress FleetUpgradeState = "in progress"
+	FleetUpgradePaused     FleetUpgradeState = "paused"
+	FleetUpgradeFinished   FleetUpgradeState = "finished"
+)
+
+type FleetInstanceState string
+
+const (
+	FleetInstancePending  FleetInstanceState = "pending"
+	FleetInstanceUpToDate FleetInstanceState = "up-to-date"
+	FleetInstanceSkipped  FleetInstanceState = "skipped"
+	FleetInstanceUpgraded FleetInstanceState = "upgraded"
+	FleetInstanceFailed   FleetInstanceState = "failed"
+)
+
+// FleetUpgradeReport records the progress and results of a fleet upgrade.
+type FleetUpgradeReport struct {
+	ID        string                     `json:"id"`
+	ServiceID string                     `json:"service_id"`
+	PlanID    string                     `json:"plan_id"`
+	Version   string                     `json:"version,omitempty"`
+	DryRun    bool                       `json:"dry_run,omitempty"`
+	State     FleetUpgradeState          `json:"state"`
+	Summary   map[FleetInstanceState]int `json:"summary"`
+	Instances []FleetInstanceResult      `json:"instances"`
+	CreatedAt time.Time                  `json:"created_at"`
+	UpdatedAt time.Time                  `json:"updated_at"`
+}
+
+// FleetInstanceResult is the outcome of a fleet upgrade for an instance.
+// Instances that do not need an upgrade are not assigned a batch.
+type FleetInstanceResult struct {
+	InstanceID  string             `json:"instance_id"`
+	Batch       int                `json:"batch,omitempty"`
+	Canary      bool               `json:"canary,omitempty"`
+	FromVersion string             `json:"from_version,omitempty"`
+	ToVersion   string             `json:"to_version,omitempty"`
+	State       FleetInstanceState `json:"state"`
+	OperationID string             `json:"operation_id,omitempty"`
+	Description string             `json:"description,omitempty"`
+}
+
+// FleetUpgrade is a planned fleet upgrade.
+type FleetUpgrade struct {
+	options     FleetUpgradeOptions
+	servicePlan ServicePlan
+	targets     []fleetTarget
+	mutex       sync.Mutex
+	report      FleetUpgradeReport
+}
+
+// fleetTarget is an instance to upgrade, as it was when the upgrade was
+// planned, with the chart version it is upgraded to.
+type fleetTarget struct {
+	result       int
+	batch        int
+	canary       bool
+	instance     store.Instance
+	chartVersion string
+}
+
+// Report returns a snapshot of the fleet upgrade report.
+func (f *FleetUpgrade) Report() FleetUpgradeReport {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	report := f.report
+	report.Instances = append([]FleetInstanceResult{}, f.report.Instances...)
+	report.Summary = map[FleetInstanceState]int{}
+	for _, result := range report.Instances {
+		report.Summary[result.State]++
+	}
+
+	return report
+}
+
+func (f *FleetUpgrade) setState(state FleetUpgradeState) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.report.State = state
+	f.report.UpdatedAt = time.Now().UTC()
+}
+
+func (f *FleetUpgrade) setResult(target fleetTarget, state FleetInstanceState, operationID string, description string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	result := &f.report.Instances[target.result]
+	result.State = state
+	result.Description = description
+	if operationID != "" {
+		result.OperationID = operationID
+	}
+	f.report.UpdatedAt = time.Now().UTC()
+}
+
+// PlanFleetUpgrade lists the instances of a plan and the chart version each
+// one would be upgraded to. Instances already on that version and on the plan
+// maintenance info version are up to date, so running the upgrade again
+// after a pause resumes where it stopped. Instances with an operation in
+// progress are skipped. The instances to upgrade are split in batches, oldest
+// first, the canaries going in a batch of their own.
+func (b *Broker) PlanFleetUpgrade(ctx context.Context, options FleetUpgradeOptions) (*FleetUpgrade, error) {
+	if err := options.Validate(); err != nil {
+		return nil, brokerapi.NewFailureResponse(err, http.StatusUnprocessableEntity, "invalid-fleet-upgrade-options")
+	}
+
+	servicePlan, ok := b.config.Catalog.FindServicePlan(options.ServiceID, options.PlanID)
+	if !ok {
+		return nil, brokerapi.NewFailureResponse(
+			fmt.Errorf("Plan `%s` for Service `%s` not found in Catalog", options.PlanID, options.ServiceID),
+			http.StatusUnprocessableEntity,
+			"invalid-fleet-upgrade-options",
+		)
+	}
+
+	id, err := newUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	instances, err := b.store.ListInstances()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(instances, func(i, j int) bool {
+		if instances[i].CreatedAt.Equal(instances[j].CreatedAt) {
+			return instances[i].ID < instances[j].ID
+		}
+		return instances[i].CreatedAt.Before(instances[j].CreatedAt)
+	})
+
+	now := time.Now().UTC()
+	fleetUpgrade := &FleetUpgrade{
+		options:     options,
+		servicePlan: servicePlan,
+		report: FleetUpgradeReport{
+			ID:        id,
+			ServiceID: options.ServiceID,
+			PlanID:    options.PlanID,
+			Version:   servicePlan.Metadata.Helm.Version,
+			DryRun:    options.DryRun,
+			State:     FleetUpgradePlanned,
+			Instances: []FleetInstanceResult{},
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+	}
+
+	for _, instance := range instances {
+		if instance.ServiceID != options.ServiceID || instance.PlanID != options.PlanID {
+			continue
+		}
+
+		result, target, err := b.planInstanceUpgrade(ctx, servicePlan, instance)
+		if err != nil {
+			return nil, err
+		}
+
+		fleetUpgrade.report.Instances = append(fleetUpgrade.report.Instances, result)
+		if target != nil {
+			target.result = len(fleetUpgrade.report.Instances) - 1
+			fleetUpgrade.targets = append(fleetUpgrade.targets, *target)
+		}
+	}
+
+	batch := 0
+	for i := range fleetUpgrade.targets {
+		target := &fleetUpgrade.targets[i]
+		target.canary = i < options.Canaries
+		if i == 0 || (!target.canary && (i-options.Canaries)%options.batchSize() == 0) {
+			batch++
+		}
+		target.batch = batch
+
+		result := &fleetUpgrade.report.Instances[target.result]
+		result.Batch = target.batch
+		result.Canary = target.canary
+	}
+
+	return fleetUpgrade, nil
+}
+
+func (b *Broker) planInstanceUpgrade(ctx context.Context, servicePlan ServicePlan, instance store.Instance) (FleetInstanceResult, *fleetTarget, error) {
+	result := FleetInstanceResult{
+		InstanceID:  instance.ID,
+		FromVersion: instance.ChartVersion,
+		State:       FleetInstancePending,
+	}
+
+	lastOperation, found, err := store.LastOperation(b.store, instance.ID)
+	if err != nil {
+		return result, nil, err
+	}
+	if found && lastOperation.State == store.OperationInProgress {
+		result.State = FleetInstanceSkipped
+		result.Description = fmt.Sprintf("Operation `%s` in progress", lastOperation.ID)
+		return result, nil, nil
+	}
+	if operationID, pending := b.workers.PendingOperation(instance.ID); pending {
+		result.State = FleetInstanceSkipped
+		result.Description = fmt.Sprintf("Operation `%s` in progress", operationID)
+		return result, nil, nil
+	}
+
+	maintenanceInfoVersion := instance.MaintenanceInfoVersion
+	chartVersion, err := b.chartVersion(ctx, servicePlan, &instance)
+	if err != nil {
+		result.State = FleetInstanceFailed
+		result.Description = err.Error()
+		return result, nil, nil
+	}
+	result.ToVersion = chartVersion
+
+	if chartVersion != "" && chartVersion == result.FromVersion && instance.MaintenanceInfoVersion == maintenanceInfoVersion {
+		result.State = FleetInstanceUpToDate
+		return result, nil, nil
+	}
+
+	if _, err := b.renderPlanValues(servicePlan, &instance); err != nil {
+		result.State = FleetInstanceFailed
+		result.Description = err.Error()
+		return result, nil, nil
+	}
+
+	return result, &fleetTarget{
+		instance:     instance,
+		chartVersion: chartVersion,
+	}, nil
+}
+
+// RunFleetUpgrade upgrades the planned instances batch by batch, each batch
+// waiting for the previous one to finish. The upgrade pauses after a failed
+// canary, or after any failed batch when asked to pause on failure, leaving
+// the remaining instances pending. progress is called with a snapshot of the
+// report every time an instance upgrade finishes.
+func (b *Broker) RunFleetUpgrade(fleetUpgrade *FleetUpgrade, progress func(FleetUpgradeReport)) FleetUpgradeReport {
+	logger := b.logger.Session("fleet-upgrade", lager.Data{
+		fleetUpgradeIDLogKey: fleetUpgrade.report.ID,
+	})
+
+	if progress == nil {
+		progress = func(FleetUpgradeReport) {}
+	}
+
+	fleetUpgrade.setState(FleetUpgradeInProgress)
+	progress(fleetUpgrade.Report())
+
+	targets := fleetUpgrade.targets
+	for start := 0; start < len(targets); {
+		end := start
+		for end < len(targets) && targets[end].batch == targets[start].batch {
+			end++
+		}
+
+		logger.Info("batch-started", lager.Data{"batch": targets[start].batch, "instances": end - start})
+		failed := b.runFleetBatch(fleetUpgrade, targets[start:end], progress)
+
+		if failed > 0 && (targets[start].canary || fleetUpgrade.options.PauseOnFailure) {
+			logger.Info("paused", lager.Data{"batch": targets[start].batch, "failed": failed})
+			fleetUpgrade.setState(FleetUpgradePaused)
+			report := fleetUpgrade.Report()
+			progress(report)
+			return report
+		}
+
+		start = end
+	}
+
+	fleetUpgrade.setState(FleetUpgradeFinished)
+	report := fleetUpgrade.Report()
+	progress(report)
+	return report
+}
+
+// runFleetBatch queues the upgrades of a batch on the worker pool and waits
+// for all of them to finish. It returns the number of failed upgrades.
+func (b *Broker) runFleetBatch(fleetUpgrade *FleetUpgrade, targets []fleetTarget, progress func(FleetUpgradeReport)) int {
+	type outcome struct {
+		target fleetTarget
+		err    error
+	}
+	outcomes := make(chan outcome, len(targets))
+
+	queued := 0
+	failed := 0
+	for _, target := range targets {
+		target := target
+		operation, skipped, err := b.startFleetTarget(fleetUpgrade, target, func(err error) {
+			outcomes <- outcome{target: target, err: err}
+		})
+		switch {
+		case err != nil:
+			failed++
+			fleetUpgrade.setResult(target, FleetInstanceFailed, operation.ID, err.Error())
+			progress(fleetUpgrade.Report())
+		case skipped != "":
+			fleetUpgrade.setResult(target, FleetInstanceSkipped, "", skipped)
+			progress(fleetUpgrade.Report())
+		default:
+			queued++
+			fleetUpgrade.setResult(target, FleetInstancePending, operation.ID, "Upgrade queued")
+		}
+	}
+
+	for ; queued > 0; queued-- {
+		outcome := <-outcomes
+		if outcome.err != nil {
+			failed++
+			fleetUpgrade.setResult(outcome.target, FleetInstanceFailed, "", outcome.err.Error())
+		} else {
+			fleetUpgrade.setResult(outcome.target, FleetInstanceUpgraded, "", "")
+		}
+		progress(fleetUpgrade.Report())
+	}
+
+	return failed
+}
+
+// startFleetTarget queues the upgrade of an instance, calling done with its
+// outcome. The instance is read again, so that changes made since the fleet
+// upgrade was planned are kept, and only the chart version planned for it is
+// applied. Instances that are gone, moved to another plan or have an
+// operation in progress are skipped, and the reason is returned.
+func (b *Broker) startFleetTarget(fleetUpgrade *FleetUpgrade, target fleetTarget, done func(error)) (store.Operation, string, error) {
+	servicePlan := fleetUpgrade.servicePlan
+	timeout := b.timeouts(servicePlan).UpgradeTimeout()
+
+	unlock := b.locks.Lock(target.instance.ID)
+	defer unlock()
+
+	instance, found, err := b.store.GetInstance(target.instance.ID)
+	if err != nil {
+		return store.Operation{}, "", err
+	}
+	if !found {
+		return store.Operation{}, "Instance no longer exists", nil
+	}
+	if instance.ServiceID != fleetUpgrade.options.ServiceID || instance.PlanID != fleetUpgrade.options.PlanID {
+		return store.Operation{}, fmt.Sprintf("Instance moved to plan `%s`", instance.PlanID), nil
+	}
+	if operationID, pending := b.workers.PendingOperation(instance.ID); pending {
+		return store.Operation{}, fmt.Sprintf("Operation `%s` in progress", operationID), nil
+	}
+	// Operations started by another broker process, such as the one serving
+	// the platform while the upgrade-fleet command runs, are only recorded
+	// in the store.
+	storedOperation, inProgress, err := b.storedOperationInProgress(instance.ID)
+	if err != nil {
+		return store.Operation{}, "", err
+	}
+	if inProgress {
+		return store.Operation{}, fmt.Sprintf("Operation `%s` in progress", storedOperation.ID), nil
+	}
+
+	instance.ChartVersion = target.instance.ChartVersion
+	instance.ChartConstraint = target.instance.ChartConstraint
+	instance.MaintenanceInfoVersion = target.instance.MaintenanceInfoVersion
+
+	renderedPlanValues, err := b.renderPlanValues(servicePlan, &instance)
+	if err != nil {
+		return store.Operation{}, "", err
+	}
+	upgradeValues := values.Merge(renderedPlanValues, instance.Parameters)
+
+	operation, err := b.startOperation(instance.ID, store.UpgradeOperation, timeout, func(ctx context.Context) (err error) {
+		// The fleet upgrade waits for done, which must be called even if the
+		// upgrade panics.
+		completed := false
+		defer func() {
+			if !completed {
+				err = errors.New("Upgrade aborted")
+			}
+			done(err)
+		}()
+
+		upgraded, err := b.upgradeRelease(ctx, instance.ID, b.release(instance), servicePlan, target.chartVersion, upgradeValues, timeout)
+		if upgraded {
+			instance.UpdatedAt = time.Now().UTC()
+			if saveErr := b.store.SaveInstance(instance); saveErr != nil && err == nil {
+				err = saveErr
+			}
+		}
+
+		completed = true
+		return err
+	})
+
+	return operation, "", err
+}
+
+// storedOperationInProgress returns the most recent operation of any type
+// recorded as in progress for an instance.
+func (b *Broker) storedOperationInProgress(instanceID string) (store.Operation, bool, error) {
+	operations, err := b.store.ListOperations(instanceID)
+	if err != nil {
+		return store.Operation{}, false, err
+	}
+
+	operation := store.Operation{}
+	found := false
+	for _, op := range operations {
+		if op.State != store.OperationInProgress {
+			continue
+		}
+		if !found || op.CreatedAt.After(operation.CreatedAt) {
+			operation = op
+			found = true
+		}
+	}
+
+	return operation, found, nil
+}
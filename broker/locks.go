@@ -0,0 +1,47 @@
+package broker
+
+import (
+	"sync"
+)
+
+// instanceLocks serializes the requests that start operations on the same
+// instance, so that checking for an operation in progress and starting a new
+// one cannot interleave.
+type instanceLocks struct {
+	mutex sync.Mutex
+	locks map[string]*instanceLock
+}
+
+type instanceLock struct {
+	sync.Mutex
+	waiters int
+}
+
+func newInstanceLocks() *instanceLocks {
+	return &instanceLocks{locks: map[string]*instanceLock{}}
+}
+
+// Lock locks an instance and returns the function that unlocks it.
+func (l *instanceLocks) Lock(instanceID string) func() {
+	l.mutex.Lock()
+	lock, ok := l.locks[instanceID]
+	if !ok {
+		lock = &instanceLock{}
+		l.locks[instanceID] = lock
+	}
+	lock.waiters++
+	l.mutex.Unlock()
+
+	lock.Lock()
+
+	return func() {
+		lock.Unlock()
+
+		l.mutex.Lock()
+		lock.waiters--
+		if lock.waiters == 0 {
+			delete(l.locks, instanceID)
+		}
+		l.mutex.Unlock()
+	}
+}
@@ -0,0 +1,42 @@
+package broker
+
+import (
+	"context"
+)
+
+type maintenanceInfoKey struct{}
+
+// MaintenanceInfoFrom returns the maintenance info of a request, if any.
+func MaintenanceInfoFrom(ctx context.Context) (ServicePlanMaintenanceInfo, bool) {
+	maintenanceInfo, ok := ctx.Value(maintenanceInfoKey{}).(ServicePlanMaintenanceInfo)
+	return maintenanceInfo, ok
+}
+
+// WithMaintenanceInfo returns a copy of ctx carrying the maintenance info.
+func WithMaintenanceInfo(ctx context.Context, maintenanceInfo ServicePlanMaintenanceInfo) context.Context {
+	return context.WithValue(ctx, maintenanceInfoKey{}, maintenanceInfo)
+}
+
+// checkMaintenanceInfo returns an error if a request carries a maintenance
+// info version other than the current one of the plan. Requests without
+// maintenance info are not checked.
+func checkMaintenanceInfo(ctx context.Context, servicePlan ServicePlan) error {
+	maintenanceInfo, ok := MaintenanceInfoFrom(ctx)
+	if !ok {
+		return nil
+	}
+
+	currentMaintenanceInfo := servicePlan.CurrentMaintenanceInfo()
+	if currentMaintenanceInfo == nil {
+		if maintenanceInfo.Version == "" {
+			return nil
+		}
+		return ErrMaintenanceInfoNilConflict
+	}
+
+	if maintenanceInfo.Version != currentMaintenanceInfo.Version {
+		return ErrMaintenanceInfoConflict
+	}
+
+	return nil
+}
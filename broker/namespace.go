@@ -0,0 +1,123 @@
+package broker
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/frodenas/helm-osb/kubernetes"
+	"github.com/frodenas/helm-osb/store"
+)
+
+const (
+	SharedNamespaceStrategy      = "shared"
+	PerInstanceNamespaceStrategy = "per-instance"
+	TemplateNamespaceStrategy    = "template"
+	PlatformNamespaceStrategy    = "platform"
+
+	instanceNamespacePrefix = "helm-osb-"
+	maxNamespaceLength      = 63
+
+	namespaceManagedByLabel  = "app.kubernetes.io/managed-by"
+	namespaceManagedByValue  = "helm-osb"
+	namespaceInstanceIDLabel = "helm-osb/instance-id"
+)
+
+var invalidNamespaceChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+type NamespacesClient interface {
+	GetNamespace(name string) (kubernetes.Namespace, bool, error)
+	CreateNamespace(namespace kubernetes.Namespace) error
+	DeleteNamespace(name string) error
+}
+
+// NamespaceConfig sets where the releases of an instance are deployed:
+// the shared Helm default namespace, a namespace per instance, a namespace
+// named after a Go template over NamespaceData, or the namespace of the
+// Kubernetes platform requesting the instance.
+type NamespaceConfig struct {
+	Strategy string `json:"strategy,omitempty"`
+	Template string `json:"template,omitempty"`
+}
+
+type NamespaceData struct {
+	InstanceID       string
+	OrganizationGUID string
+	SpaceGUID        string
+	ServiceID        string
+	ServiceName      string
+	PlanID           string
+	PlanName         string
+	Context          store.PlatformContext
+}
+
+func (nc NamespaceConfig) Validate() error {
+	switch nc.Strategy {
+	case "", SharedNamespaceStrategy, PerInstanceNamespaceStrategy, PlatformNamespaceStrategy:
+	case TemplateNamespaceStrategy:
+		if nc.Template == "" {
+			return fmt.Errorf("Must provide a non-empty Template for the `%s` strategy", TemplateNamespaceStrategy)
+		}
+
+		if _, err := template.New("namespace").Parse(nc.Template); err != nil {
+			return fmt.Errorf("Error parsing Template: %s", err)
+		}
+	default:
+		return fmt.Errorf("Namespace Strategy `%s` not supported", nc.Strategy)
+	}
+
+	return nil
+}
+
+// IsManaged reports whether the broker creates the namespaces of the
+// strategy. The shared default namespace and the platform namespaces are
+// never created nor deleted by the broker.
+func (nc NamespaceConfig) IsManaged() bool {
+	return nc.Strategy == PerInstanceNamespaceStrategy || nc.Strategy == TemplateNamespaceStrategy
+}
+
+// Resolve returns the namespace name for an instance.
+func (nc NamespaceConfig) Resolve(data NamespaceData, defaultNamespace string) (string, error) {
+	switch nc.Strategy {
+	case PerInstanceNamespaceStrategy:
+		return namespaceName(instanceNamespacePrefix + data.InstanceID)
+	case TemplateNamespaceStrategy:
+		tmpl, err := template.New("namespace").Option("missingkey=error").Parse(nc.Template)
+		if err != nil {
+			return "", fmt.Errorf("Error parsing namespace template: %s", err)
+		}
+
+		var name bytes.Buffer
+		if err := tmpl.Execute(&name, data); err != nil {
+			return "", fmt.Errorf("Error executing namespace template: %s", err)
+		}
+
+		return namespaceName(name.String())
+	case PlatformNamespaceStrategy:
+		if data.Context.Platform != KubernetesPlatform || data.Context.Namespace == "" {
+			return "", errors.New("The plan requires a Kubernetes platform context with a namespace")
+		}
+
+		return data.Context.Namespace, nil
+	default:
+		return defaultNamespace, nil
+	}
+}
+
+// namespaceName turns a string into a valid DNS-1123 label.
+func namespaceName(name string) (string, error) {
+	namespace := invalidNamespaceChars.ReplaceAllString(strings.ToLower(name), "-")
+	if len(namespace) > maxNamespaceLength {
+		namespace = namespace[:maxNamespaceLength]
+	}
+	namespace = strings.Trim(namespace, "-")
+
+	if namespace == "" {
+		return "", fmt.Errorf("Namespace name `%s` is not valid", name)
+	}
+
+	return namespace, nil
+}
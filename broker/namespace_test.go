@@ -0,0 +1,104 @@
+package broker_test
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/frodenas/helm-osb/broker"
+	"github.com/frodenas/helm-osb/store"
+)
+
+var _ = Describe("NamespaceConfig", func() {
+	var data = NamespaceData{
+		InstanceID:       "Fake-Instance-ID",
+		OrganizationGUID: "fake-org-guid",
+		SpaceGUID:        "fake-space-guid",
+		ServiceName:      "fake_service",
+		PlanName:         "fake.plan",
+	}
+
+	Describe("Validate", func() {
+		It("does not return error for the supported strategies", func() {
+			Expect(NamespaceConfig{}.Validate()).To(Succeed())
+			Expect(NamespaceConfig{Strategy: SharedNamespaceStrategy}.Validate()).To(Succeed())
+			Expect(NamespaceConfig{Strategy: PerInstanceNamespaceStrategy}.Validate()).To(Succeed())
+			Expect(NamespaceConfig{Strategy: PlatformNamespaceStrategy}.Validate()).To(Succeed())
+			Expect(NamespaceConfig{Strategy: TemplateNamespaceStrategy, Template: "{{ .SpaceGUID }}"}.Validate()).To(Succeed())
+		})
+
+		It("returns error if the strategy is not supported", func() {
+			err := NamespaceConfig{Strategy: "fake-strategy"}.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Namespace Strategy `fake-strategy` not supported"))
+		})
+
+		It("returns error if the template is empty", func() {
+			err := NamespaceConfig{Strategy: TemplateNamespaceStrategy}.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Must provide a non-empty Template for the `template` strategy"))
+		})
+
+		It("returns error if the template is not valid", func() {
+			err := NamespaceConfig{Strategy: TemplateNamespaceStrategy, Template: "{{ .SpaceGUID"}.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(HavePrefix("Error parsing Template"))
+		})
+	})
+
+	Describe("Resolve", func() {
+		It("returns the default namespace for the shared strategy", func() {
+			namespace, err := NamespaceConfig{}.Resolve(data, "fake-namespace")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(namespace).To(Equal("fake-namespace"))
+		})
+
+		It("returns a namespace per instance", func() {
+			namespace, err := NamespaceConfig{Strategy: PerInstanceNamespaceStrategy}.Resolve(data, "fake-namespace")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(namespace).To(Equal("helm-osb-fake-instance-id"))
+		})
+
+		It("returns a valid namespace from the template", func() {
+			config := NamespaceConfig{Strategy: TemplateNamespaceStrategy, Template: "{{ .ServiceName }}-{{ .PlanName }}-{{ .SpaceGUID }}"}
+			namespace, err := config.Resolve(data, "fake-namespace")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(namespace).To(Equal("fake-service-fake-plan-fake-space-guid"))
+		})
+
+		It("truncates long namespaces", func() {
+			config := NamespaceConfig{Strategy: TemplateNamespaceStrategy, Template: strings.Repeat("a", 70)}
+			namespace, err := config.Resolve(data, "fake-namespace")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(namespace).To(HaveLen(63))
+		})
+
+		It("returns the namespace of the Kubernetes platform context", func() {
+			data := data
+			data.Context = store.PlatformContext{Platform: KubernetesPlatform, Namespace: "consumer-namespace"}
+
+			namespace, err := NamespaceConfig{Strategy: PlatformNamespaceStrategy}.Resolve(data, "fake-namespace")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(namespace).To(Equal("consumer-namespace"))
+		})
+
+		It("returns error if there is no Kubernetes platform namespace", func() {
+			_, err := NamespaceConfig{Strategy: PlatformNamespaceStrategy}.Resolve(data, "fake-namespace")
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("returns error if the template refers to unknown fields", func() {
+			config := NamespaceConfig{Strategy: TemplateNamespaceStrategy, Template: "{{ .Unknown }}"}
+			_, err := config.Resolve(data, "fake-namespace")
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("returns error if the namespace is empty", func() {
+			config := NamespaceConfig{Strategy: TemplateNamespaceStrategy, Template: "---"}
+			_, err := config.Resolve(data, "fake-namespace")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Namespace name `---` is not valid"))
+		})
+	})
+})
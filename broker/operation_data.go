@@ -0,0 +1,45 @@
+package broker
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/frodenas/helm-osb/store"
+)
+
+// OperationData identifies an asynchronous operation between the response
+// that started it and the last_operation polls that follow.
+type OperationData struct {
+	Type store.OperationType
+	ID   string
+}
+
+func NewOperationData(operation store.Operation) OperationData {
+	return OperationData{
+		Type: operation.Type,
+		ID:   operation.ID,
+	}
+}
+
+func (od OperationData) String() string {
+	return fmt.Sprintf("%s:%s", od.Type, od.ID)
+}
+
+func ParseOperationData(data string) (OperationData, error) {
+	parts := strings.SplitN(data, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return OperationData{}, fmt.Errorf("Invalid operation data `%s`", data)
+	}
+
+	operationType := store.OperationType(parts[0])
+	switch operationType {
+	case store.ProvisionOperation, store.UpdateOperation, store.DeprovisionOperation:
+	default:
+		return OperationData{}, fmt.Errorf("Invalid operation type `%s`", parts[0])
+	}
+
+	return OperationData{
+		Type: operationType,
+		ID:   parts[1],
+	}, nil
+}
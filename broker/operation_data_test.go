@@ -0,0 +1,46 @@
+package broker_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/frodenas/helm-osb/broker"
+	"github.com/frodenas/helm-osb/store"
+)
+
+var _ = Describe("OperationData", func() {
+	It("encodes the operation type and ID", func() {
+		operationData := NewOperationData(store.Operation{
+			ID:   "fake-operation-id",
+			Type: store.DeprovisionOperation,
+		})
+
+		Expect(operationData.String()).To(Equal("deprovision:fake-operation-id"))
+	})
+
+	Describe("ParseOperationData", func() {
+		It("returns the operation type and ID", func() {
+			operationData, err := ParseOperationData("update:fake-operation-id")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(operationData).To(Equal(OperationData{
+				Type: store.UpdateOperation,
+				ID:   "fake-operation-id",
+			}))
+		})
+
+		It("returns error if the operation ID is missing", func() {
+			_, err := ParseOperationData("provision:")
+			Expect(err).To(MatchError("Invalid operation data `provision:`"))
+		})
+
+		It("returns error if the operation data is not valid", func() {
+			_, err := ParseOperationData("fake-operation-id")
+			Expect(err).To(MatchError("Invalid operation data `fake-operation-id`"))
+		})
+
+		It("returns error if the operation type is not valid", func() {
+			_, err := ParseOperationData("backup:fake-operation-id")
+			Expect(err).To(MatchError("Invalid operation type `backup`"))
+		})
+	})
+})
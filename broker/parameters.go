@@ -1,7 +1,112 @@
 package broker
 
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pivotal-cf/brokerapi"
+
+	"github.com/frodenas/helm-osb/schema"
+	"github.com/frodenas/helm-osb/values"
+)
+
 type ProvisionParameters map[string]interface{}
 
 type UpdateParameters map[string]interface{}
 
 type BindParameters map[string]interface{}
+
+// userValues returns the release values that were not set by the plan the
+// release was installed or last upgraded with.
+func userValues(releaseValues map[string]interface{}, planValues *HelmChartValues) map[string]interface{} {
+	if planValues == nil {
+		return values.Copy(releaseValues)
+	}
+
+	return values.Diff(releaseValues, *planValues)
+}
+
+func planValues(servicePlan ServicePlan) map[string]interface{} {
+	if servicePlan.Metadata.Helm.Values == nil {
+		return map[string]interface{}{}
+	}
+
+	return values.Copy(*servicePlan.Metadata.Helm.Values)
+}
+
+// sameParameters reports whether two sets of user parameters are identical.
+func sameParameters(a map[string]interface{}, b map[string]interface{}) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+
+	return values.Equivalent(a, b)
+}
+
+// parseParameters decodes the parameters supplied by the user and checks
+// them against the plan parameters schema, if any. The schema is checked
+// against the values tree after dotted keys are expanded, as that is what
+// Helm receives.
+func parseParameters(parametersSchema json.RawMessage, rawParameters json.RawMessage) (map[string]interface{}, error) {
+	parameters, err := values.Parse(rawParameters)
+	if err != nil {
+		return nil, brokerapi.ErrRawParamsInvalid
+	}
+
+	if err := validateParameters(parametersSchema, parameters); err != nil {
+		return nil, err
+	}
+
+	return parameters, nil
+}
+
+// validateParameters checks a values tree against the plan parameters
+// schema, if any.
+func validateParameters(parametersSchema json.RawMessage, parameters map[string]interface{}) error {
+	if len(parametersSchema) == 0 {
+		return nil
+	}
+
+	compiledSchema, err := schema.Compile(parametersSchema)
+	if err != nil {
+		return err
+	}
+
+	// Round trip the values so the schema sees plain JSON types.
+	content, err := json.Marshal(parameters)
+	if err != nil {
+		return brokerapi.ErrRawParamsInvalid
+	}
+
+	violations, err := compiledSchema.ValidateJSON(content)
+	if err != nil {
+		return brokerapi.ErrRawParamsInvalid
+	}
+
+	if len(violations) > 0 {
+		return brokerapi.NewFailureResponse(
+			fmt.Errorf("Invalid parameters: %s", strings.Join(violations, "; ")),
+			http.StatusBadRequest,
+			"invalid-parameters",
+		)
+	}
+
+	return nil
+}
+
+// checkAllowedParameters rejects user parameters setting chart values locked
+// by the plan.
+func checkAllowedParameters(helmConfig HelmConfig, parameters map[string]interface{}) error {
+	forbidden := helmConfig.ForbiddenParameters(parameters)
+	if len(forbidden) > 0 {
+		return brokerapi.NewFailureResponse(
+			fmt.Errorf("Parameters not allowed by the plan: %s", strings.Join(forbidden, ", ")),
+			http.StatusBadRequest,
+			"parameters-not-allowed",
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package broker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/frodenas/helm-osb/store"
+)
+
+const (
+	KubernetesPlatform   = "kubernetes"
+	CloudFoundryPlatform = "cloudfoundry"
+)
+
+type platformContextKey struct{}
+
+// requestFieldsHandler reads the OSB context object and maintenance info from
+// provision and update requests, as brokerapi does not decode them, and makes
+// them available to the broker through the request context.
+func requestFieldsHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPut && req.Method != http.MethodPatch {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		var details struct {
+			Context         *store.PlatformContext      `json:"context,omitempty"`
+			MaintenanceInfo *ServicePlanMaintenanceInfo `json:"maintenance_info,omitempty"`
+		}
+		// Malformed bodies are reported by the request handlers.
+		if err := json.Unmarshal(body, &details); err == nil {
+			if details.Context != nil {
+				req = req.WithContext(WithPlatformContext(req.Context(), *details.Context))
+			}
+			if details.MaintenanceInfo != nil {
+				req = req.WithContext(WithMaintenanceInfo(req.Context(), *details.MaintenanceInfo))
+			}
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+// PlatformContextFrom returns the platform context of a request, if any.
+func PlatformContextFrom(ctx context.Context) (store.PlatformContext, bool) {
+	platformContext, ok := ctx.Value(platformContextKey{}).(store.PlatformContext)
+	return platformContext, ok
+}
+
+// WithPlatformContext returns a copy of ctx carrying the platform context.
+func WithPlatformContext(ctx context.Context, platformContext store.PlatformContext) context.Context {
+	return context.WithValue(ctx, platformContextKey{}, platformContext)
+}
@@ -0,0 +1,131 @@
+package broker
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/frodenas/helm-osb/helm"
+	"github.com/frodenas/helm-osb/kubernetes"
+)
+
+const readinessPollInterval = 5 * time.Second
+
+type ObjectsClient interface {
+	GetObject(namespace string, kind string, name string, object interface{}) (bool, error)
+}
+
+// KubernetesClient is the Kubernetes API the broker needs besides Helm.
+type KubernetesClient interface {
+	NamespacesClient
+	ObjectsClient
+}
+
+// readiness counts the ready workloads of a release.
+type readiness struct {
+	pods         int
+	readyPods    int
+	jobs         int
+	completeJobs int
+	claims       int
+	boundClaims  int
+}
+
+func (r readiness) Ready() bool {
+	return r.readyPods == r.pods && r.completeJobs == r.jobs && r.boundClaims == r.claims
+}
+
+func (r readiness) String() string {
+	progress := []string{}
+	if r.pods > 0 {
+		progress = append(progress, fmt.Sprintf("%d/%d pods ready", r.readyPods, r.pods))
+	}
+	if r.jobs > 0 {
+		progress = append(progress, fmt.Sprintf("%d/%d jobs complete", r.completeJobs, r.jobs))
+	}
+	if r.claims > 0 {
+		progress = append(progress, fmt.Sprintf("%d/%d volume claims bound", r.boundClaims, r.claims))
+	}
+
+	return strings.Join(progress, ", ")
+}
+
+// releaseReadiness inspects the Deployments, StatefulSets, Jobs and
+// PersistentVolumeClaims of a release manifest. Objects not created yet count
+// as not ready.
+func releaseReadiness(client ObjectsClient, manifest helm.Manifest) (readiness, error) {
+	r := readiness{}
+
+	for _, resource := range manifest {
+		namespace, name := resource.Metadata.Namespace, resource.Metadata.Name
+
+		switch resource.Kind {
+		case "Deployment":
+			deployment := kubernetes.Deployment{}
+			found, err := client.GetObject(namespace, "deployment", name, &deployment)
+			if err != nil {
+				return r, err
+			}
+
+			replicas := desiredReplicas(deployment.Spec.Replicas)
+			r.pods += replicas
+			if found {
+				r.readyPods += minInt(replicas, deployment.Status.ReadyReplicas, deployment.Status.UpdatedReplicas)
+			}
+		case "StatefulSet":
+			statefulSet := kubernetes.StatefulSet{}
+			found, err := client.GetObject(namespace, "statefulset", name, &statefulSet)
+			if err != nil {
+				return r, err
+			}
+
+			replicas := desiredReplicas(statefulSet.Spec.Replicas)
+			r.pods += replicas
+			if found {
+				r.readyPods += minInt(replicas, statefulSet.Status.ReadyReplicas)
+			}
+		case "Job":
+			job := kubernetes.Job{}
+			found, err := client.GetObject(namespace, "job", name, &job)
+			if err != nil {
+				return r, err
+			}
+
+			r.jobs++
+			if found && job.Status.Succeeded >= desiredReplicas(job.Spec.Completions) {
+				r.completeJobs++
+			}
+		case "PersistentVolumeClaim":
+			claim := kubernetes.PersistentVolumeClaim{}
+			found, err := client.GetObject(namespace, "persistentvolumeclaim", name, &claim)
+			if err != nil {
+				return r, err
+			}
+
+			r.claims++
+			if found && claim.Status.Phase == "Bound" {
+				r.boundClaims++
+			}
+		}
+	}
+
+	return r, nil
+}
+
+func desiredReplicas(replicas *int) int {
+	if replicas == nil {
+		return 1
+	}
+
+	return *replicas
+}
+
+func minInt(value int, values ...int) int {
+	for _, v := range values {
+		if v < value {
+			value = v
+		}
+	}
+
+	return value
+}
@@ -0,0 +1,73 @@
+package broker
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	defaultInstallTimeout = 10 * time.Minute
+	defaultUpgradeTimeout = 10 * time.Minute
+	defaultDeleteTimeout  = 5 * time.Minute
+	defaultStatusTimeout  = 1 * time.Minute
+)
+
+// Timeouts sets, in seconds, how long each kind of Helm command may run
+// before it is cancelled. Status applies to every read-only release query.
+// Zero values fall back to the defaults.
+type Timeouts struct {
+	Install int `json:"install,omitempty"`
+	Upgrade int `json:"upgrade,omitempty"`
+	Delete  int `json:"delete,omitempty"`
+	Status  int `json:"status,omitempty"`
+}
+
+func (t Timeouts) Validate() error {
+	if t.Install < 0 || t.Upgrade < 0 || t.Delete < 0 || t.Status < 0 {
+		return errors.New("Must provide non-negative Timeouts")
+	}
+
+	return nil
+}
+
+// Merge returns the timeouts with the non-zero values of override applied.
+func (t Timeouts) Merge(override Timeouts) Timeouts {
+	if override.Install != 0 {
+		t.Install = override.Install
+	}
+	if override.Upgrade != 0 {
+		t.Upgrade = override.Upgrade
+	}
+	if override.Delete != 0 {
+		t.Delete = override.Delete
+	}
+	if override.Status != 0 {
+		t.Status = override.Status
+	}
+
+	return t
+}
+
+func (t Timeouts) InstallTimeout() time.Duration {
+	return timeout(t.Install, defaultInstallTimeout)
+}
+
+func (t Timeouts) UpgradeTimeout() time.Duration {
+	return timeout(t.Upgrade, defaultUpgradeTimeout)
+}
+
+func (t Timeouts) DeleteTimeout() time.Duration {
+	return timeout(t.Delete, defaultDeleteTimeout)
+}
+
+func (t Timeouts) StatusTimeout() time.Duration {
+	return timeout(t.Status, defaultStatusTimeout)
+}
+
+func timeout(seconds int, defaultTimeout time.Duration) time.Duration {
+	if seconds == 0 {
+		return defaultTimeout
+	}
+
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,48 @@
+package broker_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/frodenas/helm-osb/broker"
+)
+
+var _ = Describe("Timeouts", func() {
+	Describe("Validate", func() {
+		It("does not return error if all timeouts are valid", func() {
+			err := Timeouts{Install: 60}.Validate()
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("returns error if a timeout is negative", func() {
+			err := Timeouts{Status: -1}.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Must provide non-negative Timeouts"))
+		})
+	})
+
+	Describe("Merge", func() {
+		It("overrides the non-zero timeouts", func() {
+			timeouts := Timeouts{Install: 60, Upgrade: 120}.Merge(Timeouts{Upgrade: 300, Delete: 30})
+			Expect(timeouts).To(Equal(Timeouts{Install: 60, Upgrade: 300, Delete: 30}))
+		})
+	})
+
+	It("returns the default timeouts if not set", func() {
+		timeouts := Timeouts{}
+		Expect(timeouts.InstallTimeout()).To(Equal(10 * time.Minute))
+		Expect(timeouts.UpgradeTimeout()).To(Equal(10 * time.Minute))
+		Expect(timeouts.DeleteTimeout()).To(Equal(5 * time.Minute))
+		Expect(timeouts.StatusTimeout()).To(Equal(1 * time.Minute))
+	})
+
+	It("returns the configured timeouts", func() {
+		timeouts := Timeouts{Install: 1, Upgrade: 2, Delete: 3, Status: 4}
+		Expect(timeouts.InstallTimeout()).To(Equal(1 * time.Second))
+		Expect(timeouts.UpgradeTimeout()).To(Equal(2 * time.Second))
+		Expect(timeouts.DeleteTimeout()).To(Equal(3 * time.Second))
+		Expect(timeouts.StatusTimeout()).To(Equal(4 * time.Second))
+	})
+})
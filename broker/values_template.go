@@ -0,0 +1,209 @@
+package broker
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/frodenas/helm-osb/store"
+)
+
+const passwordChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// ValuesData holds the fields available to plan values templates.
+type ValuesData struct {
+	InstanceID       string
+	ReleaseName      string
+	Namespace        string
+	OrganizationGUID string
+	SpaceGUID        string
+	ServiceID        string
+	ServiceName      string
+	PlanID           string
+	PlanName         string
+	Context          store.PlatformContext
+}
+
+// renderValues executes the templates found in the string values. Random
+// values are looked up in generated by value path and call order, and the
+// ones not found are generated and added to it, so rendering the same values
+// again returns the same result.
+func renderValues(planValues map[string]interface{}, data ValuesData, generated map[string]string) (map[string]interface{}, error) {
+	rendered, err := renderValue("", planValues, data, generated)
+	if err != nil {
+		return nil, err
+	}
+
+	return rendered.(map[string]interface{}), nil
+}
+
+// validateValuesTemplates checks that the templates found in the string
+// values can be parsed.
+func validateValuesTemplates(planValues map[string]interface{}) error {
+	return walkStrings("", planValues, func(path string, value string) error {
+		if _, err := template.New(path).Funcs(valuesFuncs(path, nil)).Parse(value); err != nil {
+			return fmt.Errorf("Error parsing template for value `%s`: %s", path, err)
+		}
+		return nil
+	})
+}
+
+func renderValue(path string, value interface{}, data ValuesData, generated map[string]string) (interface{}, error) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		rendered := map[string]interface{}{}
+		for k, v := range value {
+			renderedValue, err := renderValue(joinPath(path, k), v, data, generated)
+			if err != nil {
+				return nil, err
+			}
+			rendered[k] = renderedValue
+		}
+		return rendered, nil
+	case []interface{}:
+		rendered := make([]interface{}, len(value))
+		for i, v := range value {
+			renderedValue, err := renderValue(fmt.Sprintf("%s[%d]", path, i), v, data, generated)
+			if err != nil {
+				return nil, err
+			}
+			rendered[i] = renderedValue
+		}
+		return rendered, nil
+	case string:
+		if !strings.Contains(value, "{{") {
+			return value, nil
+		}
+
+		tmpl, err := template.New(path).Funcs(valuesFuncs(path, generated)).Option("missingkey=error").Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing template for value `%s`: %s", path, err)
+		}
+
+		var rendered bytes.Buffer
+		if err := tmpl.Execute(&rendered, data); err != nil {
+			return nil, fmt.Errorf("Error rendering template for value `%s`: %s", path, err)
+		}
+		return rendered.String(), nil
+	default:
+		return value, nil
+	}
+}
+
+func walkStrings(path string, value interface{}, fn func(path string, value string) error) error {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for k := range value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			if err := walkStrings(joinPath(path, k), value[k], fn); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for i, v := range value {
+			if err := walkStrings(fmt.Sprintf("%s[%d]", path, i), v, fn); err != nil {
+				return err
+			}
+		}
+	case string:
+		return fn(path, value)
+	}
+
+	return nil
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+func valuesFuncs(path string, generated map[string]string) template.FuncMap {
+	calls := 0
+	memoize := func(generate func() (string, error)) (string, error) {
+		key := fmt.Sprintf("%s#%d", path, calls)
+		calls++
+
+		if value, ok := generated[key]; ok {
+			return value, nil
+		}
+
+		value, err := generate()
+		if err != nil {
+			return "", err
+		}
+		if generated != nil {
+			generated[key] = value
+		}
+
+		return value, nil
+	}
+
+	return template.FuncMap{
+		"randomPassword": func(length int) (string, error) {
+			return memoize(func() (string, error) { return randomPassword(length) })
+		},
+		"uuid": func() (string, error) {
+			return memoize(newUUID)
+		},
+		"b64enc": func(value string) string {
+			return base64.StdEncoding.EncodeToString([]byte(value))
+		},
+		"b64dec": func(value string) (string, error) {
+			decoded, err := base64.StdEncoding.DecodeString(value)
+			return string(decoded), err
+		},
+		"sha1sum": func(value string) string {
+			sum := sha1.Sum([]byte(value))
+			return hex.EncodeToString(sum[:])
+		},
+		"sha256sum": func(value string) string {
+			sum := sha256.Sum256([]byte(value))
+			return hex.EncodeToString(sum[:])
+		},
+	}
+}
+
+func randomPassword(length int) (string, error) {
+	if length <= 0 {
+		return "", fmt.Errorf("Password length must be positive, got %d", length)
+	}
+
+	password := make([]byte, length)
+	max := big.NewInt(int64(len(passwordChars)))
+	for i := range password {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("Error generating password: %s", err)
+		}
+		password[i] = passwordChars[n.Int64()]
+	}
+
+	return string(password), nil
+}
+
+func newUUID() (string, error) {
+	uuid := make([]byte, 16)
+	if _, err := rand.Read(uuid); err != nil {
+		return "", fmt.Errorf("Error generating UUID: %s", err)
+	}
+	uuid[6] = (uuid[6] & 0x0f) | 0x40
+	uuid[8] = (uuid[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:]), nil
+}
@@ -9,12 +9,16 @@ import (
 
 	"github.com/frodenas/helm-osb/broker"
 	"github.com/frodenas/helm-osb/helm"
+	"github.com/frodenas/helm-osb/kubernetes"
+	"github.com/frodenas/helm-osb/store"
 )
 
 type Config struct {
-	LogLevel     string        `json:"log_level"`
-	BrokerConfig broker.Config `json:"broker"`
-	HelmConfig   helm.Config   `json:"helm"`
+	LogLevel         string            `json:"log_level"`
+	BrokerConfig     broker.Config     `json:"broker"`
+	HelmConfig       helm.Config       `json:"helm"`
+	KubernetesConfig kubernetes.Config `json:"kubernetes"`
+	StoreConfig      store.Config      `json:"store"`
 }
 
 func LoadConfig(configFilePath string) (config *Config, err error) {
@@ -57,5 +61,16 @@ func (c Config) Validate() error {
 		return fmt.Errorf("Validating Helm configuration: %s", err)
 	}
 
+	// kubectl is only needed by the features talking to the Kubernetes API.
+	if c.BrokerConfig.UsesKubernetes() || c.StoreConfig.StoreBackend() == store.KubernetesBackend {
+		if err := c.KubernetesConfig.Validate(); err != nil {
+			return fmt.Errorf("Validating Kubernetes configuration: %s", err)
+		}
+	}
+
+	if err := c.StoreConfig.Validate(); err != nil {
+		return fmt.Errorf("Validating Store configuration: %s", err)
+	}
+
 	return nil
 }
@@ -8,6 +8,8 @@ import (
 
 	"github.com/frodenas/helm-osb/broker"
 	"github.com/frodenas/helm-osb/helm"
+	"github.com/frodenas/helm-osb/kubernetes"
+	"github.com/frodenas/helm-osb/store"
 )
 
 var _ = Describe("Config", func() {
@@ -25,6 +27,13 @@ var _ = Describe("Config", func() {
 				DefaultNamespace:  "fake-default-namespace",
 				BinaryLocation:    "helm",
 			},
+			KubernetesConfig: kubernetes.Config{
+				BinaryLocation: "kubectl",
+			},
+			StoreConfig: store.Config{
+				Backend: "file",
+				Path:    "/var/lib/helm-osb",
+			},
 		}
 	)
 
@@ -61,5 +70,39 @@ var _ = Describe("Config", func() {
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("Validating Helm configuration"))
 		})
+
+		It("does not require the Kubernetes and Store configurations", func() {
+			config.KubernetesConfig = kubernetes.Config{}
+			config.StoreConfig = store.Config{}
+
+			err := config.Validate()
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("returns error if Kubernetes configuration is not valid for the kubernetes store", func() {
+			config.KubernetesConfig = kubernetes.Config{}
+			config.StoreConfig = store.Config{Backend: "kubernetes", Namespace: "helm-osb"}
+
+			err := config.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Validating Kubernetes configuration"))
+		})
+
+		It("returns error if Kubernetes configuration is not valid for managed namespaces", func() {
+			config.KubernetesConfig = kubernetes.Config{}
+			config.BrokerConfig.Namespace = broker.NamespaceConfig{Strategy: broker.PerInstanceNamespaceStrategy}
+
+			err := config.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Validating Kubernetes configuration"))
+		})
+
+		It("returns error if Store configuration is not valid", func() {
+			config.StoreConfig = store.Config{Backend: "fake-backend"}
+
+			err := config.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Validating Store configuration"))
+		})
 	})
 })
@@ -1,11 +1,12 @@
 package helm
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
-	"regexp"
 	"strings"
 
 	"code.cloudfoundry.org/lager"
@@ -13,162 +14,96 @@ import (
 )
 
 const (
-	instanceIDLogKey = "instance-id"
-	chartLogKey      = "chart"
-	repositoryLogKey = "repository"
-	versionLogKey    = "version"
-	valuesLogKey     = "values"
-	programLogKey    = "program"
-	argumentsLogKey  = "arguments"
-	outputLogKey     = "output"
+	releaseLogKey     = "release"
+	chartLogKey       = "chart"
+	repositoryLogKey  = "repository"
+	versionLogKey     = "version"
+	valuesLogKey      = "values"
+	revisionLogKey    = "revision"
+	programLogKey     = "program"
+	argumentsLogKey   = "arguments"
+	outputLogKey      = "output"
+	errorOutputLogKey = "error-output"
 )
 
-type Client struct {
+// client holds the behaviour shared by every Driver.
+type client struct {
 	config Config
 	logger lager.Logger
 }
 
-func New(config Config, logger lager.Logger) *Client {
-	return &Client{
-		config: config,
-		logger: logger.Session("helm"),
-	}
-}
-
-func (c *Client) InstallRelease(instanceID string, chart string, repository string, version string, values map[string]interface{}) error {
-	c.logger.Debug("install-release-parameters", lager.Data{
-		instanceIDLogKey: instanceID,
-		chartLogKey:      chart,
-		repositoryLogKey: repository,
-		versionLogKey:    version,
-		valuesLogKey:     values,
-	})
-
-	cmd := fmt.Sprintf("install %s --name %s --namespace %s", chart, c.releaseName(instanceID), c.config.DefaultNamespace)
-	if repository != "" {
-		cmd = cmd + fmt.Sprintf(" --repo %s", repository)
-	}
-	if version != "" {
-		cmd = cmd + fmt.Sprintf(" --version %s", version)
-	}
-	if len(values) > 0 {
-		valuesContent, err := yaml.Marshal(values)
-		if err != nil {
-			return fmt.Errorf("Error marshalling values: %s", err)
-		}
-
-		valuesFile, err := ioutil.TempFile("", instanceID)
-		if err != nil {
-			return fmt.Errorf("Error creating temporary file: %s", err)
-		}
-		defer os.Remove(valuesFile.Name())
-
-		if _, err = valuesFile.Write([]byte(valuesContent)); err != nil {
-			return nil
-		}
-
-		cmd = cmd + " --values " + valuesFile.Name()
+// DefaultRelease returns the release of an instance when the broker does not
+// choose its name or namespace.
+func (c *client) DefaultRelease(instanceID string) Release {
+	name, err := RenderReleaseName(DefaultReleaseNameTemplate, NewReleaseNameData(c.config.ReleaseNamePrefix, instanceID, "", ""))
+	if err != nil {
+		// The prefix is never empty, so the default template always renders.
+		name = c.config.ReleaseNamePrefix
 	}
 
-	if _, err := c.helm(cmd); err != nil {
-		return fmt.Errorf("Error installing Helm release `%s`", c.releaseName(instanceID))
+	return Release{
+		Name:      name,
+		Namespace: c.config.DefaultNamespace,
 	}
-
-	return nil
 }
 
-func (c *Client) UpgradeRelease(instanceID string, chart string, repository string, version string) error {
-	c.logger.Debug("upgrade-release-parameters", lager.Data{
-		instanceIDLogKey: instanceID,
-		chartLogKey:      chart,
-		repositoryLogKey: repository,
-		versionLogKey:    version,
-	})
+// ReleaseName returns the release name of an instance built from the
+// configured template.
+func (c *client) ReleaseName(instanceID string, serviceName string, planName string) (string, error) {
+	return RenderReleaseName(c.config.ReleaseNameTemplate, NewReleaseNameData(c.config.ReleaseNamePrefix, instanceID, serviceName, planName))
+}
 
-	cmd := fmt.Sprintf("upgrade %s %s --namespace %s", c.releaseName(instanceID), chart, c.config.DefaultNamespace)
+func (c *client) chartArgs(repository string, version string) string {
+	cmd := ""
 	if repository != "" {
 		cmd = cmd + fmt.Sprintf(" --repo %s", repository)
 	}
 	if version != "" {
 		cmd = cmd + fmt.Sprintf(" --version %s", version)
 	}
-	if _, err := c.helm(cmd); err != nil {
-		return fmt.Errorf("Error upgrading Helm release `%s`", c.releaseName(instanceID))
-	}
 
-	return nil
+	return cmd
 }
 
-func (c *Client) DeleteRelease(instanceID string) error {
-	c.logger.Debug("delete-release-parameters", lager.Data{
-		instanceIDLogKey: instanceID,
-	})
-
-	cmd := fmt.Sprintf("delete --purge %s", c.releaseName(instanceID))
-	if _, err := c.helm(cmd); err != nil {
-		return fmt.Errorf("Error deleting Helm release `%s`", c.releaseName(instanceID))
-	}
-
-	return nil
-}
-
-func (c *Client) ReleaseStatus(instanceID string) (string, string, error) {
-	c.logger.Debug("release-status-parameters", lager.Data{
-		instanceIDLogKey: instanceID,
-	})
-
-	status := "FAILED"
-	description := ""
-
-	cmd := fmt.Sprintf("status %s", c.releaseName(instanceID))
-	out, err := c.helm(cmd)
+func (c *client) writeValuesFile(releaseName string, values map[string]interface{}) (string, error) {
+	valuesContent, err := yaml.Marshal(values)
 	if err != nil {
-		return status, description, fmt.Errorf("Error getting status for Helm release `%s`", c.releaseName(instanceID))
+		return "", fmt.Errorf("Error marshalling values: %s", err)
 	}
 
-	statusRe := regexp.MustCompile(`\nSTATUS: ([A-Z]+)\n`)
-	capturedStatus := statusRe.FindStringSubmatch(out)
-	if capturedStatus != nil {
-		switch capturedStatus[1] {
-		case "PENDING_INSTALL":
-			status = "INPROGRESS"
-		case "PENDING_UPGRADE":
-			status = "INPROGRESS"
-		case "DEPLOYED":
-			status = "SUCCEEDED"
-		case "DELETING":
-			status = "INPROGRESS"
-		case "DELETED":
-			status = "SUCCEEDED"
-		}
+	valuesFile, err := ioutil.TempFile("", releaseName)
+	if err != nil {
+		return "", fmt.Errorf("Error creating temporary file: %s", err)
 	}
+	defer valuesFile.Close()
 
-	lastDeployedRe := regexp.MustCompile(`LAST DEPLOYED: (.+)\n`)
-	capturedlastDeployed := lastDeployedRe.FindStringSubmatch(out)
-	if capturedlastDeployed != nil {
-		description = fmt.Sprintf("Last deployed: %s", capturedlastDeployed[1])
+	if _, err = valuesFile.Write(valuesContent); err != nil {
+		os.Remove(valuesFile.Name())
+		return "", fmt.Errorf("Error writing values file: %s", err)
 	}
 
-	return status, description, nil
+	return valuesFile.Name(), nil
 }
 
-func (c *Client) releaseName(instanceID string) string {
-	return fmt.Sprintf("%s-%s", c.config.ReleaseNamePrefix, strings.Replace(instanceID, "-", "", -1))
-}
+func (c *client) parseValues(releaseName string, out string) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
 
-func (c *Client) helm(cmd string) (string, error) {
-	args := []string{}
-	if c.config.TillerHost != "" {
-		args = append(args, fmt.Sprintf("--host %s", c.config.TillerHost))
+	rawValues := map[interface{}]interface{}{}
+	if err := yaml.Unmarshal([]byte(out), &rawValues); err != nil {
+		return values, fmt.Errorf("Error parsing values for Helm release `%s`: %s", releaseName, err)
 	}
-	if c.config.TillerNamespace != "" {
-		args = append(args, fmt.Sprintf("--tiller-namespace %s", c.config.TillerNamespace))
+
+	for k, v := range rawValues {
+		values[fmt.Sprintf("%v", k)] = stringifyKeys(v)
 	}
+
+	return values, nil
+}
+
+func (c *client) exec(ctx context.Context, globalArgs []string, cmd string) (string, error) {
+	args := append([]string{}, globalArgs...)
 	if c.config.KubeContext != "" {
-		args = append(args, fmt.Sprintf("--kube-context %s", c.config.KubeContext))
-	}
-	if c.config.Home != "" {
-		args = append(args, fmt.Sprintf("--home %s", c.config.Home))
+		args = append(args, "--kube-context", c.config.KubeContext)
 	}
 	if c.config.Debug {
 		args = append(args, "--debug")
@@ -181,18 +116,44 @@ func (c *Client) helm(cmd string) (string, error) {
 		argumentsLogKey: args,
 	})
 
-	out, err := exec.Command(c.config.BinaryLocation, args...).CombinedOutput()
-	if err != nil {
+	var stdout, stderr bytes.Buffer
+	command := exec.CommandContext(ctx, c.config.BinaryLocation, args...)
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+
+	if err := command.Run(); err != nil {
 		c.logger.Error("exec", err)
 		c.logger.Debug("exec", lager.Data{
-			outputLogKey: string(out),
+			outputLogKey:      stdout.String(),
+			errorOutputLogKey: stderr.String(),
 		})
-		return "", err
+		if ctx.Err() == context.DeadlineExceeded {
+			return stdout.String(), &Error{Reason: ReasonTimeout, Message: "Helm command timed out"}
+		}
+		return stdout.String(), classifyError(stderr.String(), err)
 	}
 
 	c.logger.Debug("exec", lager.Data{
-		outputLogKey: string(out),
+		outputLogKey: stdout.String(),
 	})
 
-	return string(out), nil
+	return stdout.String(), nil
+}
+
+func stringifyKeys(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[interface{}]interface{}:
+		stringMap := map[string]interface{}{}
+		for k, v := range value {
+			stringMap[fmt.Sprintf("%v", k)] = stringifyKeys(v)
+		}
+		return stringMap
+	case []interface{}:
+		for i, v := range value {
+			value[i] = stringifyKeys(v)
+		}
+		return value
+	default:
+		return value
+	}
 }
@@ -2,17 +2,26 @@ package helm
 
 import (
 	"errors"
+	"fmt"
+	"text/template"
+)
+
+const (
+	V2 = "2"
+	V3 = "3"
 )
 
 type Config struct {
-	ReleaseNamePrefix string `json:"release_name_prefix"`
-	DefaultNamespace  string `json:"default_namespace"`
-	BinaryLocation    string `json:"binary_location"`
-	TillerHost        string `json:"tiller_host,omitempty"`
-	TillerNamespace   string `json:"tiller_namespace,omitempty"`
-	KubeContext       string `json:"kube_context,omitempty"`
-	Home              string `json:"home,omitempty"`
-	Debug             bool   `json:"debug"`
+	Version             string `json:"version,omitempty"`
+	ReleaseNamePrefix   string `json:"release_name_prefix"`
+	ReleaseNameTemplate string `json:"release_name_template,omitempty"`
+	DefaultNamespace    string `json:"default_namespace"`
+	BinaryLocation      string `json:"binary_location"`
+	TillerHost          string `json:"tiller_host,omitempty"`
+	TillerNamespace     string `json:"tiller_namespace,omitempty"`
+	KubeContext         string `json:"kube_context,omitempty"`
+	Home                string `json:"home,omitempty"`
+	Debug               bool   `json:"debug"`
 }
 
 func (c Config) Validate() error {
@@ -20,6 +29,12 @@ func (c Config) Validate() error {
 		return errors.New("Must provide a non-empty Release Name Prefix")
 	}
 
+	if c.ReleaseNameTemplate != "" {
+		if _, err := template.New("release-name").Parse(c.ReleaseNameTemplate); err != nil {
+			return fmt.Errorf("Error parsing Release Name Template: %s", err)
+		}
+	}
+
 	if c.DefaultNamespace == "" {
 		return errors.New("Must provide a non-empty Default Namespace")
 	}
@@ -28,5 +43,15 @@ func (c Config) Validate() error {
 		return errors.New("Must provide a non-empty Binary Location")
 	}
 
+	switch c.Version {
+	case "", V2:
+	case V3:
+		if c.TillerHost != "" || c.TillerNamespace != "" || c.Home != "" {
+			return errors.New("Tiller Host, Tiller Namespace and Home are not supported by Helm 3")
+		}
+	default:
+		return fmt.Errorf("Helm Version `%s` not supported, must be `%s` or `%s`", c.Version, V2, V3)
+	}
+
 	return nil
 }
@@ -36,6 +36,14 @@ var _ = Describe("Config", func() {
 			Expect(err.Error()).To(Equal("Must provide a non-empty Release Name Prefix"))
 		})
 
+		It("returns error if Release Name Template is not valid", func() {
+			config.ReleaseNameTemplate = "{{ .Prefix"
+
+			err := config.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(HavePrefix("Error parsing Release Name Template"))
+		})
+
 		It("returns error if Default Namespace is not valid", func() {
 			config.DefaultNamespace = ""
 
@@ -51,5 +59,29 @@ var _ = Describe("Config", func() {
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(Equal("Must provide a non-empty Binary Location"))
 		})
+
+		It("does not return error if Version is Helm 3", func() {
+			config.Version = V3
+
+			err := config.Validate()
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("returns error if Version is not supported", func() {
+			config.Version = "1"
+
+			err := config.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Helm Version `1` not supported"))
+		})
+
+		It("returns error if Tiller settings are used with Helm 3", func() {
+			config.Version = V3
+			config.TillerNamespace = "kube-system"
+
+			err := config.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("not supported by Helm 3"))
+		})
 	})
 })
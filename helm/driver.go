@@ -0,0 +1,33 @@
+package helm
+
+import (
+	"context"
+
+	"code.cloudfoundry.org/lager"
+)
+
+// Driver performs the release operations the broker needs against a specific
+// Helm major version.
+type Driver interface {
+	InstallRelease(ctx context.Context, release Release, chart string, repository string, version string, values map[string]interface{}) error
+	UpgradeRelease(ctx context.Context, release Release, chart string, repository string, version string, values map[string]interface{}) error
+	DeleteRelease(ctx context.Context, release Release) error
+	RollbackRelease(ctx context.Context, release Release, revision int) error
+	TestRelease(ctx context.Context, release Release) error
+	ReleaseStatus(ctx context.Context, release Release) (ReleaseStatus, error)
+	ReleaseHistory(ctx context.Context, release Release) ([]ReleaseRevision, error)
+	ReleaseValues(ctx context.Context, release Release) (map[string]interface{}, error)
+	ReleaseManifest(ctx context.Context, release Release) (Manifest, error)
+	DefaultRelease(instanceID string) Release
+	ReleaseName(instanceID string, serviceName string, planName string) (string, error)
+}
+
+// New returns the Driver for the Helm version set in the configuration.
+func New(config Config, logger lager.Logger) Driver {
+	switch config.Version {
+	case V3:
+		return NewV3Driver(config, logger)
+	default:
+		return NewV2Driver(config, logger)
+	}
+}
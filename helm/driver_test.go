@@ -0,0 +1,345 @@
+package helm_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/frodenas/helm-osb/helm"
+)
+
+const fakeHelmScript = `#!/bin/sh
+echo "$@" >> %[1]s/args
+case "$*" in
+  *" status "*|"status "*) cat %[1]s/status.json ;;
+  *" get "*|"get "*) printf 'replicas: 2\n' ;;
+  *" history "*|"history "*) printf '[{"revision":1,"status":"SUPERSEDED"},{"revision":2,"status":"DEPLOYED"}]' ;;
+esac
+`
+
+var _ = Describe("Driver", func() {
+	var (
+		ctx     context.Context
+		tmpDir  string
+		config  Config
+		release = Release{Name: "fake-fakeinstanceid", Namespace: "fake-namespace"}
+	)
+
+	writeFakeHelm := func(status string) {
+		script := fmt.Sprintf(fakeHelmScript, tmpDir)
+		err := ioutil.WriteFile(config.BinaryLocation, []byte(script), 0700)
+		Expect(err).ToNot(HaveOccurred())
+
+		err = ioutil.WriteFile(filepath.Join(tmpDir, "status.json"), []byte(status), 0600)
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	calls := func() []string {
+		content, err := ioutil.ReadFile(filepath.Join(tmpDir, "args"))
+		Expect(err).ToNot(HaveOccurred())
+		return strings.Split(strings.TrimSpace(string(content)), "\n")
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+
+		var err error
+		tmpDir, err = ioutil.TempDir("", "helm-driver")
+		Expect(err).ToNot(HaveOccurred())
+
+		config = Config{
+			ReleaseNamePrefix: "fake",
+			DefaultNamespace:  "fake-namespace",
+			BinaryLocation:    filepath.Join(tmpDir, "helm"),
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	Describe("DefaultRelease", func() {
+		It("returns the prefixed release name and the default namespace", func() {
+			driver := New(config, lagertest.NewTestLogger("helm"))
+			Expect(driver.DefaultRelease("fake-instance-id")).To(Equal(release))
+		})
+	})
+
+	Describe("ReleaseName", func() {
+		It("returns the release name from the configured template", func() {
+			config.ReleaseNameTemplate = "{{ .Prefix }}-{{ .PlanName }}-{{ .CompactInstanceID }}"
+			driver := New(config, lagertest.NewTestLogger("helm"))
+
+			name, err := driver.ReleaseName("fake-instance-id", "fake-service", "fake-plan")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(name).To(Equal("fake-fake-plan-fakeinstanceid"))
+		})
+	})
+
+	Describe("New", func() {
+		It("returns a Helm 2 driver by default", func() {
+			Expect(New(config, lagertest.NewTestLogger("helm"))).To(BeAssignableToTypeOf(&V2Driver{}))
+		})
+
+		It("returns a Helm 3 driver if configured", func() {
+			config.Version = V3
+			Expect(New(config, lagertest.NewTestLogger("helm"))).To(BeAssignableToTypeOf(&V3Driver{}))
+		})
+	})
+
+	Describe("V2Driver", func() {
+		var driver Driver
+
+		BeforeEach(func() {
+			config.TillerNamespace = "fake-tiller-namespace"
+			writeFakeHelm(`{"name":"fake-fakeinstanceid","info":{"status":{"code":1},"last_deployed":{"seconds":1514764800},"Description":"Install complete"},"namespace":"fake-namespace"}`)
+			driver = NewV2Driver(config, lagertest.NewTestLogger("helm"))
+		})
+
+		It("installs releases through Tiller", func() {
+			err := driver.InstallRelease(ctx, release, "mysql", "", "1.0.0", nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(calls()).To(Equal([]string{
+				"--tiller-namespace fake-tiller-namespace install mysql --name fake-fakeinstanceid --namespace fake-namespace --version 1.0.0",
+			}))
+		})
+
+		It("purges deleted releases", func() {
+			err := driver.DeleteRelease(ctx, release)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(calls()).To(Equal([]string{
+				"--tiller-namespace fake-tiller-namespace delete --purge fake-fakeinstanceid",
+			}))
+		})
+
+		It("rolls back releases", func() {
+			err := driver.RollbackRelease(ctx, release, 3)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(calls()).To(Equal([]string{
+				"--tiller-namespace fake-tiller-namespace rollback fake-fakeinstanceid 3",
+			}))
+		})
+
+		It("tests releases", func() {
+			err := driver.TestRelease(ctx, release)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(calls()).To(Equal([]string{
+				"--tiller-namespace fake-tiller-namespace test fake-fakeinstanceid --cleanup",
+			}))
+		})
+
+		It("returns the release status", func() {
+			releaseStatus, err := driver.ReleaseStatus(ctx, release)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(releaseStatus.Status).To(Equal(StatusDeployed))
+			Expect(releaseStatus.Description).To(Equal("Install complete"))
+			Expect(calls()).To(Equal([]string{
+				"--tiller-namespace fake-tiller-namespace status fake-fakeinstanceid --output json",
+			}))
+		})
+
+		It("returns the release history", func() {
+			history, err := driver.ReleaseHistory(ctx, release)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(LastDeployedRevision(history)).To(Equal(2))
+			Expect(calls()).To(Equal([]string{
+				"--tiller-namespace fake-tiller-namespace history fake-fakeinstanceid --output json",
+			}))
+		})
+
+		It("returns the release values", func() {
+			values, err := driver.ReleaseValues(ctx, release)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(values).To(Equal(map[string]interface{}{"replicas": 2}))
+		})
+
+		It("returns error if helm fails", func() {
+			config.BinaryLocation = filepath.Join(tmpDir, "missing")
+			driver = NewV2Driver(config, lagertest.NewTestLogger("helm"))
+
+			err := driver.DeleteRelease(ctx, release)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(HavePrefix("Error deleting Helm release `fake-fakeinstanceid`"))
+		})
+
+		It("returns error if the command times out", func() {
+			err := ioutil.WriteFile(config.BinaryLocation, []byte("#!/bin/sh\nexec sleep 5\n"), 0700)
+			Expect(err).ToNot(HaveOccurred())
+
+			ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+			defer cancel()
+
+			err = driver.DeleteRelease(ctx, release)
+			Expect(err).To(MatchError("Error deleting Helm release `fake-fakeinstanceid`: Helm command timed out"))
+			Expect(Reason(err)).To(Equal(ReasonTimeout))
+		})
+	})
+
+	Describe("V3Driver", func() {
+		var driver Driver
+
+		BeforeEach(func() {
+			config.Version = V3
+			writeFakeHelm(`{"name":"fake-fakeinstanceid","info":{"status":"pending-upgrade","last_deployed":"2018-01-01T00:00:00Z"},"version":2,"namespace":"fake-namespace"}`)
+			driver = NewV3Driver(config, lagertest.NewTestLogger("helm"))
+		})
+
+		It("installs releases creating the namespace", func() {
+			err := driver.InstallRelease(ctx, release, "mysql", "https://charts.example.com", "", nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(calls()).To(Equal([]string{
+				"install fake-fakeinstanceid mysql --namespace fake-namespace --create-namespace --repo https://charts.example.com",
+			}))
+		})
+
+		It("upgrades releases", func() {
+			err := driver.UpgradeRelease(ctx, release, "mysql", "", "", nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(calls()).To(Equal([]string{
+				"upgrade fake-fakeinstanceid mysql --namespace fake-namespace",
+			}))
+		})
+
+		It("uninstalls deleted releases", func() {
+			err := driver.DeleteRelease(ctx, release)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(calls()).To(Equal([]string{
+				"uninstall fake-fakeinstanceid --namespace fake-namespace",
+			}))
+		})
+
+		It("rolls back releases", func() {
+			err := driver.RollbackRelease(ctx, release, 0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(calls()).To(Equal([]string{
+				"rollback fake-fakeinstanceid 0 --namespace fake-namespace",
+			}))
+		})
+
+		It("tests releases", func() {
+			err := driver.TestRelease(ctx, release)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(calls()).To(Equal([]string{
+				"test fake-fakeinstanceid --namespace fake-namespace --logs",
+			}))
+		})
+
+		It("returns the release status", func() {
+			releaseStatus, err := driver.ReleaseStatus(ctx, release)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(releaseStatus.Status).To(Equal(StatusPendingUpgrade))
+			Expect(releaseStatus.Revision).To(Equal(2))
+			Expect(calls()).To(Equal([]string{
+				"status fake-fakeinstanceid --namespace fake-namespace --output json",
+			}))
+		})
+
+		It("returns the release history", func() {
+			history, err := driver.ReleaseHistory(ctx, release)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(LastDeployedRevision(history)).To(Equal(2))
+			Expect(calls()).To(Equal([]string{
+				"history fake-fakeinstanceid --namespace fake-namespace --output json",
+			}))
+		})
+
+		It("returns the release values", func() {
+			values, err := driver.ReleaseValues(ctx, release)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(values).To(Equal(map[string]interface{}{"replicas": 2}))
+			Expect(calls()).To(Equal([]string{
+				"get values fake-fakeinstanceid --namespace fake-namespace --output yaml",
+			}))
+		})
+	})
+	Describe("errors", func() {
+		var driver Driver
+
+		failWith := func(output string) error {
+			script := fmt.Sprintf("#!/bin/sh\necho %q >&2\nexit 1\n", output)
+			err := ioutil.WriteFile(config.BinaryLocation, []byte(script), 0700)
+			Expect(err).ToNot(HaveOccurred())
+
+			return driver.InstallRelease(ctx, release, "mysql", "", "", nil)
+		}
+
+		BeforeEach(func() {
+			config.Version = V3
+			driver = NewV3Driver(config, lagertest.NewTestLogger("helm"))
+		})
+
+		It("returns the Helm error message", func() {
+			err := failWith("Error: cannot re-use a name that is still in use")
+			Expect(err).To(MatchError("Error installing Helm release `fake-fakeinstanceid`: cannot re-use a name that is still in use"))
+		})
+
+		It("returns the command error if there is no output", func() {
+			err := failWith("")
+			Expect(err).To(MatchError("Error installing Helm release `fake-fakeinstanceid`: exit status 1"))
+			Expect(Reason(err)).To(Equal(ReasonUnknown))
+		})
+
+		It("classifies the Helm errors", func() {
+			for output, reason := range map[string]ErrorReason{
+				"Error: cannot re-use a name that is still in use":                                           ReasonReleaseExists,
+				"Error: release: \"fake\" not found":                                                         ReasonReleaseNotFound,
+				"Error: uninstall: Release not loaded: fake: release: not found":                             ReasonReleaseNotFound,
+				"Error: chart \"mysql\" not found in https://charts.example.com repository":                  ReasonChartNotFound,
+				"Error: failed to download \"stable/mysql\"":                                                 ReasonChartNotFound,
+				"Error: looks like \"https://x\" is not a valid chart repository or cannot be reached":       ReasonRepositoryUnreachable,
+				"Error: timed out waiting for the condition":                                                 ReasonTimeout,
+				"Error: pods \"fake\" is forbidden: exceeded quota: compute-resources":                       ReasonForbidden,
+				"Error: secrets is forbidden: User \"system:serviceaccount:default\" cannot create resource": ReasonForbidden,
+				"Error: something else went wrong":                                                           ReasonUnknown,
+			} {
+				err := failWith(output)
+				Expect(Reason(err)).To(Equal(reason), output)
+			}
+		})
+
+		Describe("tests", func() {
+			testWith := func(output string) error {
+				script := fmt.Sprintf("#!/bin/sh\ncat <<'EOF'\n%s\nEOF\necho 'Error: 1 test(s) failed' >&2\nexit 1\n", output)
+				err := ioutil.WriteFile(config.BinaryLocation, []byte(script), 0700)
+				Expect(err).ToNot(HaveOccurred())
+
+				return driver.TestRelease(ctx, release)
+			}
+
+			It("summarizes the failed Helm 3 tests and their logs", func() {
+				err := testWith(`NAME: fake-fakeinstanceid
+TEST SUITE:     fake-test-connection
+Last Started:   Mon Jan  1 00:00:00 2018
+Phase:          Failed
+TEST SUITE:     fake-test-credentials
+Phase:          Succeeded
+
+POD LOGS: fake-test-connection
+Connecting to fake-mysql:3306
+connection refused`)
+				Expect(err).To(MatchError("Error testing Helm release `fake-fakeinstanceid`: Tests failed: fake-test-connection (connection refused)"))
+				Expect(Reason(err)).To(Equal(ReasonTestFailed))
+			})
+
+			It("summarizes the failed Helm 2 tests", func() {
+				err := testWith(`RUNNING: fake-test-connection
+FAILED: fake-test-connection, run ` + "`kubectl logs fake-test-connection --namespace fake-namespace`" + ` for more info`)
+				Expect(err).To(MatchError("Error testing Helm release `fake-fakeinstanceid`: Tests failed: fake-test-connection"))
+			})
+
+			It("returns the Helm error if no test failed", func() {
+				err := testWith("")
+				Expect(err).To(MatchError("Error testing Helm release `fake-fakeinstanceid`: 1 test(s) failed"))
+				Expect(Reason(err)).To(Equal(ReasonUnknown))
+			})
+		})
+	})
+})
@@ -0,0 +1,109 @@
+package helm
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ErrorReason classifies why a Helm command failed.
+type ErrorReason string
+
+const (
+	ReasonUnknown               ErrorReason = "unknown"
+	ReasonTimeout               ErrorReason = "timeout"
+	ReasonForbidden             ErrorReason = "forbidden"
+	ReasonReleaseExists         ErrorReason = "release-exists"
+	ReasonReleaseNotFound       ErrorReason = "release-not-found"
+	ReasonRepositoryUnreachable ErrorReason = "repository-unreachable"
+	ReasonChartNotFound         ErrorReason = "chart-not-found"
+	ReasonTestFailed            ErrorReason = "test-failed"
+)
+
+// errorPatterns are matched in order against the Helm error output, so more
+// specific causes must come first.
+var errorPatterns = []struct {
+	reason  ErrorReason
+	pattern *regexp.Regexp
+}{
+	{ReasonTimeout, regexp.MustCompile(`(?i)timed out waiting for the condition`)},
+	{ReasonForbidden, regexp.MustCompile(`(?i)\bforbidden\b|exceeded quota|\bunauthorized\b`)},
+	{ReasonReleaseExists, regexp.MustCompile(`(?i)cannot re-use a name that is still in use|release .*already exists`)},
+	{ReasonReleaseNotFound, regexp.MustCompile(`(?i)release: "[^"]*" not found|release: not found|release "[^"]*" not found`)},
+	{ReasonRepositoryUnreachable, regexp.MustCompile(`(?i)is not a valid chart repository or cannot be reached|failed to fetch .*index\.yaml|no such host`)},
+	{ReasonChartNotFound, regexp.MustCompile(`(?i)chart "[^"]*"( version "[^"]*")? not found|no chart (name|version) found|failed to download|not found in .* repository`)},
+}
+
+// Error is returned by Drivers when a Helm command fails.
+type Error struct {
+	Reason  ErrorReason
+	Action  string
+	Release string
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Action == "" {
+		return e.Message
+	}
+
+	return fmt.Sprintf("Error %s Helm release `%s`: %s", e.Action, e.Release, e.Message)
+}
+
+// Reason returns the reason of a Helm error, or ReasonUnknown if err was not
+// returned by a Helm command.
+func Reason(err error) ErrorReason {
+	if helmErr, ok := err.(*Error); ok {
+		return helmErr.Reason
+	}
+
+	return ReasonUnknown
+}
+
+// classifyError builds an Error from the output of a failed Helm command.
+func classifyError(output string, err error) *Error {
+	message := errorMessage(output)
+	if message == "" {
+		message = err.Error()
+	}
+
+	for _, errorPattern := range errorPatterns {
+		if errorPattern.pattern.MatchString(output) {
+			return &Error{Reason: errorPattern.reason, Message: message}
+		}
+	}
+
+	return &Error{Reason: ReasonUnknown, Message: message}
+}
+
+// releaseError annotates an error returned by exec with the release action.
+func releaseError(action string, release string, err error) error {
+	helmErr, ok := err.(*Error)
+	if !ok {
+		helmErr = &Error{Reason: ReasonUnknown, Message: err.Error()}
+	}
+
+	return &Error{
+		Reason:  helmErr.Reason,
+		Action:  action,
+		Release: release,
+		Message: helmErr.Message,
+	}
+}
+
+// errorMessage returns the last error line printed by Helm, without the
+// `Error:` prefix.
+func errorMessage(output string) string {
+	message := ""
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "Error:") || message == "" {
+			message = strings.TrimSpace(strings.TrimPrefix(line, "Error:"))
+		}
+	}
+
+	return message
+}
@@ -0,0 +1,71 @@
+package helm
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ReleaseRevision is an entry of the history of a release.
+type ReleaseRevision struct {
+	Revision    int    `json:"revision"`
+	Status      string `json:"status"`
+	Chart       string `json:"chart,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// ParseHistory parses the output of `helm history --output json`. Helm 2
+// states are translated to their Helm 3 equivalent.
+func ParseHistory(content string) ([]ReleaseRevision, error) {
+	history := []ReleaseRevision{}
+	if err := json.Unmarshal([]byte(content), &history); err != nil {
+		return nil, fmt.Errorf("Error parsing release history: %s", err)
+	}
+
+	for i, revision := range history {
+		history[i].Status = historyStatus(revision.Status)
+	}
+
+	return history, nil
+}
+
+// LastDeployedRevision returns the last revision of a release history that
+// was deployed successfully, or 0 if there is none. Revisions replaced by a
+// later upgrade are superseded, so they only count when no revision is
+// deployed.
+func LastDeployedRevision(history []ReleaseRevision) int {
+	deployed, superseded := 0, 0
+	for _, revision := range history {
+		switch revision.Status {
+		case StatusDeployed:
+			if revision.Revision > deployed {
+				deployed = revision.Revision
+			}
+		case StatusSuperseded:
+			if revision.Revision > superseded {
+				superseded = revision.Revision
+			}
+		}
+	}
+
+	if deployed > 0 {
+		return deployed
+	}
+
+	return superseded
+}
+
+func historyStatus(status string) string {
+	status = strings.Replace(strings.ToLower(status), "_", "-", -1)
+
+	switch status {
+	case "":
+		return StatusUnknown
+	case "deleted":
+		return StatusUninstalled
+	case "deleting":
+		return StatusUninstalling
+	}
+
+	return status
+}
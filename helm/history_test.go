@@ -0,0 +1,66 @@
+package helm_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/frodenas/helm-osb/helm"
+)
+
+var _ = Describe("ReleaseHistory", func() {
+	Describe("ParseHistory", func() {
+		It("returns the Helm 3 release history", func() {
+			history, err := ParseHistory(`[
+				{"revision": 1, "updated": "2018-01-01T00:00:00Z", "status": "superseded", "chart": "mysql-1.0.0", "description": "Install complete"},
+				{"revision": 2, "updated": "2018-01-02T00:00:00Z", "status": "failed", "chart": "mysql-1.1.0", "description": "Upgrade \"fake-release\" failed"}
+			]`)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(history).To(Equal([]ReleaseRevision{
+				ReleaseRevision{Revision: 1, Status: StatusSuperseded, Chart: "mysql-1.0.0", Description: "Install complete"},
+				ReleaseRevision{Revision: 2, Status: StatusFailed, Chart: "mysql-1.1.0", Description: `Upgrade "fake-release" failed`},
+			}))
+		})
+
+		It("translates the Helm 2 states", func() {
+			history, err := ParseHistory(`[
+				{"revision": 1, "updated": "Mon Jan  1 00:00:00 2018", "status": "SUPERSEDED", "chart": "mysql-1.0.0"},
+				{"revision": 2, "updated": "Tue Jan  2 00:00:00 2018", "status": "PENDING_UPGRADE", "chart": "mysql-1.1.0"},
+				{"revision": 3, "updated": "Wed Jan  3 00:00:00 2018", "status": "DELETED", "chart": "mysql-1.1.0"}
+			]`)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(history[0].Status).To(Equal(StatusSuperseded))
+			Expect(history[1].Status).To(Equal(StatusPendingUpgrade))
+			Expect(history[2].Status).To(Equal(StatusUninstalled))
+		})
+
+		It("returns error if the output is not valid", func() {
+			_, err := ParseHistory("Error: release: not found")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Error parsing release history"))
+		})
+	})
+
+	Describe("LastDeployedRevision", func() {
+		It("returns the last deployed revision", func() {
+			Expect(LastDeployedRevision([]ReleaseRevision{
+				ReleaseRevision{Revision: 1, Status: StatusSuperseded},
+				ReleaseRevision{Revision: 2, Status: StatusDeployed},
+				ReleaseRevision{Revision: 3, Status: StatusFailed},
+			})).To(Equal(2))
+		})
+
+		It("returns the last superseded revision if none is deployed", func() {
+			Expect(LastDeployedRevision([]ReleaseRevision{
+				ReleaseRevision{Revision: 1, Status: StatusSuperseded},
+				ReleaseRevision{Revision: 2, Status: StatusSuperseded},
+				ReleaseRevision{Revision: 3, Status: StatusFailed},
+			})).To(Equal(2))
+		})
+
+		It("returns 0 if no revision was deployed", func() {
+			Expect(LastDeployedRevision([]ReleaseRevision{
+				ReleaseRevision{Revision: 1, Status: StatusFailed},
+			})).To(Equal(0))
+		})
+	})
+})
@@ -0,0 +1,107 @@
+package helm
+
+import (
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+var documentSeparatorRe = regexp.MustCompile(`(?m)^---\s*$`)
+
+type Manifest []Resource
+
+type Resource struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   ResourceMetadata  `yaml:"metadata"`
+	Spec       ResourceSpec      `yaml:"spec"`
+	Data       map[string]string `yaml:"data"`
+	StringData map[string]string `yaml:"stringData"`
+}
+
+type ResourceMetadata struct {
+	Name      string            `yaml:"name"`
+	Namespace string            `yaml:"namespace"`
+	Labels    map[string]string `yaml:"labels"`
+}
+
+type ResourceSpec struct {
+	Type      string        `yaml:"type"`
+	ClusterIP string        `yaml:"clusterIP"`
+	Ports     []ServicePort `yaml:"ports"`
+}
+
+type ServicePort struct {
+	Name     string `yaml:"name"`
+	Protocol string `yaml:"protocol"`
+	Port     int    `yaml:"port"`
+	NodePort int    `yaml:"nodePort"`
+}
+
+func ParseManifest(content string, namespace string) (Manifest, error) {
+	manifest := Manifest{}
+
+	for _, document := range documentSeparatorRe.Split(content, -1) {
+		if strings.TrimSpace(document) == "" {
+			continue
+		}
+
+		resource := Resource{}
+		if err := yaml.Unmarshal([]byte(document), &resource); err != nil {
+			return manifest, fmt.Errorf("Error parsing manifest: %s", err)
+		}
+
+		if resource.Kind == "" {
+			continue
+		}
+
+		if resource.Metadata.Namespace == "" {
+			resource.Metadata.Namespace = namespace
+		}
+
+		manifest = append(manifest, resource)
+	}
+
+	return manifest, nil
+}
+
+func (m Manifest) FindResource(kind string, name string) (resource Resource, found bool) {
+	for _, resource := range m {
+		if resource.Kind == kind && resource.Metadata.Name == name {
+			return resource, true
+		}
+	}
+
+	return resource, false
+}
+
+func (r Resource) FindPort(name string) (port ServicePort, found bool) {
+	for _, port := range r.Spec.Ports {
+		if port.Name == name {
+			return port, true
+		}
+	}
+
+	return port, false
+}
+
+func (r Resource) SecretValue(key string) (string, bool, error) {
+	if value, ok := r.StringData[key]; ok {
+		return value, true, nil
+	}
+
+	encodedValue, ok := r.Data[key]
+	if !ok {
+		return "", false, nil
+	}
+
+	value, err := base64.StdEncoding.DecodeString(encodedValue)
+	if err != nil {
+		return "", true, fmt.Errorf("Error decoding key `%s` of Secret `%s`: %s", key, r.Metadata.Name, err)
+	}
+
+	return string(value), true, nil
+}
@@ -0,0 +1,108 @@
+package helm_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/frodenas/helm-osb/helm"
+)
+
+var _ = Describe("Manifest", func() {
+	var (
+		content = `---
+# Source: mysql/templates/secrets.yaml
+apiVersion: v1
+kind: Secret
+metadata:
+  name: fake-release-mysql
+type: Opaque
+data:
+  mysql-root-password: ZmFrZS1wYXNzd29yZA==
+stringData:
+  mysql-user: fake-user
+---
+# Source: mysql/templates/svc.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: fake-release-mysql
+  namespace: fake-namespace
+spec:
+  type: ClusterIP
+  ports:
+  - name: mysql
+    port: 3306
+    targetPort: mysql
+---
+# Source: mysql/templates/empty.yaml
+`
+	)
+
+	Describe("ParseManifest", func() {
+		It("returns all resources in the manifest", func() {
+			manifest, err := ParseManifest(content, "fake-default-namespace")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(manifest).To(HaveLen(2))
+		})
+
+		It("sets the default namespace on resources without namespace", func() {
+			manifest, err := ParseManifest(content, "fake-default-namespace")
+			Expect(err).ToNot(HaveOccurred())
+
+			secret, found := manifest.FindResource("Secret", "fake-release-mysql")
+			Expect(found).To(BeTrue())
+			Expect(secret.Metadata.Namespace).To(Equal("fake-default-namespace"))
+
+			service, found := manifest.FindResource("Service", "fake-release-mysql")
+			Expect(found).To(BeTrue())
+			Expect(service.Metadata.Namespace).To(Equal("fake-namespace"))
+		})
+
+		It("returns error if the manifest is not valid", func() {
+			_, err := ParseManifest("kind: [", "fake-default-namespace")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Error parsing manifest"))
+		})
+	})
+
+	Describe("Resource", func() {
+		var (
+			manifest Manifest
+		)
+
+		BeforeEach(func() {
+			var err error
+			manifest, err = ParseManifest(content, "fake-default-namespace")
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("returns the Service ports", func() {
+			service, _ := manifest.FindResource("Service", "fake-release-mysql")
+
+			port, found := service.FindPort("mysql")
+			Expect(found).To(BeTrue())
+			Expect(port.Port).To(Equal(3306))
+
+			_, found = service.FindPort("http")
+			Expect(found).To(BeFalse())
+		})
+
+		It("returns decoded Secret values", func() {
+			secret, _ := manifest.FindResource("Secret", "fake-release-mysql")
+
+			value, found, err := secret.SecretValue("mysql-root-password")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(BeTrue())
+			Expect(value).To(Equal("fake-password"))
+
+			value, found, err = secret.SecretValue("mysql-user")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(BeTrue())
+			Expect(value).To(Equal("fake-user"))
+
+			_, found, err = secret.SecretValue("unknown")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,93 @@
+package helm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+const (
+	// MaxReleaseNameLength is the longest release name Helm accepts.
+	MaxReleaseNameLength = 53
+
+	// DefaultReleaseNameTemplate names releases after the prefix and the
+	// instance ID, as releases were named before templates were supported.
+	DefaultReleaseNameTemplate = "{{ .Prefix }}-{{ .CompactInstanceID }}"
+
+	releaseNameHashLength = 8
+)
+
+var invalidReleaseNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// Release identifies a Helm release.
+type Release struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+// ReleaseNameData holds the fields available to release name templates.
+type ReleaseNameData struct {
+	Prefix            string
+	InstanceID        string
+	CompactInstanceID string
+	InstanceHash      string
+	ServiceName       string
+	PlanName          string
+}
+
+// NewReleaseNameData returns the release name template fields for an
+// instance.
+func NewReleaseNameData(prefix string, instanceID string, serviceName string, planName string) ReleaseNameData {
+	return ReleaseNameData{
+		Prefix:            prefix,
+		InstanceID:        instanceID,
+		CompactInstanceID: strings.Replace(instanceID, "-", "", -1),
+		InstanceHash:      hash(instanceID),
+		ServiceName:       serviceName,
+		PlanName:          planName,
+	}
+}
+
+// RenderReleaseName executes a release name template and turns the result
+// into a valid DNS-1123 name. Names longer than MaxReleaseNameLength are
+// truncated and suffixed with a hash of the full name to keep them unique.
+func RenderReleaseName(nameTemplate string, data ReleaseNameData) (string, error) {
+	if nameTemplate == "" {
+		nameTemplate = DefaultReleaseNameTemplate
+	}
+
+	tmpl, err := template.New("release-name").Option("missingkey=error").Parse(nameTemplate)
+	if err != nil {
+		return "", fmt.Errorf("Error parsing release name template: %s", err)
+	}
+
+	var name bytes.Buffer
+	if err := tmpl.Execute(&name, data); err != nil {
+		return "", fmt.Errorf("Error executing release name template: %s", err)
+	}
+
+	return releaseName(name.String())
+}
+
+func releaseName(name string) (string, error) {
+	releaseName := strings.Trim(invalidReleaseNameChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if releaseName == "" {
+		return "", fmt.Errorf("Release name `%s` is not valid", name)
+	}
+
+	if len(releaseName) > MaxReleaseNameLength {
+		prefix := strings.TrimRight(releaseName[:MaxReleaseNameLength-releaseNameHashLength-1], "-")
+		releaseName = prefix + "-" + hash(releaseName)
+	}
+
+	return releaseName, nil
+}
+
+func hash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])[:releaseNameHashLength]
+}
@@ -0,0 +1,57 @@
+package helm_test
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/frodenas/helm-osb/helm"
+)
+
+var _ = Describe("Release", func() {
+	var data = NewReleaseNameData("fake", "Fake-Instance-ID", "fake_service", "fake.plan")
+
+	Describe("NewReleaseNameData", func() {
+		It("returns the compact and hashed instance IDs", func() {
+			Expect(data.CompactInstanceID).To(Equal("FakeInstanceID"))
+			Expect(data.InstanceHash).To(HaveLen(8))
+		})
+	})
+
+	Describe("RenderReleaseName", func() {
+		It("uses the default template if not set", func() {
+			name, err := RenderReleaseName("", data)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(name).To(Equal("fake-fakeinstanceid"))
+		})
+
+		It("returns a valid DNS-1123 name", func() {
+			name, err := RenderReleaseName("{{ .Prefix }}-{{ .ServiceName }}-{{ .PlanName }}", data)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(name).To(Equal("fake-fake-service-fake-plan"))
+		})
+
+		It("truncates long names keeping them unique", func() {
+			name, err := RenderReleaseName(strings.Repeat("a", 60)+"{{ .InstanceID }}", data)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(name).To(HaveLen(MaxReleaseNameLength))
+			Expect(name).To(HavePrefix(strings.Repeat("a", 44) + "-"))
+
+			otherName, err := RenderReleaseName(strings.Repeat("a", 60)+"{{ .InstanceID }}", NewReleaseNameData("fake", "other-instance-id", "", ""))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(otherName).ToNot(Equal(name))
+		})
+
+		It("returns error if the template refers to unknown fields", func() {
+			_, err := RenderReleaseName("{{ .Unknown }}", data)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("returns error if the name is empty", func() {
+			_, err := RenderReleaseName("--", data)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Release name `--` is not valid"))
+		})
+	})
+})
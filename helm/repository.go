@@ -0,0 +1,96 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// RepositoryIndex is the `index.yaml` of a chart repository.
+type RepositoryIndex struct {
+	Entries map[string][]ChartVersion `yaml:"entries"`
+}
+
+type ChartVersion struct {
+	Name    string `yaml:"name"`
+	Version string `yaml:"version"`
+}
+
+// FetchRepositoryIndex downloads the index of a chart repository.
+func FetchRepositoryIndex(ctx context.Context, repository string) (RepositoryIndex, error) {
+	index := RepositoryIndex{}
+	indexURL := strings.TrimSuffix(repository, "/") + "/index.yaml"
+
+	req, err := http.NewRequest("GET", indexURL, nil)
+	if err != nil {
+		return index, &Error{Reason: ReasonRepositoryUnreachable, Message: fmt.Sprintf("Error fetching repository index `%s`: %s", indexURL, err)}
+	}
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return index, &Error{Reason: ReasonRepositoryUnreachable, Message: fmt.Sprintf("Error fetching repository index `%s`: %s", indexURL, err)}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return index, &Error{Reason: ReasonRepositoryUnreachable, Message: fmt.Sprintf("Error fetching repository index `%s`: %s", indexURL, resp.Status)}
+	}
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return index, &Error{Reason: ReasonRepositoryUnreachable, Message: fmt.Sprintf("Error reading repository index `%s`: %s", indexURL, err)}
+	}
+
+	if err := yaml.Unmarshal(content, &index); err != nil {
+		return index, fmt.Errorf("Error parsing repository index `%s`: %s", indexURL, err)
+	}
+
+	return index, nil
+}
+
+// ResolveVersion returns the highest version of a chart satisfying a version
+// constraint.
+func (ri RepositoryIndex) ResolveVersion(chart string, constraint string) (string, error) {
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return "", fmt.Errorf("Invalid version constraint `%s`: %s", constraint, err)
+	}
+
+	var resolved *semver.Version
+	for _, chartVersion := range ri.Entries[chart] {
+		version, err := semver.NewVersion(chartVersion.Version)
+		if err != nil || !c.Check(version) {
+			continue
+		}
+
+		if resolved == nil || version.GreaterThan(resolved) {
+			resolved = version
+		}
+	}
+
+	if resolved == nil {
+		return "", &Error{Reason: ReasonChartNotFound, Message: fmt.Sprintf("No version of chart `%s` satisfies `%s`", chart, constraint)}
+	}
+
+	return resolved.Original(), nil
+}
+
+// IsVersionConstraint reports whether a chart version is a range rather than
+// an exact version. Partial versions such as `1.4` are ranges.
+func IsVersionConstraint(version string) bool {
+	if version == "" {
+		return false
+	}
+
+	if v, err := semver.NewVersion(version); err == nil && v.String() == v.Original() {
+		return false
+	}
+
+	_, err := semver.NewConstraint(version)
+	return err == nil
+}
@@ -0,0 +1,90 @@
+package helm_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/frodenas/helm-osb/helm"
+)
+
+var _ = Describe("Repository", func() {
+	const index = `
+apiVersion: v1
+entries:
+  mysql:
+  - name: mysql
+    version: 1.5.0
+  - name: mysql
+    version: 1.4.3
+  - name: mysql
+    version: 1.4.1
+  - name: mysql
+    version: 1.4.4-rc.1
+`
+
+	var server *httptest.Server
+
+	BeforeEach(func() {
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.URL.Path != "/index.yaml" {
+				http.NotFound(w, req)
+				return
+			}
+			w.Write([]byte(index))
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("FetchRepositoryIndex", func() {
+		It("returns the chart versions", func() {
+			repositoryIndex, err := FetchRepositoryIndex(context.Background(), server.URL+"/")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(repositoryIndex.Entries["mysql"]).To(HaveLen(4))
+		})
+
+		It("returns error if the repository cannot be reached", func() {
+			_, err := FetchRepositoryIndex(context.Background(), server.URL+"/unknown")
+			Expect(err).To(HaveOccurred())
+			Expect(Reason(err)).To(Equal(ReasonRepositoryUnreachable))
+		})
+	})
+
+	Describe("ResolveVersion", func() {
+		var repositoryIndex RepositoryIndex
+
+		BeforeEach(func() {
+			var err error
+			repositoryIndex, err = FetchRepositoryIndex(context.Background(), server.URL)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("returns the highest version satisfying the constraint", func() {
+			version, err := repositoryIndex.ResolveVersion("mysql", "~1.4")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(version).To(Equal("1.4.3"))
+		})
+
+		It("returns error if no version satisfies the constraint", func() {
+			_, err := repositoryIndex.ResolveVersion("mysql", "^2")
+			Expect(err).To(MatchError("No version of chart `mysql` satisfies `^2`"))
+			Expect(Reason(err)).To(Equal(ReasonChartNotFound))
+		})
+	})
+
+	Describe("IsVersionConstraint", func() {
+		It("reports whether a version is a range", func() {
+			Expect(IsVersionConstraint("")).To(BeFalse())
+			Expect(IsVersionConstraint("1.4.3")).To(BeFalse())
+			Expect(IsVersionConstraint("1.4")).To(BeTrue())
+			Expect(IsVersionConstraint("~1.4")).To(BeTrue())
+			Expect(IsVersionConstraint(">=1.4.0, <2")).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,130 @@
+package helm
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Release states, named after the Helm 3 states. Helm 2 states are translated
+// to their Helm 3 equivalent.
+const (
+	StatusUnknown         = "unknown"
+	StatusDeployed        = "deployed"
+	StatusUninstalled     = "uninstalled"
+	StatusSuperseded      = "superseded"
+	StatusFailed          = "failed"
+	StatusUninstalling    = "uninstalling"
+	StatusPendingInstall  = "pending-install"
+	StatusPendingUpgrade  = "pending-upgrade"
+	StatusPendingRollback = "pending-rollback"
+)
+
+// v2StatusCodes maps the Helm 2 status codes to release states.
+var v2StatusCodes = []string{
+	StatusUnknown,
+	StatusDeployed,
+	StatusUninstalled,
+	StatusSuperseded,
+	StatusFailed,
+	StatusUninstalling,
+	StatusPendingInstall,
+	StatusPendingUpgrade,
+	StatusPendingRollback,
+}
+
+type ReleaseStatus struct {
+	Name         string    `json:"name"`
+	Namespace    string    `json:"namespace"`
+	Status       string    `json:"status"`
+	Revision     int       `json:"revision,omitempty"`
+	Description  string    `json:"description,omitempty"`
+	Notes        string    `json:"notes,omitempty"`
+	Resources    string    `json:"resources,omitempty"`
+	LastDeployed time.Time `json:"last_deployed,omitempty"`
+}
+
+type v2StatusResponse struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Info      struct {
+		Status struct {
+			Code      int    `json:"code"`
+			Resources string `json:"resources"`
+			Notes     string `json:"notes"`
+		} `json:"status"`
+		LastDeployed struct {
+			Seconds int64 `json:"seconds"`
+			Nanos   int64 `json:"nanos"`
+		} `json:"last_deployed"`
+		Description string `json:"Description"`
+	} `json:"info"`
+}
+
+type v3StatusResponse struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Version   int    `json:"version"`
+	Info      struct {
+		Status       string          `json:"status"`
+		Description  string          `json:"description"`
+		Notes        string          `json:"notes"`
+		Resources    json.RawMessage `json:"resources"`
+		LastDeployed time.Time       `json:"last_deployed"`
+	} `json:"info"`
+}
+
+// ParseV2Status parses the output of `helm status --output json` for Helm 2.
+func ParseV2Status(content string) (ReleaseStatus, error) {
+	response := v2StatusResponse{}
+	if err := json.Unmarshal([]byte(content), &response); err != nil {
+		return ReleaseStatus{}, fmt.Errorf("Error parsing release status: %s", err)
+	}
+
+	status := StatusUnknown
+	if code := response.Info.Status.Code; code >= 0 && code < len(v2StatusCodes) {
+		status = v2StatusCodes[code]
+	}
+
+	releaseStatus := ReleaseStatus{
+		Name:        response.Name,
+		Namespace:   response.Namespace,
+		Status:      status,
+		Description: response.Info.Description,
+		Notes:       response.Info.Status.Notes,
+		Resources:   response.Info.Status.Resources,
+	}
+	if response.Info.LastDeployed.Seconds > 0 {
+		releaseStatus.LastDeployed = time.Unix(response.Info.LastDeployed.Seconds, response.Info.LastDeployed.Nanos).UTC()
+	}
+
+	return releaseStatus, nil
+}
+
+// ParseV3Status parses the output of `helm status --output json` for Helm 3.
+func ParseV3Status(content string) (ReleaseStatus, error) {
+	response := v3StatusResponse{}
+	if err := json.Unmarshal([]byte(content), &response); err != nil {
+		return ReleaseStatus{}, fmt.Errorf("Error parsing release status: %s", err)
+	}
+
+	status := response.Info.Status
+	if status == "" {
+		status = StatusUnknown
+	}
+
+	releaseStatus := ReleaseStatus{
+		Name:         response.Name,
+		Namespace:    response.Namespace,
+		Status:       status,
+		Revision:     response.Version,
+		Description:  response.Info.Description,
+		Notes:        response.Info.Notes,
+		LastDeployed: response.Info.LastDeployed.UTC(),
+	}
+	if len(response.Info.Resources) > 0 && string(response.Info.Resources) != "null" {
+		releaseStatus.Resources = string(response.Info.Resources)
+	}
+
+	return releaseStatus, nil
+}
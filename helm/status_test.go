@@ -0,0 +1,106 @@
+package helm_test
+
+import (
+	"strconv"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/frodenas/helm-osb/helm"
+)
+
+var _ = Describe("ReleaseStatus", func() {
+	Describe("ParseV2Status", func() {
+		It("returns the release status", func() {
+			releaseStatus, err := ParseV2Status(`{
+				"name": "fake-release",
+				"namespace": "fake-namespace",
+				"info": {
+					"status": {"code": 4, "resources": "==> v1/Pod", "notes": "fake-notes"},
+					"last_deployed": {"seconds": 1514764800, "nanos": 0},
+					"Description": "Upgrade \"fake-release\" failed: timed out waiting for the condition"
+				}
+			}`)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(releaseStatus).To(Equal(ReleaseStatus{
+				Name:         "fake-release",
+				Namespace:    "fake-namespace",
+				Status:       StatusFailed,
+				Description:  `Upgrade "fake-release" failed: timed out waiting for the condition`,
+				Notes:        "fake-notes",
+				Resources:    "==> v1/Pod",
+				LastDeployed: time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+			}))
+		})
+
+		It("maps every Helm 2 status code", func() {
+			for code, status := range []string{
+				StatusUnknown,
+				StatusDeployed,
+				StatusUninstalled,
+				StatusSuperseded,
+				StatusFailed,
+				StatusUninstalling,
+				StatusPendingInstall,
+				StatusPendingUpgrade,
+				StatusPendingRollback,
+			} {
+				releaseStatus, err := ParseV2Status(`{"info":{"status":{"code":` + strconv.Itoa(code) + `}}}`)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(releaseStatus.Status).To(Equal(status))
+			}
+		})
+
+		It("returns unknown for unexpected status codes", func() {
+			releaseStatus, err := ParseV2Status(`{"info":{"status":{"code":42}}}`)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(releaseStatus.Status).To(Equal(StatusUnknown))
+		})
+
+		It("returns error if the output is not valid", func() {
+			_, err := ParseV2Status("STATUS: DEPLOYED")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Error parsing release status"))
+		})
+	})
+
+	Describe("ParseV3Status", func() {
+		It("returns the release status", func() {
+			releaseStatus, err := ParseV3Status(`{
+				"name": "fake-release",
+				"namespace": "fake-namespace",
+				"version": 3,
+				"info": {
+					"status": "deployed",
+					"description": "Upgrade complete",
+					"notes": "fake-notes",
+					"resources": {"v1/Pod": []},
+					"last_deployed": "2018-01-01T01:00:00+01:00"
+				}
+			}`)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(releaseStatus).To(Equal(ReleaseStatus{
+				Name:         "fake-release",
+				Namespace:    "fake-namespace",
+				Status:       StatusDeployed,
+				Revision:     3,
+				Description:  "Upgrade complete",
+				Notes:        "fake-notes",
+				Resources:    `{"v1/Pod": []}`,
+				LastDeployed: time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+			}))
+		})
+
+		It("returns unknown if the status is missing", func() {
+			releaseStatus, err := ParseV3Status(`{"info":{}}`)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(releaseStatus.Status).To(Equal(StatusUnknown))
+		})
+
+		It("returns error if the output is not valid", func() {
+			_, err := ParseV3Status("STATUS: deployed")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
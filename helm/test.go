@@ -0,0 +1,69 @@
+package helm
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	v2FailedTestRe = regexp.MustCompile(`^FAILED: ([^,\s]+)`)
+	v3TestSuiteRe  = regexp.MustCompile(`^TEST SUITE:\s+(\S+)`)
+	v3TestPhaseRe  = regexp.MustCompile(`^Phase:\s+(\S+)`)
+	v3PodLogsRe    = regexp.MustCompile(`^POD LOGS:\s+(\S+)`)
+)
+
+// testError builds the error of a failed `helm test` command, summarizing the
+// failed test pods and the last line they logged, if any.
+func testError(release string, output string, err error) error {
+	failedTests := []string{}
+	lastLogLines := map[string]string{}
+
+	currentTest, currentLogs := "", ""
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+
+		if matches := v2FailedTestRe.FindStringSubmatch(line); matches != nil {
+			failedTests = append(failedTests, matches[1])
+			continue
+		}
+		if matches := v3TestSuiteRe.FindStringSubmatch(line); matches != nil {
+			currentTest, currentLogs = matches[1], ""
+			continue
+		}
+		if matches := v3TestPhaseRe.FindStringSubmatch(line); matches != nil && currentTest != "" {
+			if matches[1] == "Failed" {
+				failedTests = append(failedTests, currentTest)
+			}
+			currentTest = ""
+			continue
+		}
+		if matches := v3PodLogsRe.FindStringSubmatch(line); matches != nil {
+			currentLogs = matches[1]
+			continue
+		}
+		if currentLogs != "" && line != "" {
+			lastLogLines[currentLogs] = line
+		}
+	}
+
+	if len(failedTests) == 0 {
+		return releaseError("testing", release, err)
+	}
+
+	summaries := []string{}
+	for _, test := range failedTests {
+		if logLine, ok := lastLogLines[test]; ok {
+			summaries = append(summaries, fmt.Sprintf("%s (%s)", test, logLine))
+		} else {
+			summaries = append(summaries, test)
+		}
+	}
+
+	return &Error{
+		Reason:  ReasonTestFailed,
+		Action:  "testing",
+		Release: release,
+		Message: fmt.Sprintf("Tests failed: %s", strings.Join(summaries, ", ")),
+	}
+}
@@ -0,0 +1,190 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"code.cloudfoundry.org/lager"
+)
+
+// V2Driver drives Helm 2 releases through Tiller.
+type V2Driver struct {
+	client
+}
+
+func NewV2Driver(config Config, logger lager.Logger) *V2Driver {
+	return &V2Driver{
+		client: client{
+			config: config,
+			logger: logger.Session("helm"),
+		},
+	}
+}
+
+func (d *V2Driver) InstallRelease(ctx context.Context, release Release, chart string, repository string, version string, values map[string]interface{}) error {
+	d.logger.Debug("install-release-parameters", lager.Data{
+		releaseLogKey:    release,
+		chartLogKey:      chart,
+		repositoryLogKey: repository,
+		versionLogKey:    version,
+		valuesLogKey:     values,
+	})
+
+	cmd := fmt.Sprintf("install %s --name %s --namespace %s", chart, release.Name, release.Namespace)
+	cmd = cmd + d.chartArgs(repository, version)
+	if len(values) > 0 {
+		valuesFile, err := d.writeValuesFile(release.Name, values)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(valuesFile)
+
+		cmd = cmd + " --values " + valuesFile
+	}
+
+	if _, err := d.helm(ctx, cmd); err != nil {
+		return releaseError("installing", release.Name, err)
+	}
+
+	return nil
+}
+
+func (d *V2Driver) UpgradeRelease(ctx context.Context, release Release, chart string, repository string, version string, values map[string]interface{}) error {
+	d.logger.Debug("upgrade-release-parameters", lager.Data{
+		releaseLogKey:    release,
+		chartLogKey:      chart,
+		repositoryLogKey: repository,
+		versionLogKey:    version,
+		valuesLogKey:     values,
+	})
+
+	cmd := fmt.Sprintf("upgrade %s %s --namespace %s", release.Name, chart, release.Namespace)
+	cmd = cmd + d.chartArgs(repository, version)
+	if len(values) > 0 {
+		valuesFile, err := d.writeValuesFile(release.Name, values)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(valuesFile)
+
+		cmd = cmd + " --values " + valuesFile
+	}
+
+	if _, err := d.helm(ctx, cmd); err != nil {
+		return releaseError("upgrading", release.Name, err)
+	}
+
+	return nil
+}
+
+func (d *V2Driver) DeleteRelease(ctx context.Context, release Release) error {
+	d.logger.Debug("delete-release-parameters", lager.Data{
+		releaseLogKey: release,
+	})
+
+	cmd := fmt.Sprintf("delete --purge %s", release.Name)
+	if _, err := d.helm(ctx, cmd); err != nil {
+		return releaseError("deleting", release.Name, err)
+	}
+
+	return nil
+}
+
+func (d *V2Driver) RollbackRelease(ctx context.Context, release Release, revision int) error {
+	d.logger.Debug("rollback-release-parameters", lager.Data{
+		releaseLogKey:  release,
+		revisionLogKey: revision,
+	})
+
+	cmd := fmt.Sprintf("rollback %s %d", release.Name, revision)
+	if _, err := d.helm(ctx, cmd); err != nil {
+		return releaseError("rolling back", release.Name, err)
+	}
+
+	return nil
+}
+
+func (d *V2Driver) TestRelease(ctx context.Context, release Release) error {
+	d.logger.Debug("test-release-parameters", lager.Data{
+		releaseLogKey: release,
+	})
+
+	cmd := fmt.Sprintf("test %s --cleanup", release.Name)
+	if out, err := d.helm(ctx, cmd); err != nil {
+		return testError(release.Name, out, err)
+	}
+
+	return nil
+}
+
+func (d *V2Driver) ReleaseStatus(ctx context.Context, release Release) (ReleaseStatus, error) {
+	d.logger.Debug("release-status-parameters", lager.Data{
+		releaseLogKey: release,
+	})
+
+	cmd := fmt.Sprintf("status %s --output json", release.Name)
+	out, err := d.helm(ctx, cmd)
+	if err != nil {
+		return ReleaseStatus{}, releaseError("getting status for", release.Name, err)
+	}
+
+	return ParseV2Status(out)
+}
+
+func (d *V2Driver) ReleaseHistory(ctx context.Context, release Release) ([]ReleaseRevision, error) {
+	d.logger.Debug("release-history-parameters", lager.Data{
+		releaseLogKey: release,
+	})
+
+	cmd := fmt.Sprintf("history %s --output json", release.Name)
+	out, err := d.helm(ctx, cmd)
+	if err != nil {
+		return nil, releaseError("getting history for", release.Name, err)
+	}
+
+	return ParseHistory(out)
+}
+
+func (d *V2Driver) ReleaseValues(ctx context.Context, release Release) (map[string]interface{}, error) {
+	d.logger.Debug("release-values-parameters", lager.Data{
+		releaseLogKey: release,
+	})
+
+	cmd := fmt.Sprintf("get values %s", release.Name)
+	out, err := d.helm(ctx, cmd)
+	if err != nil {
+		return map[string]interface{}{}, releaseError("getting values for", release.Name, err)
+	}
+
+	return d.parseValues(release.Name, out)
+}
+
+func (d *V2Driver) ReleaseManifest(ctx context.Context, release Release) (Manifest, error) {
+	d.logger.Debug("release-manifest-parameters", lager.Data{
+		releaseLogKey: release,
+	})
+
+	cmd := fmt.Sprintf("get manifest %s", release.Name)
+	out, err := d.helm(ctx, cmd)
+	if err != nil {
+		return Manifest{}, releaseError("getting manifest for", release.Name, err)
+	}
+
+	return ParseManifest(out, release.Namespace)
+}
+
+func (d *V2Driver) helm(ctx context.Context, cmd string) (string, error) {
+	args := []string{}
+	if d.config.TillerHost != "" {
+		args = append(args, "--host", d.config.TillerHost)
+	}
+	if d.config.TillerNamespace != "" {
+		args = append(args, "--tiller-namespace", d.config.TillerNamespace)
+	}
+	if d.config.Home != "" {
+		args = append(args, "--home", d.config.Home)
+	}
+
+	return d.exec(ctx, args, cmd)
+}
@@ -0,0 +1,176 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"code.cloudfoundry.org/lager"
+)
+
+// V3Driver drives Helm 3 releases. Helm 3 talks to the Kubernetes API directly
+// and scopes every release to a namespace.
+type V3Driver struct {
+	client
+}
+
+func NewV3Driver(config Config, logger lager.Logger) *V3Driver {
+	return &V3Driver{
+		client: client{
+			config: config,
+			logger: logger.Session("helm"),
+		},
+	}
+}
+
+func (d *V3Driver) InstallRelease(ctx context.Context, release Release, chart string, repository string, version string, values map[string]interface{}) error {
+	d.logger.Debug("install-release-parameters", lager.Data{
+		releaseLogKey:    release,
+		chartLogKey:      chart,
+		repositoryLogKey: repository,
+		versionLogKey:    version,
+		valuesLogKey:     values,
+	})
+
+	cmd := fmt.Sprintf("install %s %s --namespace %s --create-namespace", release.Name, chart, release.Namespace)
+	cmd = cmd + d.chartArgs(repository, version)
+	if len(values) > 0 {
+		valuesFile, err := d.writeValuesFile(release.Name, values)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(valuesFile)
+
+		cmd = cmd + " --values " + valuesFile
+	}
+
+	if _, err := d.exec(ctx, nil, cmd); err != nil {
+		return releaseError("installing", release.Name, err)
+	}
+
+	return nil
+}
+
+func (d *V3Driver) UpgradeRelease(ctx context.Context, release Release, chart string, repository string, version string, values map[string]interface{}) error {
+	d.logger.Debug("upgrade-release-parameters", lager.Data{
+		releaseLogKey:    release,
+		chartLogKey:      chart,
+		repositoryLogKey: repository,
+		versionLogKey:    version,
+		valuesLogKey:     values,
+	})
+
+	cmd := fmt.Sprintf("upgrade %s %s --namespace %s", release.Name, chart, release.Namespace)
+	cmd = cmd + d.chartArgs(repository, version)
+	if len(values) > 0 {
+		valuesFile, err := d.writeValuesFile(release.Name, values)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(valuesFile)
+
+		cmd = cmd + " --values " + valuesFile
+	}
+
+	if _, err := d.exec(ctx, nil, cmd); err != nil {
+		return releaseError("upgrading", release.Name, err)
+	}
+
+	return nil
+}
+
+func (d *V3Driver) DeleteRelease(ctx context.Context, release Release) error {
+	d.logger.Debug("delete-release-parameters", lager.Data{
+		releaseLogKey: release,
+	})
+
+	cmd := fmt.Sprintf("uninstall %s --namespace %s", release.Name, release.Namespace)
+	if _, err := d.exec(ctx, nil, cmd); err != nil {
+		return releaseError("deleting", release.Name, err)
+	}
+
+	return nil
+}
+
+func (d *V3Driver) RollbackRelease(ctx context.Context, release Release, revision int) error {
+	d.logger.Debug("rollback-release-parameters", lager.Data{
+		releaseLogKey:  release,
+		revisionLogKey: revision,
+	})
+
+	cmd := fmt.Sprintf("rollback %s %d --namespace %s", release.Name, revision, release.Namespace)
+	if _, err := d.exec(ctx, nil, cmd); err != nil {
+		return releaseError("rolling back", release.Name, err)
+	}
+
+	return nil
+}
+
+func (d *V3Driver) TestRelease(ctx context.Context, release Release) error {
+	d.logger.Debug("test-release-parameters", lager.Data{
+		releaseLogKey: release,
+	})
+
+	cmd := fmt.Sprintf("test %s --namespace %s --logs", release.Name, release.Namespace)
+	if out, err := d.exec(ctx, nil, cmd); err != nil {
+		return testError(release.Name, out, err)
+	}
+
+	return nil
+}
+
+func (d *V3Driver) ReleaseStatus(ctx context.Context, release Release) (ReleaseStatus, error) {
+	d.logger.Debug("release-status-parameters", lager.Data{
+		releaseLogKey: release,
+	})
+
+	cmd := fmt.Sprintf("status %s --namespace %s --output json", release.Name, release.Namespace)
+	out, err := d.exec(ctx, nil, cmd)
+	if err != nil {
+		return ReleaseStatus{}, releaseError("getting status for", release.Name, err)
+	}
+
+	return ParseV3Status(out)
+}
+
+func (d *V3Driver) ReleaseHistory(ctx context.Context, release Release) ([]ReleaseRevision, error) {
+	d.logger.Debug("release-history-parameters", lager.Data{
+		releaseLogKey: release,
+	})
+
+	cmd := fmt.Sprintf("history %s --namespace %s --output json", release.Name, release.Namespace)
+	out, err := d.exec(ctx, nil, cmd)
+	if err != nil {
+		return nil, releaseError("getting history for", release.Name, err)
+	}
+
+	return ParseHistory(out)
+}
+
+func (d *V3Driver) ReleaseValues(ctx context.Context, release Release) (map[string]interface{}, error) {
+	d.logger.Debug("release-values-parameters", lager.Data{
+		releaseLogKey: release,
+	})
+
+	cmd := fmt.Sprintf("get values %s --namespace %s --output yaml", release.Name, release.Namespace)
+	out, err := d.exec(ctx, nil, cmd)
+	if err != nil {
+		return map[string]interface{}{}, releaseError("getting values for", release.Name, err)
+	}
+
+	return d.parseValues(release.Name, out)
+}
+
+func (d *V3Driver) ReleaseManifest(ctx context.Context, release Release) (Manifest, error) {
+	d.logger.Debug("release-manifest-parameters", lager.Data{
+		releaseLogKey: release,
+	})
+
+	cmd := fmt.Sprintf("get manifest %s --namespace %s", release.Name, release.Namespace)
+	out, err := d.exec(ctx, nil, cmd)
+	if err != nil {
+		return Manifest{}, releaseError("getting manifest for", release.Name, err)
+	}
+
+	return ParseManifest(out, release.Namespace)
+}
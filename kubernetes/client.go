@@ -0,0 +1,251 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"code.cloudfoundry.org/lager"
+)
+
+const (
+	namespaceLogKey     = "namespace"
+	nameLogKey          = "name"
+	kindLogKey          = "kind"
+	labelSelectorLogKey = "label-selector"
+	programLogKey       = "program"
+	argumentsLogKey     = "arguments"
+	outputLogKey        = "output"
+	errorOutputLogKey   = "error-output"
+)
+
+type Client struct {
+	config Config
+	logger lager.Logger
+}
+
+func New(config Config, logger lager.Logger) *Client {
+	return &Client{
+		config: config,
+		logger: logger.Session("kubernetes"),
+	}
+}
+
+func (c *Client) GetSecret(namespace string, name string) (Secret, bool, error) {
+	c.logger.Debug("get-secret-parameters", lager.Data{
+		namespaceLogKey: namespace,
+		nameLogKey:      name,
+	})
+
+	secret := Secret{}
+
+	out, err := c.kubectl(nil, "get", "secret", name, "--namespace", namespace, "--ignore-not-found", "--output", "json")
+	if err != nil {
+		return secret, false, fmt.Errorf("Error getting Secret `%s/%s`: %s", namespace, name, err)
+	}
+
+	if strings.TrimSpace(out) == "" {
+		return secret, false, nil
+	}
+
+	if err := json.Unmarshal([]byte(out), &secret); err != nil {
+		return secret, false, fmt.Errorf("Error parsing Secret `%s/%s`: %s", namespace, name, err)
+	}
+
+	return secret, true, nil
+}
+
+func (c *Client) ListSecrets(namespace string, labelSelector string) ([]Secret, error) {
+	c.logger.Debug("list-secrets-parameters", lager.Data{
+		namespaceLogKey:     namespace,
+		labelSelectorLogKey: labelSelector,
+	})
+
+	secretList := SecretList{}
+
+	out, err := c.kubectl(nil, "get", "secrets", "--namespace", namespace, "--selector", labelSelector, "--output", "json")
+	if err != nil {
+		return secretList.Items, fmt.Errorf("Error listing Secrets in namespace `%s`: %s", namespace, err)
+	}
+
+	if err := json.Unmarshal([]byte(out), &secretList); err != nil {
+		return secretList.Items, fmt.Errorf("Error parsing Secrets in namespace `%s`: %s", namespace, err)
+	}
+
+	return secretList.Items, nil
+}
+
+func (c *Client) SaveSecret(secret Secret) error {
+	c.logger.Debug("save-secret-parameters", lager.Data{
+		namespaceLogKey: secret.Metadata.Namespace,
+		nameLogKey:      secret.Metadata.Name,
+	})
+
+	_, found, err := c.GetSecret(secret.Metadata.Namespace, secret.Metadata.Name)
+	if err != nil {
+		return err
+	}
+
+	secret.APIVersion = "v1"
+	secret.Kind = "Secret"
+	content, err := json.Marshal(secret)
+	if err != nil {
+		return fmt.Errorf("Error marshalling Secret `%s/%s`: %s", secret.Metadata.Namespace, secret.Metadata.Name, err)
+	}
+
+	action := "create"
+	if found {
+		action = "replace"
+	}
+
+	if _, err := c.kubectl(content, action, "--filename", "-"); err != nil {
+		return fmt.Errorf("Error saving Secret `%s/%s`: %s", secret.Metadata.Namespace, secret.Metadata.Name, err)
+	}
+
+	return nil
+}
+
+func (c *Client) DeleteSecret(namespace string, name string) error {
+	c.logger.Debug("delete-secret-parameters", lager.Data{
+		namespaceLogKey: namespace,
+		nameLogKey:      name,
+	})
+
+	if _, err := c.kubectl(nil, "delete", "secret", name, "--namespace", namespace, "--ignore-not-found"); err != nil {
+		return fmt.Errorf("Error deleting Secret `%s/%s`: %s", namespace, name, err)
+	}
+
+	return nil
+}
+
+// GetObject reads an object of the given kind into object, which must be a
+// pointer to one of the object types of this package.
+func (c *Client) GetObject(namespace string, kind string, name string, object interface{}) (bool, error) {
+	c.logger.Debug("get-object-parameters", lager.Data{
+		namespaceLogKey: namespace,
+		kindLogKey:      kind,
+		nameLogKey:      name,
+	})
+
+	out, err := c.kubectl(nil, "get", kind, name, "--namespace", namespace, "--ignore-not-found", "--output", "json")
+	if err != nil {
+		return false, fmt.Errorf("Error getting %s `%s/%s`: %s", kind, namespace, name, err)
+	}
+
+	if strings.TrimSpace(out) == "" {
+		return false, nil
+	}
+
+	if err := json.Unmarshal([]byte(out), object); err != nil {
+		return false, fmt.Errorf("Error parsing %s `%s/%s`: %s", kind, namespace, name, err)
+	}
+
+	return true, nil
+}
+
+func (c *Client) GetNamespace(name string) (Namespace, bool, error) {
+	c.logger.Debug("get-namespace-parameters", lager.Data{
+		nameLogKey: name,
+	})
+
+	namespace := Namespace{}
+
+	out, err := c.kubectl(nil, "get", "namespace", name, "--ignore-not-found", "--output", "json")
+	if err != nil {
+		return namespace, false, fmt.Errorf("Error getting Namespace `%s`: %s", name, err)
+	}
+
+	if strings.TrimSpace(out) == "" {
+		return namespace, false, nil
+	}
+
+	if err := json.Unmarshal([]byte(out), &namespace); err != nil {
+		return namespace, false, fmt.Errorf("Error parsing Namespace `%s`: %s", name, err)
+	}
+
+	return namespace, true, nil
+}
+
+func (c *Client) CreateNamespace(namespace Namespace) error {
+	c.logger.Debug("create-namespace-parameters", lager.Data{
+		nameLogKey: namespace.Metadata.Name,
+	})
+
+	namespace.APIVersion = "v1"
+	namespace.Kind = "Namespace"
+	content, err := json.Marshal(namespace)
+	if err != nil {
+		return fmt.Errorf("Error marshalling Namespace `%s`: %s", namespace.Metadata.Name, err)
+	}
+
+	if _, err := c.kubectl(content, "create", "--filename", "-"); err != nil {
+		return fmt.Errorf("Error creating Namespace `%s`: %s", namespace.Metadata.Name, err)
+	}
+
+	return nil
+}
+
+func (c *Client) DeleteNamespace(name string) error {
+	c.logger.Debug("delete-namespace-parameters", lager.Data{
+		nameLogKey: name,
+	})
+
+	if _, err := c.kubectl(nil, "delete", "namespace", name, "--ignore-not-found", "--wait=false"); err != nil {
+		return fmt.Errorf("Error deleting Namespace `%s`: %s", name, err)
+	}
+
+	return nil
+}
+
+func (c *Client) kubectl(stdin []byte, cmd ...string) (string, error) {
+	args := []string{}
+	if c.config.Kubeconfig != "" {
+		args = append(args, "--kubeconfig", c.config.Kubeconfig)
+	}
+	if c.config.KubeContext != "" {
+		args = append(args, "--context", c.config.KubeContext)
+	}
+
+	args = append(args, cmd...)
+
+	c.logger.Debug("exec", lager.Data{
+		programLogKey:   c.config.BinaryLocation,
+		argumentsLogKey: args,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.CommandTimeout())
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	command := exec.CommandContext(ctx, c.config.BinaryLocation, args...)
+	if stdin != nil {
+		command.Stdin = bytes.NewReader(stdin)
+	}
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+
+	if err := command.Run(); err != nil {
+		c.logger.Error("exec", err)
+		c.logger.Debug("exec", lager.Data{
+			outputLogKey:      stdout.String(),
+			errorOutputLogKey: stderr.String(),
+		})
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("kubectl timed out after %s", c.config.CommandTimeout())
+		}
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", errors.New(message)
+		}
+		return "", err
+	}
+
+	c.logger.Debug("exec", lager.Data{
+		outputLogKey: stdout.String(),
+	})
+
+	return stdout.String(), nil
+}
@@ -0,0 +1,73 @@
+package kubernetes_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/lager/lagertest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/frodenas/helm-osb/kubernetes"
+)
+
+var _ = Describe("Client", func() {
+	var (
+		tmpDir string
+		config Config
+	)
+
+	writeFakeKubectl := func(script string) {
+		err := ioutil.WriteFile(config.BinaryLocation, []byte("#!/bin/sh\n"+script), 0700)
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "kubectl")
+		Expect(err).ToNot(HaveOccurred())
+
+		config = Config{
+			BinaryLocation: filepath.Join(tmpDir, "kubectl"),
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	Describe("GetNamespace", func() {
+		It("parses the output without the warnings kubectl writes to stderr", func() {
+			writeFakeKubectl(`echo "warning: fake-warning" >&2
+echo '{"metadata": {"name": "fake-namespace"}}'
+`)
+			client := New(config, lagertest.NewTestLogger("kubernetes"))
+
+			namespace, found, err := client.GetNamespace("fake-namespace")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(BeTrue())
+			Expect(namespace.Metadata.Name).To(Equal("fake-namespace"))
+		})
+
+		It("returns error with the kubectl error output if kubectl fails", func() {
+			writeFakeKubectl(`echo "error: fake-error" >&2
+exit 1
+`)
+			client := New(config, lagertest.NewTestLogger("kubernetes"))
+
+			_, _, err := client.GetNamespace("fake-namespace")
+			Expect(err).To(MatchError("Error getting Namespace `fake-namespace`: error: fake-error"))
+		})
+
+		It("returns error if kubectl does not complete within the timeout", func() {
+			writeFakeKubectl("exec sleep 10\n")
+			config.Timeout = 1
+			client := New(config, lagertest.NewTestLogger("kubernetes"))
+
+			_, _, err := client.GetNamespace("fake-namespace")
+			Expect(err).To(MatchError("Error getting Namespace `fake-namespace`: kubectl timed out after 1s"))
+		})
+	})
+})
@@ -0,0 +1,38 @@
+package kubernetes
+
+import (
+	"errors"
+	"time"
+)
+
+const defaultTimeout = 1 * time.Minute
+
+// Config configures the kubectl client. Timeout sets, in seconds, how long
+// each kubectl command may run before it is cancelled. Zero falls back to
+// one minute.
+type Config struct {
+	BinaryLocation string `json:"binary_location"`
+	KubeContext    string `json:"kube_context,omitempty"`
+	Kubeconfig     string `json:"kubeconfig,omitempty"`
+	Timeout        int    `json:"timeout,omitempty"`
+}
+
+func (c Config) Validate() error {
+	if c.BinaryLocation == "" {
+		return errors.New("Must provide a non-empty Binary Location")
+	}
+
+	if c.Timeout < 0 {
+		return errors.New("Must provide a non-negative Timeout")
+	}
+
+	return nil
+}
+
+func (c Config) CommandTimeout() time.Duration {
+	if c.Timeout == 0 {
+		return defaultTimeout
+	}
+
+	return time.Duration(c.Timeout) * time.Second
+}
@@ -0,0 +1,59 @@
+package kubernetes_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/frodenas/helm-osb/kubernetes"
+)
+
+var _ = Describe("Config", func() {
+	var (
+		config Config
+
+		validConfig = Config{
+			BinaryLocation: "kubectl",
+		}
+	)
+
+	Describe("Validate", func() {
+		BeforeEach(func() {
+			config = validConfig
+		})
+
+		It("does not return error if all sections are valid", func() {
+			err := config.Validate()
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("returns error if Binary Location is not valid", func() {
+			config.BinaryLocation = ""
+
+			err := config.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Must provide a non-empty Binary Location"))
+		})
+
+		It("returns error if Timeout is negative", func() {
+			config.Timeout = -1
+
+			err := config.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Must provide a non-negative Timeout"))
+		})
+	})
+
+	Describe("CommandTimeout", func() {
+		It("returns the default timeout if Timeout is not set", func() {
+			Expect(validConfig.CommandTimeout()).To(Equal(1 * time.Minute))
+		})
+
+		It("returns the configured timeout", func() {
+			config = validConfig
+			config.Timeout = 5
+			Expect(config.CommandTimeout()).To(Equal(5 * time.Second))
+		})
+	})
+})
@@ -0,0 +1,71 @@
+package kubernetes
+
+type ObjectMeta struct {
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+type Secret struct {
+	APIVersion string            `json:"apiVersion,omitempty"`
+	Kind       string            `json:"kind,omitempty"`
+	Metadata   ObjectMeta        `json:"metadata"`
+	Data       map[string][]byte `json:"data,omitempty"`
+}
+
+type SecretList struct {
+	Items []Secret `json:"items"`
+}
+
+type Namespace struct {
+	APIVersion string     `json:"apiVersion,omitempty"`
+	Kind       string     `json:"kind,omitempty"`
+	Metadata   ObjectMeta `json:"metadata"`
+}
+
+type Deployment struct {
+	Metadata ObjectMeta     `json:"metadata"`
+	Spec     WorkloadSpec   `json:"spec"`
+	Status   WorkloadStatus `json:"status"`
+}
+
+type StatefulSet struct {
+	Metadata ObjectMeta     `json:"metadata"`
+	Spec     WorkloadSpec   `json:"spec"`
+	Status   WorkloadStatus `json:"status"`
+}
+
+type WorkloadSpec struct {
+	Replicas *int `json:"replicas,omitempty"`
+}
+
+type WorkloadStatus struct {
+	Replicas        int `json:"replicas"`
+	ReadyReplicas   int `json:"readyReplicas"`
+	UpdatedReplicas int `json:"updatedReplicas"`
+}
+
+type Job struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Spec     JobSpec    `json:"spec"`
+	Status   JobStatus  `json:"status"`
+}
+
+type JobSpec struct {
+	Completions *int `json:"completions,omitempty"`
+}
+
+type JobStatus struct {
+	Active    int `json:"active"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+}
+
+type PersistentVolumeClaim struct {
+	Metadata ObjectMeta                  `json:"metadata"`
+	Status   PersistentVolumeClaimStatus `json:"status"`
+}
+
+type PersistentVolumeClaimStatus struct {
+	Phase string `json:"phase"`
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
@@ -13,6 +14,8 @@ import (
 
 	"github.com/frodenas/helm-osb/broker"
 	"github.com/frodenas/helm-osb/helm"
+	"github.com/frodenas/helm-osb/kubernetes"
+	"github.com/frodenas/helm-osb/store"
 )
 
 var (
@@ -27,19 +30,36 @@ var (
 	}
 )
 
-func buildLogger(logLevel string) lager.Logger {
+func buildLogger(logLevel string, sink io.Writer) lager.Logger {
 	laggerLogLevel, ok := logLevels[strings.ToUpper(logLevel)]
 	if !ok {
 		log.Fatalf("Log level `%s` is invalid", logLevel)
 	}
 
 	logger := lager.NewLogger("helm-osb")
-	logger.RegisterSink(lager.NewWriterSink(os.Stdout, laggerLogLevel))
+	logger.RegisterSink(lager.NewWriterSink(sink, laggerLogLevel))
 
 	return logger
 }
 
+func buildBroker(config *Config, logger lager.Logger) *broker.Broker {
+	helmDriver := helm.New(config.HelmConfig, logger)
+
+	kubernetesClient := kubernetes.New(config.KubernetesConfig, logger)
+
+	stateStore, err := store.New(config.StoreConfig, kubernetesClient)
+	if err != nil {
+		log.Fatalf("Error creating state store: %s", err)
+	}
+
+	return broker.New(config.BrokerConfig, helmDriver, kubernetesClient, stateStore, logger)
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == upgradeFleetCommand {
+		os.Exit(upgradeFleet(os.Args[2:]))
+	}
+
 	flag.Parse()
 
 	config, err := LoadConfig(*configFilePath)
@@ -47,18 +67,16 @@ func main() {
 		log.Fatalf("Error loading configuration file: %s", err)
 	}
 
-	logger := buildLogger(config.LogLevel)
-
-	helmClient := helm.New(config.HelmConfig, logger)
+	logger := buildLogger(config.LogLevel, os.Stdout)
 
-	serviceBroker := broker.New(config.BrokerConfig, helmClient, logger)
+	serviceBroker := buildBroker(config, logger)
 
 	credentials := brokerapi.BrokerCredentials{
 		Username: config.BrokerConfig.Username,
 		Password: config.BrokerConfig.Password,
 	}
 
-	brokerAPI := brokerapi.New(serviceBroker, logger, credentials)
+	brokerAPI := broker.NewAPI(serviceBroker, logger, credentials)
 	http.Handle("/", brokerAPI)
 
 	fmt.Println("Starting Kubernetes Helm Open Service Broker...")
@@ -0,0 +1,796 @@
+// Package schema implements the subset of JSON Schema (draft-04 and later)
+// needed to validate Open Service Broker parameters.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const rootPath = "(root)"
+
+var jsonTypes = map[string]bool{
+	"array":   true,
+	"boolean": true,
+	"integer": true,
+	"null":    true,
+	"number":  true,
+	"object":  true,
+	"string":  true,
+}
+
+type Schema struct {
+	root *compiler
+
+	always *bool
+	ref    string
+
+	types []string
+	enum  []interface{}
+	cnst  *interface{}
+
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+	multipleOf       *float64
+
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+
+	items           *Schema
+	tupleItems      []*Schema
+	additionalItems *Schema
+	minItems        *int
+	maxItems        *int
+	uniqueItems     bool
+
+	properties           map[string]*Schema
+	patternProperties    map[string]*Schema
+	patternRegexps       map[string]*regexp.Regexp
+	additionalProperties *Schema
+	required             []string
+	minProperties        *int
+	maxProperties        *int
+
+	allOf []*Schema
+	anyOf []*Schema
+	oneOf []*Schema
+	not   *Schema
+}
+
+type compiler struct {
+	document interface{}
+	refs     map[string]*Schema
+}
+
+// Compile parses a JSON Schema document, returning an error if it is not a
+// valid schema.
+func Compile(content []byte) (*Schema, error) {
+	var document interface{}
+	if err := json.Unmarshal(content, &document); err != nil {
+		return nil, fmt.Errorf("Error parsing JSON Schema: %s", err)
+	}
+
+	c := &compiler{
+		document: document,
+		refs:     map[string]*Schema{},
+	}
+
+	schema, err := c.compile(document, "#")
+	if err != nil {
+		return nil, err
+	}
+
+	// Resolve every reference up front so invalid references are reported
+	// at compile time instead of during validation.
+	for len(c.pendingRefs()) > 0 {
+		for _, ref := range c.pendingRefs() {
+			if _, err := c.resolve(ref); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := c.checkCycles(schema); err != nil {
+		return nil, err
+	}
+
+	return schema, nil
+}
+
+// Validate returns the list of violations of document against the schema.
+func (s *Schema) Validate(document interface{}) []string {
+	violations := []string{}
+	s.validate(document, rootPath, &violations)
+	return violations
+}
+
+// ValidateJSON decodes content and returns the list of violations against
+// the schema.
+func (s *Schema) ValidateJSON(content []byte) ([]string, error) {
+	var document interface{}
+	if err := json.Unmarshal(content, &document); err != nil {
+		return nil, fmt.Errorf("Error parsing JSON document: %s", err)
+	}
+
+	return s.Validate(document), nil
+}
+
+func (c *compiler) pendingRefs() []string {
+	refs := []string{}
+	for ref, schema := range c.refs {
+		if schema == nil {
+			refs = append(refs, ref)
+		}
+	}
+	sort.Strings(refs)
+	return refs
+}
+
+func (c *compiler) resolve(ref string) (*Schema, error) {
+	if schema := c.refs[ref]; schema != nil {
+		return schema, nil
+	}
+
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("Unsupported remote reference `%s`", ref)
+	}
+
+	node := c.document
+	pointer := strings.TrimPrefix(ref, "#")
+	if pointer != "" {
+		if !strings.HasPrefix(pointer, "/") {
+			return nil, fmt.Errorf("Invalid reference `%s`", ref)
+		}
+
+		for _, token := range strings.Split(pointer[1:], "/") {
+			token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+
+			switch value := node.(type) {
+			case map[string]interface{}:
+				child, ok := value[token]
+				if !ok {
+					return nil, fmt.Errorf("Reference `%s` not found", ref)
+				}
+				node = child
+			case []interface{}:
+				index, err := strconv.Atoi(token)
+				if err != nil || index < 0 || index >= len(value) {
+					return nil, fmt.Errorf("Reference `%s` not found", ref)
+				}
+				node = value[index]
+			default:
+				return nil, fmt.Errorf("Reference `%s` not found", ref)
+			}
+		}
+	}
+
+	schema := &Schema{root: c}
+	c.refs[ref] = schema
+
+	compiled, err := c.compile(node, ref)
+	if err != nil {
+		return nil, err
+	}
+	*schema = *compiled
+
+	return schema, nil
+}
+
+// checkCycles returns an error if a reference leads back to itself while
+// applying to the same value, through `$ref`, `allOf`, `anyOf`, `oneOf` or
+// `not`, as validating against it would never end. References reached again
+// through keywords applying to nested values, such as `properties`, are fine.
+func (c *compiler) checkCycles(root *Schema) error {
+	visiting := map[*Schema]bool{}
+	checked := map[*Schema]bool{}
+
+	var visit func(schema *Schema) error
+	visit = func(schema *Schema) error {
+		if checked[schema] {
+			return nil
+		}
+		visiting[schema] = true
+
+		next := []*Schema{}
+		if schema.ref != "" {
+			ref := c.refs[schema.ref]
+			if visiting[ref] {
+				return fmt.Errorf("Reference `%s` is circular", schema.ref)
+			}
+			next = append(next, ref)
+		}
+		next = append(next, schema.allOf...)
+		next = append(next, schema.anyOf...)
+		next = append(next, schema.oneOf...)
+		if schema.not != nil {
+			next = append(next, schema.not)
+		}
+
+		for _, nextSchema := range next {
+			if err := visit(nextSchema); err != nil {
+				return err
+			}
+		}
+
+		visiting[schema] = false
+		checked[schema] = true
+		return nil
+	}
+
+	if err := visit(root); err != nil {
+		return err
+	}
+
+	refs := []string{}
+	for ref := range c.refs {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+
+	for _, ref := range refs {
+		if err := visit(c.refs[ref]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *compiler) compile(node interface{}, path string) (*Schema, error) {
+	schema := &Schema{root: c}
+
+	if value, ok := node.(bool); ok {
+		schema.always = &value
+		return schema, nil
+	}
+
+	document, ok := node.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: schema must be an object or a boolean", path)
+	}
+
+	if ref, ok := document["$ref"]; ok {
+		refString, ok := ref.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: `$ref` must be a string", path)
+		}
+		schema.ref = refString
+		if _, ok := c.refs[refString]; !ok {
+			c.refs[refString] = nil
+		}
+		return schema, nil
+	}
+
+	var err error
+
+	if value, ok := document["type"]; ok {
+		switch value := value.(type) {
+		case string:
+			schema.types = []string{value}
+		case []interface{}:
+			for _, item := range value {
+				itemString, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("%s: `type` must be a string or an array of strings", path)
+				}
+				schema.types = append(schema.types, itemString)
+			}
+		default:
+			return nil, fmt.Errorf("%s: `type` must be a string or an array of strings", path)
+		}
+
+		for _, t := range schema.types {
+			if !jsonTypes[t] {
+				return nil, fmt.Errorf("%s: unknown type `%s`", path, t)
+			}
+		}
+	}
+
+	if value, ok := document["enum"]; ok {
+		enum, ok := value.([]interface{})
+		if !ok || len(enum) == 0 {
+			return nil, fmt.Errorf("%s: `enum` must be a non-empty array", path)
+		}
+		schema.enum = enum
+	}
+
+	if value, ok := document["const"]; ok {
+		schema.cnst = &value
+	}
+
+	if schema.minimum, err = number(document, "minimum", path); err != nil {
+		return nil, err
+	}
+	if schema.maximum, err = number(document, "maximum", path); err != nil {
+		return nil, err
+	}
+	if schema.multipleOf, err = number(document, "multipleOf", path); err != nil {
+		return nil, err
+	}
+	if schema.multipleOf != nil && *schema.multipleOf <= 0 {
+		return nil, fmt.Errorf("%s: `multipleOf` must be greater than 0", path)
+	}
+
+	// Draft-04 uses booleans modifying minimum/maximum, later drafts use numbers.
+	for _, keyword := range []string{"exclusiveMinimum", "exclusiveMaximum"} {
+		value, ok := document[keyword]
+		if !ok {
+			continue
+		}
+
+		var limit *float64
+		switch value := value.(type) {
+		case bool:
+			if value {
+				if keyword == "exclusiveMinimum" {
+					limit, schema.minimum = schema.minimum, nil
+				} else {
+					limit, schema.maximum = schema.maximum, nil
+				}
+			}
+		case float64:
+			limit = &value
+		default:
+			return nil, fmt.Errorf("%s: `%s` must be a boolean or a number", path, keyword)
+		}
+
+		if keyword == "exclusiveMinimum" {
+			schema.exclusiveMinimum = limit
+		} else {
+			schema.exclusiveMaximum = limit
+		}
+	}
+
+	if schema.minLength, err = count(document, "minLength", path); err != nil {
+		return nil, err
+	}
+	if schema.maxLength, err = count(document, "maxLength", path); err != nil {
+		return nil, err
+	}
+	if schema.minItems, err = count(document, "minItems", path); err != nil {
+		return nil, err
+	}
+	if schema.maxItems, err = count(document, "maxItems", path); err != nil {
+		return nil, err
+	}
+	if schema.minProperties, err = count(document, "minProperties", path); err != nil {
+		return nil, err
+	}
+	if schema.maxProperties, err = count(document, "maxProperties", path); err != nil {
+		return nil, err
+	}
+
+	if value, ok := document["pattern"]; ok {
+		pattern, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: `pattern` must be a string", path)
+		}
+		if schema.pattern, err = regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("%s: invalid `pattern`: %s", path, err)
+		}
+	}
+
+	if value, ok := document["uniqueItems"]; ok {
+		if schema.uniqueItems, ok = value.(bool); !ok {
+			return nil, fmt.Errorf("%s: `uniqueItems` must be a boolean", path)
+		}
+	}
+
+	if value, ok := document["items"]; ok {
+		if tuple, ok := value.([]interface{}); ok {
+			for i, item := range tuple {
+				itemSchema, err := c.compile(item, fmt.Sprintf("%s/items/%d", path, i))
+				if err != nil {
+					return nil, err
+				}
+				schema.tupleItems = append(schema.tupleItems, itemSchema)
+			}
+		} else if schema.items, err = c.compile(value, path+"/items"); err != nil {
+			return nil, err
+		}
+	}
+
+	if value, ok := document["additionalItems"]; ok {
+		if schema.additionalItems, err = c.compile(value, path+"/additionalItems"); err != nil {
+			return nil, err
+		}
+	}
+
+	if schema.properties, err = c.compileMap(document, "properties", path); err != nil {
+		return nil, err
+	}
+
+	if schema.patternProperties, err = c.compileMap(document, "patternProperties", path); err != nil {
+		return nil, err
+	}
+	schema.patternRegexps = map[string]*regexp.Regexp{}
+	for pattern := range schema.patternProperties {
+		if schema.patternRegexps[pattern], err = regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("%s: invalid `patternProperties` pattern: %s", path, err)
+		}
+	}
+
+	if value, ok := document["additionalProperties"]; ok {
+		if schema.additionalProperties, err = c.compile(value, path+"/additionalProperties"); err != nil {
+			return nil, err
+		}
+	}
+
+	if value, ok := document["required"]; ok {
+		required, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: `required` must be an array of strings", path)
+		}
+		for _, item := range required {
+			itemString, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: `required` must be an array of strings", path)
+			}
+			schema.required = append(schema.required, itemString)
+		}
+	}
+
+	if schema.allOf, err = c.compileList(document, "allOf", path); err != nil {
+		return nil, err
+	}
+	if schema.anyOf, err = c.compileList(document, "anyOf", path); err != nil {
+		return nil, err
+	}
+	if schema.oneOf, err = c.compileList(document, "oneOf", path); err != nil {
+		return nil, err
+	}
+
+	if value, ok := document["not"]; ok {
+		if schema.not, err = c.compile(value, path+"/not"); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, keyword := range []string{"definitions", "$defs"} {
+		if _, err := c.compileMap(document, keyword, path); err != nil {
+			return nil, err
+		}
+	}
+
+	return schema, nil
+}
+
+func (c *compiler) compileMap(document map[string]interface{}, keyword string, path string) (map[string]*Schema, error) {
+	value, ok := document[keyword]
+	if !ok {
+		return nil, nil
+	}
+
+	nodes, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: `%s` must be an object", path, keyword)
+	}
+
+	schemas := map[string]*Schema{}
+	for name, node := range nodes {
+		schema, err := c.compile(node, fmt.Sprintf("%s/%s/%s", path, keyword, name))
+		if err != nil {
+			return nil, err
+		}
+		schemas[name] = schema
+	}
+
+	return schemas, nil
+}
+
+func (c *compiler) compileList(document map[string]interface{}, keyword string, path string) ([]*Schema, error) {
+	value, ok := document[keyword]
+	if !ok {
+		return nil, nil
+	}
+
+	nodes, ok := value.([]interface{})
+	if !ok || len(nodes) == 0 {
+		return nil, fmt.Errorf("%s: `%s` must be a non-empty array", path, keyword)
+	}
+
+	schemas := []*Schema{}
+	for i, node := range nodes {
+		schema, err := c.compile(node, fmt.Sprintf("%s/%s/%d", path, keyword, i))
+		if err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, schema)
+	}
+
+	return schemas, nil
+}
+
+func number(document map[string]interface{}, keyword string, path string) (*float64, error) {
+	value, ok := document[keyword]
+	if !ok {
+		return nil, nil
+	}
+
+	n, ok := value.(float64)
+	if !ok {
+		return nil, fmt.Errorf("%s: `%s` must be a number", path, keyword)
+	}
+
+	return &n, nil
+}
+
+func count(document map[string]interface{}, keyword string, path string) (*int, error) {
+	value, ok := document[keyword]
+	if !ok {
+		return nil, nil
+	}
+
+	n, ok := value.(float64)
+	if !ok || n < 0 || n != math.Trunc(n) {
+		return nil, fmt.Errorf("%s: `%s` must be a non-negative integer", path, keyword)
+	}
+
+	i := int(n)
+	return &i, nil
+}
+
+func (s *Schema) validate(value interface{}, path string, violations *[]string) {
+	add := func(format string, args ...interface{}) {
+		*violations = append(*violations, fmt.Sprintf("%s: %s", path, fmt.Sprintf(format, args...)))
+	}
+
+	if s.always != nil {
+		if !*s.always {
+			add("is not allowed")
+		}
+		return
+	}
+
+	if s.ref != "" {
+		if ref := s.root.refs[s.ref]; ref != nil {
+			ref.validate(value, path, violations)
+		}
+		return
+	}
+
+	if len(s.types) > 0 && !matchesType(value, s.types) {
+		add("must be of type %s, got %s", strings.Join(s.types, " or "), typeOf(value))
+		return
+	}
+
+	if s.enum != nil {
+		found := false
+		for _, item := range s.enum {
+			if equal(value, item) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			add("must be one of %s", encode(s.enum))
+		}
+	}
+
+	if s.cnst != nil && !equal(value, *s.cnst) {
+		add("must be equal to %s", encode(*s.cnst))
+	}
+
+	switch value := value.(type) {
+	case float64:
+		s.validateNumber(value, add)
+	case string:
+		s.validateString(value, add)
+	case []interface{}:
+		s.validateArray(value, path, violations, add)
+	case map[string]interface{}:
+		s.validateObject(value, path, violations, add)
+	}
+
+	for _, schema := range s.allOf {
+		schema.validate(value, path, violations)
+	}
+
+	if s.anyOf != nil {
+		matched := false
+		for _, schema := range s.anyOf {
+			if len(schema.Validate(value)) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			add("must match at least one schema in `anyOf`")
+		}
+	}
+
+	if s.oneOf != nil {
+		matched := 0
+		for _, schema := range s.oneOf {
+			if len(schema.Validate(value)) == 0 {
+				matched++
+			}
+		}
+		if matched != 1 {
+			add("must match exactly one schema in `oneOf`, matched %d", matched)
+		}
+	}
+
+	if s.not != nil && len(s.not.Validate(value)) == 0 {
+		add("must not match the schema in `not`")
+	}
+}
+
+func (s *Schema) validateNumber(value float64, add func(string, ...interface{})) {
+	if s.minimum != nil && value < *s.minimum {
+		add("must be greater than or equal to %v", *s.minimum)
+	}
+	if s.maximum != nil && value > *s.maximum {
+		add("must be less than or equal to %v", *s.maximum)
+	}
+	if s.exclusiveMinimum != nil && value <= *s.exclusiveMinimum {
+		add("must be greater than %v", *s.exclusiveMinimum)
+	}
+	if s.exclusiveMaximum != nil && value >= *s.exclusiveMaximum {
+		add("must be less than %v", *s.exclusiveMaximum)
+	}
+	if s.multipleOf != nil {
+		quotient := value / *s.multipleOf
+		if math.Abs(quotient-math.Floor(quotient+0.5)) > 1e-9 {
+			add("must be a multiple of %v", *s.multipleOf)
+		}
+	}
+}
+
+func (s *Schema) validateString(value string, add func(string, ...interface{})) {
+	length := utf8.RuneCountInString(value)
+	if s.minLength != nil && length < *s.minLength {
+		add("must be at least %d characters long", *s.minLength)
+	}
+	if s.maxLength != nil && length > *s.maxLength {
+		add("must be at most %d characters long", *s.maxLength)
+	}
+	if s.pattern != nil && !s.pattern.MatchString(value) {
+		add("must match pattern `%s`", s.pattern.String())
+	}
+}
+
+func (s *Schema) validateArray(value []interface{}, path string, violations *[]string, add func(string, ...interface{})) {
+	if s.minItems != nil && len(value) < *s.minItems {
+		add("must have at least %d items", *s.minItems)
+	}
+	if s.maxItems != nil && len(value) > *s.maxItems {
+		add("must have at most %d items", *s.maxItems)
+	}
+
+	if s.uniqueItems {
+		for i := 0; i < len(value); i++ {
+			for j := i + 1; j < len(value); j++ {
+				if equal(value[i], value[j]) {
+					add("must have unique items")
+					i = len(value)
+					break
+				}
+			}
+		}
+	}
+
+	for i, item := range value {
+		itemPath := fmt.Sprintf("%s[%d]", path, i)
+		switch {
+		case s.items != nil:
+			s.items.validate(item, itemPath, violations)
+		case i < len(s.tupleItems):
+			s.tupleItems[i].validate(item, itemPath, violations)
+		case s.tupleItems != nil && s.additionalItems != nil:
+			s.additionalItems.validate(item, itemPath, violations)
+		}
+	}
+}
+
+func (s *Schema) validateObject(value map[string]interface{}, path string, violations *[]string, add func(string, ...interface{})) {
+	if s.minProperties != nil && len(value) < *s.minProperties {
+		add("must have at least %d properties", *s.minProperties)
+	}
+	if s.maxProperties != nil && len(value) > *s.maxProperties {
+		add("must have at most %d properties", *s.maxProperties)
+	}
+
+	for _, name := range s.required {
+		if _, ok := value[name]; !ok {
+			add("property `%s` is required", name)
+		}
+	}
+
+	names := []string{}
+	for name := range value {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		propertyPath := name
+		if path != rootPath {
+			propertyPath = path + "." + name
+		}
+
+		matched := false
+		if schema, ok := s.properties[name]; ok {
+			schema.validate(value[name], propertyPath, violations)
+			matched = true
+		}
+
+		for pattern, schema := range s.patternProperties {
+			if s.patternRegexps[pattern].MatchString(name) {
+				schema.validate(value[name], propertyPath, violations)
+				matched = true
+			}
+		}
+
+		if !matched && s.additionalProperties != nil {
+			if s.additionalProperties.always != nil && !*s.additionalProperties.always {
+				add("property `%s` is not allowed", name)
+				continue
+			}
+			s.additionalProperties.validate(value[name], propertyPath, violations)
+		}
+	}
+}
+
+func matchesType(value interface{}, types []string) bool {
+	for _, t := range types {
+		switch t {
+		case "integer":
+			if n, ok := value.(float64); ok && n == math.Trunc(n) {
+				return true
+			}
+		case "number":
+			if _, ok := value.(float64); ok {
+				return true
+			}
+		default:
+			if typeOf(value) == t {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func typeOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+
+	return fmt.Sprintf("%T", value)
+}
+
+func equal(a interface{}, b interface{}) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+func encode(value interface{}) string {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+
+	return string(content)
+}
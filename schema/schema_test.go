@@ -0,0 +1,143 @@
+package schema_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/frodenas/helm-osb/schema"
+)
+
+var _ = Describe("Schema", func() {
+	var (
+		parametersSchema = `{
+			"$schema": "http://json-schema.org/draft-04/schema#",
+			"type": "object",
+			"properties": {
+				"size": {"type": "integer", "minimum": 1, "maximum": 10},
+				"engine": {"enum": ["innodb", "myisam"]},
+				"name": {"type": "string", "pattern": "^[a-z]+$", "maxLength": 8},
+				"tags": {"type": "array", "items": {"type": "string"}, "uniqueItems": true},
+				"persistence": {"$ref": "#/definitions/persistence"}
+			},
+			"required": ["size"],
+			"additionalProperties": false,
+			"definitions": {
+				"persistence": {
+					"type": "object",
+					"properties": {
+						"enabled": {"type": "boolean"}
+					}
+				}
+			}
+		}`
+	)
+
+	Describe("Compile", func() {
+		It("does not return error if the schema is valid", func() {
+			_, err := Compile([]byte(parametersSchema))
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("returns error if the schema is not valid JSON", func() {
+			_, err := Compile([]byte(`{`))
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Error parsing JSON Schema"))
+		})
+
+		It("returns error if a type is unknown", func() {
+			_, err := Compile([]byte(`{"type": "fake-type"}`))
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("unknown type `fake-type`"))
+		})
+
+		It("returns error if a keyword has an invalid value", func() {
+			_, err := Compile([]byte(`{"properties": {"size": {"minimum": "1"}}}`))
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("#/properties/size: `minimum` must be a number"))
+		})
+
+		It("returns error if a pattern is not valid", func() {
+			_, err := Compile([]byte(`{"pattern": "["}`))
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("invalid `pattern`"))
+		})
+
+		It("returns error if a reference is not found", func() {
+			_, err := Compile([]byte(`{"$ref": "#/definitions/unknown"}`))
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Reference `#/definitions/unknown` not found"))
+		})
+
+		It("returns error if a reference refers back to itself", func() {
+			_, err := Compile([]byte(`{"definitions": {"a": {"$ref": "#/definitions/a"}}, "$ref": "#/definitions/a"}`))
+			Expect(err).To(MatchError("Reference `#/definitions/a` is circular"))
+
+			_, err = Compile([]byte(`{"allOf": [{"$ref": "#"}]}`))
+			Expect(err).To(MatchError("Reference `#` is circular"))
+		})
+
+		It("supports references that refer back to themselves through nested values", func() {
+			compiled, err := Compile([]byte(`{"definitions": {"node": {"type": "object", "properties": {"child": {"$ref": "#/definitions/node"}}}}, "$ref": "#/definitions/node"}`))
+			Expect(err).ToNot(HaveOccurred())
+
+			violations, err := compiled.ValidateJSON([]byte(`{"child": {"child": 1}}`))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(violations).To(HaveLen(1))
+		})
+	})
+
+	Describe("ValidateJSON", func() {
+		var (
+			compiledSchema *Schema
+		)
+
+		BeforeEach(func() {
+			var err error
+			compiledSchema, err = Compile([]byte(parametersSchema))
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("returns no violations if the document is valid", func() {
+			violations, err := compiledSchema.ValidateJSON([]byte(`{"size": 2, "engine": "innodb", "name": "db", "tags": ["a", "b"], "persistence": {"enabled": true}}`))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(violations).To(BeEmpty())
+		})
+
+		It("returns all violations if the document is not valid", func() {
+			violations, err := compiledSchema.ValidateJSON([]byte(`{"size": 1.5, "engine": "fake", "name": "DB", "tags": ["a", "a"], "persistence": {"enabled": "yes"}, "other": 1}`))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(violations).To(ConsistOf(
+				"size: must be of type integer, got number",
+				`engine: must be one of ["innodb","myisam"]`,
+				"name: must match pattern `^[a-z]+$`",
+				"tags: must have unique items",
+				"persistence.enabled: must be of type boolean, got string",
+				"(root): property `other` is not allowed",
+			))
+		})
+
+		It("returns a violation if a required property is missing", func() {
+			violations, err := compiledSchema.ValidateJSON([]byte(`{}`))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(violations).To(ConsistOf("(root): property `size` is required"))
+		})
+
+		It("returns a violation if a number is out of range", func() {
+			violations, err := compiledSchema.ValidateJSON([]byte(`{"size": 11}`))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(violations).To(ConsistOf("size: must be less than or equal to 10"))
+		})
+
+		It("supports draft-04 exclusive limits", func() {
+			exclusiveSchema, err := Compile([]byte(`{"minimum": 1, "exclusiveMinimum": true}`))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(exclusiveSchema.Validate(float64(1))).To(ConsistOf("(root): must be greater than 1"))
+			Expect(exclusiveSchema.Validate(float64(2))).To(BeEmpty())
+		})
+
+		It("returns error if the document is not valid JSON", func() {
+			_, err := compiledSchema.ValidateJSON([]byte(`{`))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
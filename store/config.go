@@ -0,0 +1,53 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	FileBackend       = "file"
+	KubernetesBackend = "kubernetes"
+
+	// DefaultPath is where the file backend keeps the state when no path is
+	// configured.
+	DefaultPath = "/var/lib/helm-osb"
+)
+
+// Config configures the state store. Without a backend, state is kept in
+// files under DefaultPath.
+type Config struct {
+	Backend   string `json:"backend,omitempty"`
+	Path      string `json:"path,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+func (c Config) Validate() error {
+	switch c.StoreBackend() {
+	case FileBackend:
+	case KubernetesBackend:
+		if c.Namespace == "" {
+			return errors.New("Must provide a non-empty Namespace")
+		}
+	default:
+		return fmt.Errorf("Backend `%s` is not supported", c.Backend)
+	}
+
+	return nil
+}
+
+func (c Config) StoreBackend() string {
+	if c.Backend == "" {
+		return FileBackend
+	}
+
+	return c.Backend
+}
+
+func (c Config) StorePath() string {
+	if c.Path == "" {
+		return DefaultPath
+	}
+
+	return c.Path
+}
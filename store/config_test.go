@@ -0,0 +1,55 @@
+package store_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/frodenas/helm-osb/store"
+)
+
+var _ = Describe("Config", func() {
+	var (
+		config Config
+	)
+
+	Describe("Validate", func() {
+		It("does not return error if the file backend is valid", func() {
+			config = Config{Backend: "file", Path: "/var/lib/helm-osb"}
+
+			err := config.Validate()
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("does not return error if the kubernetes backend is valid", func() {
+			config = Config{Backend: "kubernetes", Namespace: "helm-osb"}
+
+			err := config.Validate()
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("returns error if Backend is not supported", func() {
+			config = Config{Backend: "fake-backend"}
+
+			err := config.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Backend `fake-backend` is not supported"))
+		})
+
+		It("defaults to the file backend", func() {
+			config = Config{}
+
+			err := config.Validate()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(config.StoreBackend()).To(Equal(FileBackend))
+			Expect(config.StorePath()).To(Equal(DefaultPath))
+		})
+
+		It("returns error if Namespace is not valid for the kubernetes backend", func() {
+			config = Config{Backend: "kubernetes"}
+
+			err := config.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Must provide a non-empty Namespace"))
+		})
+	})
+})
@@ -0,0 +1,280 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	instancesDir  = "instances"
+	bindingsDir   = "bindings"
+	operationsDir = "operations"
+	recordExt     = ".json"
+)
+
+// FileStore keeps every record as a JSON document under a local directory.
+type FileStore struct {
+	path  string
+	mutex sync.RWMutex
+}
+
+func NewFileStore(path string) (*FileStore, error) {
+	for _, dir := range []string{instancesDir, bindingsDir, operationsDir} {
+		if err := os.MkdirAll(filepath.Join(path, dir), 0700); err != nil {
+			return nil, fmt.Errorf("Error creating store directory: %s", err)
+		}
+	}
+
+	return &FileStore{
+		path: path,
+	}, nil
+}
+
+func (s *FileStore) GetInstance(instanceID string) (Instance, bool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	instance := Instance{}
+
+	file, err := s.recordFile(instancesDir, instanceID)
+	if err != nil {
+		return instance, false, err
+	}
+
+	found, err := s.read(file, &instance)
+	return instance, found, err
+}
+
+func (s *FileStore) ListInstances() ([]Instance, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	instances := []Instance{}
+
+	files, err := s.list(filepath.Join(s.path, instancesDir))
+	if err != nil {
+		return instances, err
+	}
+
+	for _, file := range files {
+		instance := Instance{}
+		if _, err := s.read(file, &instance); err != nil {
+			return instances, err
+		}
+		instances = append(instances, instance)
+	}
+
+	return instances, nil
+}
+
+func (s *FileStore) SaveInstance(instance Instance) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	file, err := s.recordFile(instancesDir, instance.ID)
+	if err != nil {
+		return err
+	}
+
+	return s.write(file, instance)
+}
+
+func (s *FileStore) DeleteInstance(instanceID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	file, err := s.recordFile(instancesDir, instanceID)
+	if err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(filepath.Join(s.path, bindingsDir, instanceID)); err != nil {
+		return fmt.Errorf("Error deleting bindings for instance `%s`: %s", instanceID, err)
+	}
+
+	return s.remove(file)
+}
+
+func (s *FileStore) GetBinding(instanceID string, bindingID string) (Binding, bool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	binding := Binding{}
+
+	file, err := s.recordFile(bindingsDir, instanceID, bindingID)
+	if err != nil {
+		return binding, false, err
+	}
+
+	found, err := s.read(file, &binding)
+	return binding, found, err
+}
+
+func (s *FileStore) SaveBinding(binding Binding) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	file, err := s.recordFile(bindingsDir, binding.InstanceID, binding.ID)
+	if err != nil {
+		return err
+	}
+
+	return s.write(file, binding)
+}
+
+func (s *FileStore) DeleteBinding(instanceID string, bindingID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	file, err := s.recordFile(bindingsDir, instanceID, bindingID)
+	if err != nil {
+		return err
+	}
+
+	return s.remove(file)
+}
+
+func (s *FileStore) GetOperation(instanceID string, operationID string) (Operation, bool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	operation := Operation{}
+
+	file, err := s.recordFile(operationsDir, instanceID, operationID)
+	if err != nil {
+		return operation, false, err
+	}
+
+	found, err := s.read(file, &operation)
+	return operation, found, err
+}
+
+func (s *FileStore) ListOperations(instanceID string) ([]Operation, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	operations := []Operation{}
+
+	if err := validateID(instanceID); err != nil {
+		return operations, err
+	}
+
+	files, err := s.list(filepath.Join(s.path, operationsDir, instanceID))
+	if err != nil {
+		return operations, err
+	}
+
+	for _, file := range files {
+		operation := Operation{}
+		if _, err := s.read(file, &operation); err != nil {
+			return operations, err
+		}
+		operations = append(operations, operation)
+	}
+
+	return operations, nil
+}
+
+func (s *FileStore) SaveOperation(operation Operation) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	file, err := s.recordFile(operationsDir, operation.InstanceID, operation.ID)
+	if err != nil {
+		return err
+	}
+
+	return s.write(file, operation)
+}
+
+func (s *FileStore) recordFile(dir string, ids ...string) (string, error) {
+	elements := []string{s.path, dir}
+	for _, id := range ids {
+		if err := validateID(id); err != nil {
+			return "", err
+		}
+		elements = append(elements, id)
+	}
+
+	return filepath.Join(elements...) + recordExt, nil
+}
+
+func (s *FileStore) read(file string, record interface{}) (bool, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("Error reading record `%s`: %s", file, err)
+	}
+
+	if err := json.Unmarshal(content, record); err != nil {
+		return false, fmt.Errorf("Error parsing record `%s`: %s", file, err)
+	}
+
+	return true, nil
+}
+
+func (s *FileStore) write(file string, record interface{}) error {
+	content, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("Error marshalling record `%s`: %s", file, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return fmt.Errorf("Error creating record directory `%s`: %s", filepath.Dir(file), err)
+	}
+
+	tmpFile := file + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, content, 0600); err != nil {
+		return fmt.Errorf("Error writing record `%s`: %s", file, err)
+	}
+
+	if err := os.Rename(tmpFile, file); err != nil {
+		return fmt.Errorf("Error writing record `%s`: %s", file, err)
+	}
+
+	return nil
+}
+
+func (s *FileStore) remove(file string) error {
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Error deleting record `%s`: %s", file, err)
+	}
+
+	return nil
+}
+
+func (s *FileStore) list(dir string) ([]string, error) {
+	files := []string{}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return files, nil
+		}
+		return files, fmt.Errorf("Error listing records in `%s`: %s", dir, err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != recordExt {
+			continue
+		}
+		files = append(files, filepath.Join(dir, entry.Name()))
+	}
+
+	return files, nil
+}
+
+func validateID(id string) error {
+	if id == "" || id == "." || id == ".." || strings.ContainsAny(id, `/\`) {
+		return fmt.Errorf("Invalid ID `%s`", id)
+	}
+
+	return nil
+}
@@ -0,0 +1,215 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/frodenas/helm-osb/kubernetes"
+)
+
+const (
+	recordDataKey = "record"
+
+	managedByLabel  = "app.kubernetes.io/managed-by"
+	managedByValue  = "helm-osb"
+	recordTypeLabel = "helm-osb/record-type"
+	instanceIDLabel = "helm-osb/instance-id"
+
+	instanceRecordType  = "instance"
+	bindingRecordType   = "binding"
+	operationRecordType = "operation"
+)
+
+type SecretsClient interface {
+	GetSecret(namespace string, name string) (kubernetes.Secret, bool, error)
+	ListSecrets(namespace string, labelSelector string) ([]kubernetes.Secret, error)
+	SaveSecret(secret kubernetes.Secret) error
+	DeleteSecret(namespace string, name string) error
+}
+
+// KubernetesStore keeps every record as a JSON document inside a Kubernetes
+// Secret, labelled so records can be listed by type and instance.
+type KubernetesStore struct {
+	namespace     string
+	secretsClient SecretsClient
+}
+
+func NewKubernetesStore(namespace string, secretsClient SecretsClient) *KubernetesStore {
+	return &KubernetesStore{
+		namespace:     namespace,
+		secretsClient: secretsClient,
+	}
+}
+
+func (s *KubernetesStore) GetInstance(instanceID string) (Instance, bool, error) {
+	instance := Instance{}
+	found, err := s.read(secretName(instanceRecordType, instanceID), &instance)
+	return instance, found, err
+}
+
+func (s *KubernetesStore) ListInstances() ([]Instance, error) {
+	instances := []Instance{}
+
+	secrets, err := s.secretsClient.ListSecrets(s.namespace, labelSelector(instanceRecordType, ""))
+	if err != nil {
+		return instances, err
+	}
+
+	for _, secret := range secrets {
+		instance := Instance{}
+		if err := decodeRecord(secret, &instance); err != nil {
+			return instances, err
+		}
+		instances = append(instances, instance)
+	}
+
+	return instances, nil
+}
+
+func (s *KubernetesStore) SaveInstance(instance Instance) error {
+	return s.write(instanceRecordType, instance.ID, instance.ID, instance)
+}
+
+func (s *KubernetesStore) DeleteInstance(instanceID string) error {
+	secrets, err := s.secretsClient.ListSecrets(s.namespace, labelSelector(bindingRecordType, instanceID))
+	if err != nil {
+		return err
+	}
+
+	for _, secret := range secrets {
+		if err := s.secretsClient.DeleteSecret(s.namespace, secret.Metadata.Name); err != nil {
+			return err
+		}
+	}
+
+	return s.secretsClient.DeleteSecret(s.namespace, secretName(instanceRecordType, instanceID))
+}
+
+func (s *KubernetesStore) GetBinding(instanceID string, bindingID string) (Binding, bool, error) {
+	binding := Binding{}
+
+	found, err := s.read(secretName(bindingRecordType, bindingID), &binding)
+	if err != nil || !found {
+		return binding, false, err
+	}
+
+	if binding.InstanceID != instanceID {
+		return Binding{}, false, nil
+	}
+
+	return binding, true, nil
+}
+
+func (s *KubernetesStore) SaveBinding(binding Binding) error {
+	return s.write(bindingRecordType, binding.ID, binding.InstanceID, binding)
+}
+
+func (s *KubernetesStore) DeleteBinding(instanceID string, bindingID string) error {
+	if _, found, err := s.GetBinding(instanceID, bindingID); err != nil || !found {
+		return err
+	}
+
+	return s.secretsClient.DeleteSecret(s.namespace, secretName(bindingRecordType, bindingID))
+}
+
+func (s *KubernetesStore) GetOperation(instanceID string, operationID string) (Operation, bool, error) {
+	operation := Operation{}
+
+	found, err := s.read(secretName(operationRecordType, operationID), &operation)
+	if err != nil || !found {
+		return operation, false, err
+	}
+
+	if operation.InstanceID != instanceID {
+		return Operation{}, false, nil
+	}
+
+	return operation, true, nil
+}
+
+func (s *KubernetesStore) ListOperations(instanceID string) ([]Operation, error) {
+	operations := []Operation{}
+
+	secrets, err := s.secretsClient.ListSecrets(s.namespace, labelSelector(operationRecordType, instanceID))
+	if err != nil {
+		return operations, err
+	}
+
+	for _, secret := range secrets {
+		operation := Operation{}
+		if err := decodeRecord(secret, &operation); err != nil {
+			return operations, err
+		}
+		operations = append(operations, operation)
+	}
+
+	return operations, nil
+}
+
+func (s *KubernetesStore) SaveOperation(operation Operation) error {
+	return s.write(operationRecordType, operation.ID, operation.InstanceID, operation)
+}
+
+func (s *KubernetesStore) read(name string, record interface{}) (bool, error) {
+	secret, found, err := s.secretsClient.GetSecret(s.namespace, name)
+	if err != nil || !found {
+		return false, err
+	}
+
+	if err := decodeRecord(secret, record); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (s *KubernetesStore) write(recordType string, id string, instanceID string, record interface{}) error {
+	content, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("Error marshalling %s `%s`: %s", recordType, id, err)
+	}
+
+	secret := kubernetes.Secret{
+		Metadata: kubernetes.ObjectMeta{
+			Name:      secretName(recordType, id),
+			Namespace: s.namespace,
+			Labels: map[string]string{
+				managedByLabel:  managedByValue,
+				recordTypeLabel: recordType,
+				instanceIDLabel: instanceID,
+			},
+		},
+		Data: map[string][]byte{
+			recordDataKey: content,
+		},
+	}
+
+	return s.secretsClient.SaveSecret(secret)
+}
+
+func decodeRecord(secret kubernetes.Secret, record interface{}) error {
+	content, ok := secret.Data[recordDataKey]
+	if !ok {
+		return fmt.Errorf("Secret `%s` does not contain a record", secret.Metadata.Name)
+	}
+
+	if err := json.Unmarshal(content, record); err != nil {
+		return fmt.Errorf("Error parsing record in Secret `%s`: %s", secret.Metadata.Name, err)
+	}
+
+	return nil
+}
+
+func secretName(recordType string, id string) string {
+	return fmt.Sprintf("%s-%s-%s", managedByValue, recordType, strings.ToLower(id))
+}
+
+func labelSelector(recordType string, instanceID string) string {
+	selector := fmt.Sprintf("%s=%s,%s=%s", managedByLabel, managedByValue, recordTypeLabel, recordType)
+	if instanceID != "" {
+		selector = selector + fmt.Sprintf(",%s=%s", instanceIDLabel, instanceID)
+	}
+
+	return selector
+}
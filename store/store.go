@@ -0,0 +1,163 @@
+package store
+
+import (
+	"crypto/rand"
+	"fmt"
+	"time"
+)
+
+type OperationType string
+
+const (
+	ProvisionOperation   OperationType = "provision"
+	UpdateOperation      OperationType = "update"
+	DeprovisionOperation OperationType = "deprovision"
+
+	// RollbackOperation is recorded by the broker when it restores a release
+	// after a failed update. Platforms never request it.
+	RollbackOperation OperationType = "rollback"
+
+	// UpgradeOperation is recorded by the broker when it moves an instance
+	// onto a new chart version during a fleet upgrade. Platforms never
+	// request it.
+	UpgradeOperation OperationType = "upgrade"
+)
+
+// RequestedByPlatform reports whether operations of this type are requested
+// by the platform, as opposed to started by the broker itself.
+func (t OperationType) RequestedByPlatform() bool {
+	return t != RollbackOperation && t != UpgradeOperation
+}
+
+type OperationState string
+
+const (
+	OperationInProgress OperationState = "in progress"
+	OperationSucceeded  OperationState = "succeeded"
+	OperationFailed     OperationState = "failed"
+)
+
+type Store interface {
+	GetInstance(instanceID string) (Instance, bool, error)
+	ListInstances() ([]Instance, error)
+	SaveInstance(instance Instance) error
+	DeleteInstance(instanceID string) error
+
+	GetBinding(instanceID string, bindingID string) (Binding, bool, error)
+	SaveBinding(binding Binding) error
+	DeleteBinding(instanceID string, bindingID string) error
+
+	GetOperation(instanceID string, operationID string) (Operation, bool, error)
+	ListOperations(instanceID string) ([]Operation, error)
+	SaveOperation(operation Operation) error
+}
+
+type Instance struct {
+	ID                     string                 `json:"id"`
+	ServiceID              string                 `json:"service_id"`
+	PlanID                 string                 `json:"plan_id"`
+	OrganizationGUID       string                 `json:"organization_guid"`
+	SpaceGUID              string                 `json:"space_guid"`
+	Namespace              string                 `json:"namespace,omitempty"`
+	ReleaseName            string                 `json:"release_name,omitempty"`
+	ChartVersion           string                 `json:"chart_version,omitempty"`
+	ChartConstraint        string                 `json:"chart_constraint,omitempty"`
+	MaintenanceInfoVersion string                 `json:"maintenance_info_version,omitempty"`
+	Context                *PlatformContext       `json:"context,omitempty"`
+	GeneratedValues        map[string]string      `json:"generated_values,omitempty"`
+	Parameters             map[string]interface{} `json:"parameters,omitempty"`
+	CreatedAt              time.Time              `json:"created_at"`
+	UpdatedAt              time.Time              `json:"updated_at"`
+}
+
+// PlatformContext is the OSB context object sent by the platform on
+// provision and update requests.
+type PlatformContext struct {
+	Platform         string `json:"platform,omitempty"`
+	Namespace        string `json:"namespace,omitempty"`
+	ClusterID        string `json:"clusterid,omitempty"`
+	OrganizationGUID string `json:"organization_guid,omitempty"`
+	OrganizationName string `json:"organization_name,omitempty"`
+	SpaceGUID        string `json:"space_guid,omitempty"`
+	SpaceName        string `json:"space_name,omitempty"`
+	InstanceName     string `json:"instance_name,omitempty"`
+}
+
+type Binding struct {
+	ID         string                 `json:"id"`
+	InstanceID string                 `json:"instance_id"`
+	ServiceID  string                 `json:"service_id"`
+	PlanID     string                 `json:"plan_id"`
+	AppGUID    string                 `json:"app_guid,omitempty"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+	CreatedAt  time.Time              `json:"created_at"`
+}
+
+type Operation struct {
+	ID          string         `json:"id"`
+	InstanceID  string         `json:"instance_id"`
+	Type        OperationType  `json:"type"`
+	State       OperationState `json:"state"`
+	Description string         `json:"description,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+}
+
+func NewOperation(instanceID string, operationType OperationType) (Operation, error) {
+	id, err := newID()
+	if err != nil {
+		return Operation{}, err
+	}
+
+	now := time.Now().UTC()
+
+	return Operation{
+		ID:         id,
+		InstanceID: instanceID,
+		Type:       operationType,
+		State:      OperationInProgress,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}, nil
+}
+
+// LastOperation returns the most recently created operation requested by the
+// platform for an instance.
+func LastOperation(store Store, instanceID string) (operation Operation, found bool, err error) {
+	operations, err := store.ListOperations(instanceID)
+	if err != nil {
+		return operation, false, err
+	}
+
+	for _, op := range operations {
+		if !op.Type.RequestedByPlatform() {
+			continue
+		}
+		if !found || op.CreatedAt.After(operation.CreatedAt) {
+			operation = op
+			found = true
+		}
+	}
+
+	return operation, found, nil
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("Error generating ID: %s", err)
+	}
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+func New(config Config, secretsClient SecretsClient) (Store, error) {
+	switch config.StoreBackend() {
+	case FileBackend:
+		return NewFileStore(config.StorePath())
+	case KubernetesBackend:
+		return NewKubernetesStore(config.Namespace, secretsClient), nil
+	}
+
+	return nil, fmt.Errorf("Backend `%s` is not supported", config.Backend)
+}
@@ -0,0 +1,266 @@
+package store_test
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/frodenas/helm-osb/store"
+
+	"github.com/frodenas/helm-osb/kubernetes"
+)
+
+type fakeSecretsClient struct {
+	secrets map[string]kubernetes.Secret
+}
+
+func newFakeSecretsClient() *fakeSecretsClient {
+	return &fakeSecretsClient{secrets: map[string]kubernetes.Secret{}}
+}
+
+func (f *fakeSecretsClient) GetSecret(namespace string, name string) (kubernetes.Secret, bool, error) {
+	secret, ok := f.secrets[namespace+"/"+name]
+	return secret, ok, nil
+}
+
+func (f *fakeSecretsClient) ListSecrets(namespace string, labelSelector string) ([]kubernetes.Secret, error) {
+	secrets := []kubernetes.Secret{}
+
+	for _, secret := range f.secrets {
+		if secret.Metadata.Namespace != namespace {
+			continue
+		}
+
+		matches := true
+		for _, requirement := range strings.Split(labelSelector, ",") {
+			label := strings.SplitN(requirement, "=", 2)
+			if secret.Metadata.Labels[label[0]] != label[1] {
+				matches = false
+			}
+		}
+
+		if matches {
+			secrets = append(secrets, secret)
+		}
+	}
+
+	return secrets, nil
+}
+
+func (f *fakeSecretsClient) SaveSecret(secret kubernetes.Secret) error {
+	f.secrets[secret.Metadata.Namespace+"/"+secret.Metadata.Name] = secret
+	return nil
+}
+
+func (f *fakeSecretsClient) DeleteSecret(namespace string, name string) error {
+	delete(f.secrets, namespace+"/"+name)
+	return nil
+}
+
+func itBehavesLikeAStore(newStore func() Store) {
+	var (
+		s Store
+
+		instance  Instance
+		binding   Binding
+		operation Operation
+	)
+
+	BeforeEach(func() {
+		s = newStore()
+
+		now := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		instance = Instance{
+			ID:               "fake-instance-id",
+			ServiceID:        "fake-service-id",
+			PlanID:           "fake-plan-id",
+			OrganizationGUID: "fake-org-guid",
+			SpaceGUID:        "fake-space-guid",
+			Parameters:       map[string]interface{}{"foo": "bar"},
+			CreatedAt:        now,
+			UpdatedAt:        now,
+		}
+
+		binding = Binding{
+			ID:         "fake-binding-id",
+			InstanceID: "fake-instance-id",
+			ServiceID:  "fake-service-id",
+			PlanID:     "fake-plan-id",
+			AppGUID:    "fake-app-guid",
+			CreatedAt:  now,
+		}
+
+		operation = Operation{
+			ID:         "fake-operation-id",
+			InstanceID: "fake-instance-id",
+			Type:       ProvisionOperation,
+			State:      OperationInProgress,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		}
+	})
+
+	Describe("Instances", func() {
+		It("saves and returns an instance", func() {
+			Expect(s.SaveInstance(instance)).To(Succeed())
+
+			storedInstance, found, err := s.GetInstance("fake-instance-id")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(BeTrue())
+			Expect(storedInstance).To(Equal(instance))
+		})
+
+		It("returns false if an instance is not found", func() {
+			_, found, err := s.GetInstance("unknown-instance-id")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(BeFalse())
+		})
+
+		It("lists all instances", func() {
+			Expect(s.SaveInstance(instance)).To(Succeed())
+
+			instances, err := s.ListInstances()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(instances).To(ConsistOf(instance))
+		})
+
+		It("deletes an instance and its bindings", func() {
+			Expect(s.SaveInstance(instance)).To(Succeed())
+			Expect(s.SaveBinding(binding)).To(Succeed())
+
+			Expect(s.DeleteInstance("fake-instance-id")).To(Succeed())
+
+			_, found, err := s.GetInstance("fake-instance-id")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(BeFalse())
+
+			_, found, err = s.GetBinding("fake-instance-id", "fake-binding-id")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(BeFalse())
+		})
+	})
+
+	Describe("Bindings", func() {
+		It("saves and returns a binding", func() {
+			Expect(s.SaveBinding(binding)).To(Succeed())
+
+			storedBinding, found, err := s.GetBinding("fake-instance-id", "fake-binding-id")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(BeTrue())
+			Expect(storedBinding).To(Equal(binding))
+		})
+
+		It("returns false if a binding belongs to another instance", func() {
+			Expect(s.SaveBinding(binding)).To(Succeed())
+
+			_, found, err := s.GetBinding("other-instance-id", "fake-binding-id")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(BeFalse())
+		})
+
+		It("deletes a binding", func() {
+			Expect(s.SaveBinding(binding)).To(Succeed())
+
+			Expect(s.DeleteBinding("fake-instance-id", "fake-binding-id")).To(Succeed())
+
+			_, found, err := s.GetBinding("fake-instance-id", "fake-binding-id")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(BeFalse())
+		})
+	})
+
+	Describe("Operations", func() {
+		It("saves and returns an operation", func() {
+			Expect(s.SaveOperation(operation)).To(Succeed())
+
+			storedOperation, found, err := s.GetOperation("fake-instance-id", "fake-operation-id")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(BeTrue())
+			Expect(storedOperation).To(Equal(operation))
+		})
+
+		It("returns the last operation of an instance", func() {
+			Expect(s.SaveOperation(operation)).To(Succeed())
+
+			lastOperation := operation
+			lastOperation.ID = "fake-last-operation-id"
+			lastOperation.Type = UpdateOperation
+			lastOperation.CreatedAt = operation.CreatedAt.Add(time.Minute)
+			Expect(s.SaveOperation(lastOperation)).To(Succeed())
+
+			storedOperation, found, err := LastOperation(s, "fake-instance-id")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(BeTrue())
+			Expect(storedOperation).To(Equal(lastOperation))
+		})
+
+		It("does not return operations started by the broker as the last operation", func() {
+			Expect(s.SaveOperation(operation)).To(Succeed())
+
+			rollbackOperation := operation
+			rollbackOperation.ID = "fake-rollback-operation-id"
+			rollbackOperation.Type = RollbackOperation
+			rollbackOperation.CreatedAt = operation.CreatedAt.Add(time.Minute)
+			Expect(s.SaveOperation(rollbackOperation)).To(Succeed())
+
+			upgradeOperation := operation
+			upgradeOperation.ID = "fake-upgrade-operation-id"
+			upgradeOperation.Type = UpgradeOperation
+			upgradeOperation.CreatedAt = operation.CreatedAt.Add(2 * time.Minute)
+			Expect(s.SaveOperation(upgradeOperation)).To(Succeed())
+
+			storedOperation, found, err := LastOperation(s, "fake-instance-id")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(BeTrue())
+			Expect(storedOperation).To(Equal(operation))
+		})
+
+		It("returns false if an instance has no operations", func() {
+			_, found, err := LastOperation(s, "fake-instance-id")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(BeFalse())
+		})
+	})
+}
+
+var _ = Describe("FileStore", func() {
+	var (
+		path string
+	)
+
+	BeforeEach(func() {
+		var err error
+		path, err = ioutil.TempDir("", "helm-osb-store")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(path)
+	})
+
+	itBehavesLikeAStore(func() Store {
+		fileStore, err := NewFileStore(path)
+		Expect(err).ToNot(HaveOccurred())
+		return fileStore
+	})
+
+	It("returns error if an ID is not valid", func() {
+		fileStore, err := NewFileStore(path)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, _, err = fileStore.GetInstance("../fake-instance-id")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("Invalid ID"))
+	})
+})
+
+var _ = Describe("KubernetesStore", func() {
+	itBehavesLikeAStore(func() Store {
+		return NewKubernetesStore("fake-namespace", newFakeSecretsClient())
+	})
+})
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/frodenas/helm-osb/broker"
+)
+
+const upgradeFleetCommand = "upgrade-fleet"
+
+// upgradeFleet runs the `upgrade-fleet` subcommand, which upgrades the
+// instances of a plan onto the chart version the plan currently asks for. The
+// report is written to the report file after every instance, or to stdout
+// once the upgrade is over. It returns the exit code, which is non-zero when
+// an instance failed to upgrade or the upgrade paused.
+func upgradeFleet(args []string) int {
+	flags := flag.NewFlagSet(upgradeFleetCommand, flag.ExitOnError)
+	configFilePath := flags.String("config-file", "", "Location of the configuration file")
+	reportFilePath := flags.String("report-file", "", "Location of the report file (defaults to stdout)")
+	options := broker.FleetUpgradeOptions{}
+	flags.StringVar(&options.ServiceID, "service-id", "", "ID of the Service whose instances to upgrade")
+	flags.StringVar(&options.PlanID, "plan-id", "", "ID of the Plan whose instances to upgrade")
+	flags.IntVar(&options.BatchSize, "batch-size", 1, "Number of instances to upgrade at a time")
+	flags.IntVar(&options.Canaries, "canaries", 0, "Number of instances to upgrade first, stopping if any of them fails")
+	flags.BoolVar(&options.PauseOnFailure, "pause-on-failure", false, "Stop after a batch with failed upgrades")
+	flags.BoolVar(&options.DryRun, "dry-run", false, "List the instances to upgrade without upgrading them")
+	flags.Parse(args)
+
+	config, err := LoadConfig(*configFilePath)
+	if err != nil {
+		log.Fatalf("Error loading configuration file: %s", err)
+	}
+
+	logger := buildLogger(config.LogLevel, os.Stderr)
+
+	serviceBroker := buildBroker(config, logger)
+
+	fleetUpgrade, err := serviceBroker.PlanFleetUpgrade(context.Background(), options)
+	if err != nil {
+		log.Fatalf("Error planning fleet upgrade: %s", err)
+	}
+
+	writeReport := func(report broker.FleetUpgradeReport) {
+		if *reportFilePath == "" {
+			return
+		}
+		if err := writeFleetUpgradeReport(*reportFilePath, report); err != nil {
+			log.Printf("Error writing fleet upgrade report: %s", err)
+		}
+	}
+
+	report := fleetUpgrade.Report()
+	if !options.DryRun {
+		report = serviceBroker.RunFleetUpgrade(fleetUpgrade, writeReport)
+	}
+	serviceBroker.Stop()
+	writeReport(report)
+
+	if *reportFilePath == "" {
+		content, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			log.Fatalf("Error encoding fleet upgrade report: %s", err)
+		}
+		fmt.Println(string(content))
+	}
+
+	if report.State == broker.FleetUpgradePaused || report.Summary[broker.FleetInstanceFailed] > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+// writeFleetUpgradeReport replaces the report file, so readers never see a
+// partially written report.
+func writeFleetUpgradeReport(path string, report broker.FleetUpgradeReport) error {
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, content, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
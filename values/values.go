@@ -0,0 +1,310 @@
+// Package values manipulates Helm chart values trees.
+package values
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Parse decodes raw JSON parameters into a values tree, expanding dotted
+// keys into nested maps.
+func Parse(rawParameters []byte) (map[string]interface{}, error) {
+	parameters := map[string]interface{}{}
+	if len(rawParameters) == 0 {
+		return parameters, nil
+	}
+
+	if err := json.Unmarshal(rawParameters, &parameters); err != nil {
+		return parameters, err
+	}
+
+	return Expand(parameters)
+}
+
+// Expand turns dotted keys such as `resources.limits.memory` into nested
+// maps. A literal dot can be escaped as `\.`. It returns error if two keys
+// set the same value, or a value and a value below it.
+func Expand(values map[string]interface{}) (map[string]interface{}, error) {
+	expanded := map[string]interface{}{}
+
+	for key, value := range values {
+		if nested, ok := value.(map[string]interface{}); ok {
+			var err error
+			if value, err = Expand(nested); err != nil {
+				return nil, err
+			}
+		}
+
+		elements := SplitPath(key)
+		for i := len(elements) - 1; i > 0; i-- {
+			value = map[string]interface{}{elements[i]: value}
+		}
+
+		if err := expandValue(expanded, elements[0], value, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	return expanded, nil
+}
+
+func expandValue(node map[string]interface{}, key string, value interface{}, parentPath string) error {
+	valuePath := strings.Replace(key, ".", `\.`, -1)
+	if parentPath != "" {
+		valuePath = parentPath + "." + valuePath
+	}
+
+	existing, found := node[key]
+	if !found {
+		node[key] = value
+		return nil
+	}
+
+	existingMap, existingIsMap := existing.(map[string]interface{})
+	valueMap, valueIsMap := value.(map[string]interface{})
+	if !existingIsMap || !valueIsMap {
+		return fmt.Errorf("Parameter `%s` is set more than once", valuePath)
+	}
+
+	for nestedKey, nestedValue := range valueMap {
+		if err := expandValue(existingMap, nestedKey, nestedValue, valuePath); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Merge deep merges src into a copy of dst. Nested maps are merged
+// recursively, any other value in src replaces the value in dst.
+func Merge(dst map[string]interface{}, src map[string]interface{}) map[string]interface{} {
+	merged := Copy(dst)
+
+	for key, value := range src {
+		merged[key] = mergeValue(merged[key], value)
+	}
+
+	return merged
+}
+
+func mergeValue(dst interface{}, src interface{}) interface{} {
+	dstMap, dstIsMap := dst.(map[string]interface{})
+	srcMap, srcIsMap := src.(map[string]interface{})
+	if dstIsMap && srcIsMap {
+		return Merge(dstMap, srcMap)
+	}
+
+	if srcIsMap {
+		return Copy(srcMap)
+	}
+
+	return src
+}
+
+func Copy(values map[string]interface{}) map[string]interface{} {
+	copied := map[string]interface{}{}
+
+	for key, value := range values {
+		if nested, ok := value.(map[string]interface{}); ok {
+			value = Copy(nested)
+		}
+		copied[key] = value
+	}
+
+	return copied
+}
+
+// Diff returns the values that are not set, or are set differently, in
+// base.
+func Diff(values map[string]interface{}, base map[string]interface{}) map[string]interface{} {
+	diff := map[string]interface{}{}
+
+	for key, value := range values {
+		baseValue, ok := base[key]
+		if !ok {
+			diff[key] = value
+			continue
+		}
+
+		valueMap, valueIsMap := value.(map[string]interface{})
+		baseMap, baseIsMap := baseValue.(map[string]interface{})
+		if valueIsMap && baseIsMap {
+			if nested := Diff(valueMap, baseMap); len(nested) > 0 {
+				diff[key] = nested
+			}
+			continue
+		}
+
+		if !Equivalent(value, baseValue) {
+			diff[key] = value
+		}
+	}
+
+	return diff
+}
+
+// Equivalent reports whether two values have the same JSON representation.
+func Equivalent(a interface{}, b interface{}) bool {
+	aContent, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+
+	bContent, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+
+	return bytes.Equal(aContent, bContent)
+}
+
+// SplitPath splits a dotted path into its elements, honouring escaped dots.
+func SplitPath(key string) []string {
+	elements := []string{}
+
+	element := ""
+	for i := 0; i < len(key); i++ {
+		switch {
+		case key[i] == '\\' && i+1 < len(key) && key[i+1] == '.':
+			element += "."
+			i++
+		case key[i] == '.':
+			elements = append(elements, element)
+			element = ""
+		default:
+			element += string(key[i])
+		}
+	}
+	elements = append(elements, element)
+
+	// Leading, trailing or repeated dots do not denote a path.
+	for _, element := range elements {
+		if element == "" {
+			return []string{strings.Replace(key, `\.`, ".", -1)}
+		}
+	}
+
+	return elements
+}
+
+// Paths returns the dotted paths of every leaf in a values tree, sorted.
+func Paths(values map[string]interface{}) []string {
+	paths := []string{}
+
+	for key, value := range values {
+		element := strings.Replace(key, ".", `\.`, -1)
+
+		nested, ok := value.(map[string]interface{})
+		if !ok || len(nested) == 0 {
+			paths = append(paths, element)
+			continue
+		}
+
+		for _, nestedPath := range Paths(nested) {
+			paths = append(paths, element+"."+nestedPath)
+		}
+	}
+
+	sort.Strings(paths)
+	return paths
+}
+
+// MatchPath reports whether a dotted path, or any of its parents, matches a
+// pattern. Each pattern element is a glob matching one path element, and
+// `**` matches any number of path elements.
+func MatchPath(pattern string, valuePath string) bool {
+	patternElements := SplitPath(pattern)
+	pathElements := SplitPath(valuePath)
+
+	for i := len(pathElements); i > 0; i-- {
+		if matchElements(patternElements, pathElements[:i]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CoversPath reports whether setting the value at a dotted path can change a
+// value matching a pattern. That is the case when the path, or any of its
+// parents, matches the pattern, and also when the path is a parent of a
+// matching path, as a value that is not a map replaces everything below it.
+func CoversPath(pattern string, valuePath string) bool {
+	if MatchPath(pattern, valuePath) {
+		return true
+	}
+
+	return matchParentElements(SplitPath(pattern), SplitPath(valuePath))
+}
+
+// ValidatePattern returns an error if a path pattern is malformed.
+func ValidatePattern(pattern string) error {
+	if pattern == "" {
+		return errors.New("Must provide a non-empty pattern")
+	}
+
+	for _, element := range SplitPath(pattern) {
+		if _, err := path.Match(element, ""); err != nil {
+			return fmt.Errorf("Invalid pattern `%s`: %s", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+func matchElements(patternElements []string, pathElements []string) bool {
+	if len(patternElements) == 0 {
+		return len(pathElements) == 0
+	}
+
+	if patternElements[0] == "**" {
+		for i := 0; i <= len(pathElements); i++ {
+			if matchElements(patternElements[1:], pathElements[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(pathElements) == 0 {
+		return false
+	}
+
+	if matched, err := path.Match(patternElements[0], pathElements[0]); err != nil || !matched {
+		return false
+	}
+
+	return matchElements(patternElements[1:], pathElements[1:])
+}
+
+// matchParentElements reports whether some path below the path elements,
+// with at least one more element, matches the pattern elements.
+func matchParentElements(patternElements []string, pathElements []string) bool {
+	if len(pathElements) == 0 {
+		return len(patternElements) > 0
+	}
+
+	if len(patternElements) == 0 {
+		return false
+	}
+
+	if patternElements[0] == "**" {
+		for i := 0; i <= len(pathElements); i++ {
+			if matchParentElements(patternElements[1:], pathElements[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if matched, err := path.Match(patternElements[0], pathElements[0]); err != nil || !matched {
+		return false
+	}
+
+	return matchParentElements(patternElements[1:], pathElements[1:])
+}
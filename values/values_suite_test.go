@@ -0,0 +1,13 @@
+package values_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestValues(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Values Suite")
+}
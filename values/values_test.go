@@ -0,0 +1,222 @@
+package values_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/frodenas/helm-osb/values"
+)
+
+var _ = Describe("Values", func() {
+	Describe("Parse", func() {
+		It("returns empty values if there are no parameters", func() {
+			parameters, err := Parse(nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(parameters).To(BeEmpty())
+		})
+
+		It("returns the parameters with dotted keys expanded", func() {
+			parameters, err := Parse([]byte(`{"persistence.size": "8Gi", "resources": {"limits.memory": "1Gi"}}`))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(parameters).To(Equal(map[string]interface{}{
+				"persistence": map[string]interface{}{"size": "8Gi"},
+				"resources": map[string]interface{}{
+					"limits": map[string]interface{}{"memory": "1Gi"},
+				},
+			}))
+		})
+
+		It("returns error if the parameters are not valid JSON", func() {
+			_, err := Parse([]byte(`[`))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Expand", func() {
+		It("merges dotted keys with nested keys", func() {
+			expanded, err := Expand(map[string]interface{}{
+				"resources":               map[string]interface{}{"requests": map[string]interface{}{"cpu": "100m"}},
+				"resources.limits.memory": "1Gi",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(expanded).To(Equal(map[string]interface{}{
+				"resources": map[string]interface{}{
+					"requests": map[string]interface{}{"cpu": "100m"},
+					"limits":   map[string]interface{}{"memory": "1Gi"},
+				},
+			}))
+		})
+
+		It("keeps escaped dots in keys", func() {
+			expanded, err := Expand(map[string]interface{}{
+				`podAnnotations.prometheus\.io/scrape`: "true",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(expanded).To(Equal(map[string]interface{}{
+				"podAnnotations": map[string]interface{}{"prometheus.io/scrape": "true"},
+			}))
+		})
+
+		It("returns error if a dotted key sets a value below another value", func() {
+			_, err := Expand(map[string]interface{}{
+				"a":   5,
+				"a.b": 1,
+			})
+			Expect(err).To(MatchError("Parameter `a` is set more than once"))
+		})
+
+		It("returns error if a dotted key sets the same value as a nested key", func() {
+			_, err := Expand(map[string]interface{}{
+				"resources":               map[string]interface{}{"limits": map[string]interface{}{"memory": "2Gi"}},
+				"resources.limits.memory": "1Gi",
+			})
+			Expect(err).To(MatchError("Parameter `resources.limits.memory` is set more than once"))
+		})
+	})
+
+	Describe("Merge", func() {
+		It("deep merges values without modifying the destination", func() {
+			dst := map[string]interface{}{
+				"image": "mysql",
+				"persistence": map[string]interface{}{
+					"enabled": true,
+					"size":    "8Gi",
+				},
+			}
+
+			merged := Merge(dst, map[string]interface{}{
+				"persistence": map[string]interface{}{"size": "16Gi"},
+			})
+			Expect(merged).To(Equal(map[string]interface{}{
+				"image": "mysql",
+				"persistence": map[string]interface{}{
+					"enabled": true,
+					"size":    "16Gi",
+				},
+			}))
+			Expect(dst["persistence"]).To(Equal(map[string]interface{}{
+				"enabled": true,
+				"size":    "8Gi",
+			}))
+		})
+
+		It("replaces non-map values", func() {
+			merged := Merge(
+				map[string]interface{}{"persistence": map[string]interface{}{"size": "8Gi"}},
+				map[string]interface{}{"persistence": false},
+			)
+			Expect(merged).To(Equal(map[string]interface{}{"persistence": false}))
+		})
+	})
+
+	Describe("Diff", func() {
+		It("returns the values that differ from the base", func() {
+			diff := Diff(
+				map[string]interface{}{
+					"image":       "mysql",
+					"replicas":    3,
+					"persistence": map[string]interface{}{"enabled": true, "size": "16Gi"},
+				},
+				map[string]interface{}{
+					"image":       "mysql",
+					"replicas":    float64(1),
+					"persistence": map[string]interface{}{"enabled": true, "size": "8Gi"},
+				},
+			)
+			Expect(diff).To(Equal(map[string]interface{}{
+				"replicas":    3,
+				"persistence": map[string]interface{}{"size": "16Gi"},
+			}))
+		})
+	})
+
+	Describe("SplitPath", func() {
+		It("splits a dotted path", func() {
+			Expect(SplitPath("a.b.c")).To(Equal([]string{"a", "b", "c"}))
+		})
+
+		It("does not split keys with empty path elements", func() {
+			Expect(SplitPath(".a")).To(Equal([]string{".a"}))
+			Expect(SplitPath("a..b")).To(Equal([]string{"a..b"}))
+		})
+	})
+
+	Describe("Paths", func() {
+		It("returns the sorted leaf paths", func() {
+			paths := Paths(map[string]interface{}{
+				"image":        "mysql",
+				"resources":    map[string]interface{}{"limits": map[string]interface{}{"memory": "1Gi"}},
+				"nodeSelector": map[string]interface{}{},
+				"annotations":  map[string]interface{}{"prometheus.io/scrape": "true"},
+			})
+			Expect(paths).To(Equal([]string{
+				`annotations.prometheus\.io/scrape`,
+				"image",
+				"nodeSelector",
+				"resources.limits.memory",
+			}))
+		})
+	})
+
+	Describe("MatchPath", func() {
+		It("matches exact paths", func() {
+			Expect(MatchPath("persistence.size", "persistence.size")).To(BeTrue())
+			Expect(MatchPath("persistence.size", "persistence.enabled")).To(BeFalse())
+		})
+
+		It("matches children of a path", func() {
+			Expect(MatchPath("resources", "resources.limits.memory")).To(BeTrue())
+			Expect(MatchPath("resources.limits.memory", "resources")).To(BeFalse())
+		})
+
+		It("matches globs on a single element", func() {
+			Expect(MatchPath("resources.*.memory", "resources.limits.memory")).To(BeTrue())
+			Expect(MatchPath("resources.*.memory", "resources.limits.cpu")).To(BeFalse())
+			Expect(MatchPath("*Password", "rootPassword")).To(BeTrue())
+		})
+
+		It("matches any number of elements with **", func() {
+			Expect(MatchPath("**.securityContext", "securityContext.runAsUser")).To(BeTrue())
+			Expect(MatchPath("**.securityContext", "master.podSecurityContext.fsGroup")).To(BeFalse())
+			Expect(MatchPath("**.securityContext", "master.securityContext.fsGroup")).To(BeTrue())
+		})
+	})
+
+	Describe("CoversPath", func() {
+		It("covers the paths matched by the pattern", func() {
+			Expect(CoversPath("image.repository", "image.repository")).To(BeTrue())
+			Expect(CoversPath("image", "image.repository")).To(BeTrue())
+		})
+
+		It("covers the parents of the paths matched by the pattern", func() {
+			Expect(CoversPath("image.repository", "image")).To(BeTrue())
+			Expect(CoversPath("resources.*.memory", "resources")).To(BeTrue())
+			Expect(CoversPath("resources.*.memory", "resources.limits")).To(BeTrue())
+			Expect(CoversPath("**.securityContext", "master")).To(BeTrue())
+		})
+
+		It("does not cover unrelated paths", func() {
+			Expect(CoversPath("image.repository", "image.tag")).To(BeFalse())
+			Expect(CoversPath("image.repository", "persistence")).To(BeFalse())
+			Expect(CoversPath("resources.*.memory", "resources.limits.cpu")).To(BeFalse())
+		})
+	})
+
+	Describe("ValidatePattern", func() {
+		It("does not return error if the pattern is valid", func() {
+			Expect(ValidatePattern("resources.*.memory")).To(Succeed())
+		})
+
+		It("returns error if the pattern is empty", func() {
+			err := ValidatePattern("")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Must provide a non-empty pattern"))
+		})
+
+		It("returns error if the pattern is malformed", func() {
+			err := ValidatePattern("resources.[")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Invalid pattern `resources.[`"))
+		})
+	})
+})
@@ -0,0 +1,130 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"code.cloudfoundry.org/lager"
+)
+
+const (
+	operationIDLogKey = "operation-id"
+	instanceIDLogKey  = "instance-id"
+)
+
+var ErrQueueFull = errors.New("Too many operations in progress, try again later")
+
+type Task struct {
+	OperationID string
+	InstanceID  string
+	Run         func()
+}
+
+// Pool runs submitted tasks on a bounded number of goroutines and keeps track
+// of the operations that are still queued or running, and of the instances
+// they operate on.
+type Pool struct {
+	queue     chan Task
+	pending   map[string]bool
+	instances map[string]string
+	mutex     sync.RWMutex
+	wg        sync.WaitGroup
+	logger    lager.Logger
+}
+
+func NewPool(workers int, queueSize int, logger lager.Logger) *Pool {
+	pool := &Pool{
+		queue:     make(chan Task, queueSize),
+		pending:   map[string]bool{},
+		instances: map[string]string{},
+		logger:    logger.Session("worker-pool"),
+	}
+
+	for i := 0; i < workers; i++ {
+		pool.wg.Add(1)
+		go pool.work()
+	}
+
+	return pool
+}
+
+func (p *Pool) Submit(task Task) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	select {
+	case p.queue <- task:
+		p.pending[task.OperationID] = true
+		p.instances[task.InstanceID] = task.OperationID
+		p.logger.Debug("submitted", lager.Data{
+			operationIDLogKey: task.OperationID,
+			instanceIDLogKey:  task.InstanceID,
+		})
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+func (p *Pool) Pending(operationID string) bool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return p.pending[operationID]
+}
+
+// PendingOperation returns the ID of the last operation submitted for an
+// instance while it is still queued or running.
+func (p *Pool) PendingOperation(instanceID string) (string, bool) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	operationID, ok := p.instances[instanceID]
+	return operationID, ok
+}
+
+// Stop waits for all queued tasks to finish. No tasks can be submitted after
+// the pool has been stopped.
+func (p *Pool) Stop() {
+	close(p.queue)
+	p.wg.Wait()
+}
+
+func (p *Pool) work() {
+	defer p.wg.Done()
+
+	for task := range p.queue {
+		p.logger.Debug("running", lager.Data{
+			operationIDLogKey: task.OperationID,
+			instanceIDLogKey:  task.InstanceID,
+		})
+
+		p.run(task)
+
+		p.mutex.Lock()
+		delete(p.pending, task.OperationID)
+		if p.instances[task.InstanceID] == task.OperationID {
+			delete(p.instances, task.InstanceID)
+		}
+		p.mutex.Unlock()
+
+		p.logger.Debug("finished", lager.Data{
+			operationIDLogKey: task.OperationID,
+			instanceIDLogKey:  task.InstanceID,
+		})
+	}
+}
+
+func (p *Pool) run(task Task) {
+	defer func() {
+		if r := recover(); r != nil {
+			p.logger.Error("panic", fmt.Errorf("%v", r), lager.Data{
+				operationIDLogKey: task.OperationID,
+				instanceIDLogKey:  task.InstanceID,
+			})
+		}
+	}()
+
+	task.Run()
+}
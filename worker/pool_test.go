@@ -0,0 +1,97 @@
+package worker_test
+
+import (
+	"code.cloudfoundry.org/lager/lagertest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/frodenas/helm-osb/worker"
+)
+
+var _ = Describe("Pool", func() {
+	var (
+		pool    *Pool
+		release chan struct{}
+	)
+
+	BeforeEach(func() {
+		pool = NewPool(1, 1, lagertest.NewTestLogger("worker-test"))
+		release = make(chan struct{})
+	})
+
+	blockingTask := func(operationID string, started chan struct{}) Task {
+		return Task{
+			OperationID: operationID,
+			InstanceID:  "fake-instance-id",
+			Run: func() {
+				if started != nil {
+					close(started)
+				}
+				<-release
+			},
+		}
+	}
+
+	It("runs submitted tasks and tracks them while pending", func() {
+		started := make(chan struct{})
+		Expect(pool.Submit(blockingTask("fake-operation-1", started))).To(Succeed())
+
+		Eventually(started).Should(BeClosed())
+		Expect(pool.Pending("fake-operation-1")).To(BeTrue())
+
+		close(release)
+		Eventually(func() bool { return pool.Pending("fake-operation-1") }).Should(BeFalse())
+
+		pool.Stop()
+	})
+
+	It("tracks the pending operation of each instance", func() {
+		started := make(chan struct{})
+		Expect(pool.Submit(blockingTask("fake-operation-1", started))).To(Succeed())
+		Eventually(started).Should(BeClosed())
+
+		operationID, pending := pool.PendingOperation("fake-instance-id")
+		Expect(pending).To(BeTrue())
+		Expect(operationID).To(Equal("fake-operation-1"))
+
+		_, pending = pool.PendingOperation("other-instance-id")
+		Expect(pending).To(BeFalse())
+
+		close(release)
+		Eventually(func() bool {
+			_, pending := pool.PendingOperation("fake-instance-id")
+			return pending
+		}).Should(BeFalse())
+
+		pool.Stop()
+	})
+
+	It("returns error when the queue is full", func() {
+		started := make(chan struct{})
+		Expect(pool.Submit(blockingTask("fake-operation-1", started))).To(Succeed())
+		Eventually(started).Should(BeClosed())
+
+		Expect(pool.Submit(blockingTask("fake-operation-2", nil))).To(Succeed())
+
+		err := pool.Submit(blockingTask("fake-operation-3", nil))
+		Expect(err).To(Equal(ErrQueueFull))
+		Expect(pool.Pending("fake-operation-3")).To(BeFalse())
+
+		close(release)
+		pool.Stop()
+	})
+
+	It("keeps running tasks after a task panics", func() {
+		Expect(pool.Submit(Task{OperationID: "fake-operation-1", Run: func() { panic("fake-panic") }})).To(Succeed())
+		Eventually(func() bool { return pool.Pending("fake-operation-1") }).Should(BeFalse())
+
+		done := make(chan struct{})
+		Expect(pool.Submit(Task{OperationID: "fake-operation-2", Run: func() { close(done) }})).To(Succeed())
+
+		Eventually(done).Should(BeClosed())
+
+		close(release)
+		pool.Stop()
+	})
+})